@@ -0,0 +1,92 @@
+package apperror
+
+import (
+	"strings"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+)
+
+// Kind classifies an error independently of the transport. Handlers map kinds
+// to HTTP status codes.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthenticated
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindTooLarge
+	KindLocked
+	KindTooManyRequests
+	KindUnavailable
+)
+
+// Error is a domain error with a stable Code clients can rely on, e.g. to
+// localize messages. Two errors with the same code match under errors.Is.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Fields lists per-field problems of validation errors.
+	Fields []model.FieldError
+	// RetryAfter tells clients when a locked or throttled request may be repeated.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	for i, field := range e.Fields {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(field.Field + " " + field.Message)
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithRetryAfter returns a copy of e carrying the given retry delay.
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	c := *e
+	c.RetryAfter = d
+	return &c
+}
+
+// Wrap returns a copy of e with err as its cause.
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+const CodeValidationFailed = "request.validation_failed"
+
+var ErrValidation = New(KindInvalid, CodeValidationFailed, "the request contains invalid fields")
+
+func Validation(fields ...model.FieldError) *Error {
+	c := *ErrValidation
+	c.Fields = fields
+	return &c
+}
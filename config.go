@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MicroSOA-09/auth-service/config"
+)
+
+const configUsage = "usage: auth-service config print [flags]"
+
+// runConfig implements the config subcommand and returns the process exit
+// code. "config print" shows the effective configuration with the secrets
+// redacted and reports whether it is valid.
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	cfg, rest, code := loadConfig("config print", args[1:])
+	if cfg == nil {
+		return code
+	}
+	if len(rest) > 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	if err := config.Print(os.Stdout, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
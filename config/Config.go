@@ -0,0 +1,450 @@
+// Package config holds the typed configuration of the service. Values come
+// from the defaults, an optional YAML file, the environment and command line
+// flags, each overriding the one before. See Load.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/handler"
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/ratelimit"
+	"github.com/MicroSOA-09/auth-service/service"
+)
+
+// Every setting has a yaml key, which also names its flag, and the
+// environment variables it is read from. Settings tagged secret can be read
+// from a file named by <ENV>_FILE and are redacted when printed.
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Auth      Auth      `yaml:"auth"`
+	Cookies   Cookies   `yaml:"cookies"`
+	CORS      CORS      `yaml:"cors"`
+	Store     Store     `yaml:"store"`
+	Mail      Mail      `yaml:"mail"`
+	Lockout   Lockout   `yaml:"lockout"`
+	Password  Password  `yaml:"password"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	Events    Events    `yaml:"events"`
+	Tracing   Tracing   `yaml:"tracing"`
+}
+
+type Server struct {
+	Port int `yaml:"port" env:"PORT"`
+	// PublicBaseURL prefixes the links in emails, it defaults to
+	// http://localhost:<port>.
+	PublicBaseURL  string        `yaml:"public_base_url" env:"PUBLIC_BASE_URL"`
+	TrustedProxies []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	ReadTimeout    time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	// WriteTimeout has to cover the whole handler, the 5s its service calls
+	// may take included: login and register hash with argon2id, often
+	// inside a transaction.
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+type Auth struct {
+	JWTSecret           string        `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	AccessTokenLifetime time.Duration `yaml:"access_token_lifetime" env:"ACCESS_TOKEN_LIFETIME"`
+	SessionLifetime     time.Duration `yaml:"session_lifetime" env:"SESSION_LIFETIME"`
+	// SessionLimits caps the sessions per role, e.g. Administrator=2.
+	SessionLimits map[string]int `yaml:"session_limits" env:"SESSION_LIMITS"`
+	GeoIPDatabase string         `yaml:"geoip_database" env:"GEOIP_DATABASE"`
+}
+
+type Cookies struct {
+	Enabled  bool   `yaml:"enabled" env:"AUTH_COOKIES"`
+	Domain   string `yaml:"domain" env:"COOKIE_DOMAIN"`
+	Secure   bool   `yaml:"secure" env:"COOKIE_SECURE"`
+	SameSite string `yaml:"same_site" env:"COOKIE_SAMESITE"`
+}
+
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+type Store struct {
+	// Backend is mongo, postgres or memory. The memory backend loses all
+	// data on restart and is meant for tests and local runs.
+	Backend string `yaml:"backend" env:"STORE_BACKEND"`
+	// UserCacheSize is the number of cached users, 0 disables the cache.
+	UserCacheSize int      `yaml:"user_cache_size" env:"USER_CACHE_SIZE"`
+	Mongo         Mongo    `yaml:"mongo"`
+	Postgres      Postgres `yaml:"postgres"`
+}
+
+type Mongo struct {
+	URI         string `yaml:"uri" env:"MONGO_DB_URI" secret:"true"`
+	Database    string `yaml:"database" env:"MONGO_DATABASE"`
+	AutoMigrate bool   `yaml:"auto_migrate" env:"MONGO_AUTO_MIGRATE"`
+}
+
+type Postgres struct {
+	DSN string `yaml:"dsn" env:"POSTGRES_DSN" secret:"true"`
+}
+
+type Mail struct {
+	// Transport is smtp, file or log. It defaults to smtp when SMTP
+	// credentials are set and to log otherwise.
+	Transport     string `yaml:"transport" env:"MAIL_TRANSPORT"`
+	From          string `yaml:"from" env:"MAIL_FROM"`
+	TemplateDir   string `yaml:"template_dir" env:"MAIL_TEMPLATE_DIR"`
+	DefaultLocale string `yaml:"default_locale" env:"MAIL_DEFAULT_LOCALE"`
+	// Dir and DirFormat (maildir or eml) configure the file transport.
+	Dir       string `yaml:"dir" env:"MAIL_DIR"`
+	DirFormat string `yaml:"dir_format" env:"MAIL_DIR_FORMAT"`
+	// DKIMKeys is a comma separated list of domain:selector:keyfile entries.
+	DKIMKeys string `yaml:"dkim_keys" env:"DKIM_KEYS"`
+	SMTP     SMTP   `yaml:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" env:"SMTP_USERNAME,MAIL_USER"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD,MAIL_APP_PASSWORD" secret:"true"`
+	TLS      string `yaml:"tls" env:"SMTP_TLS"`
+}
+
+type Lockout struct {
+	MaxFailures   int           `yaml:"max_failures" env:"LOCKOUT_MAX_FAILURES"`
+	MaxIPFailures int           `yaml:"max_ip_failures" env:"LOCKOUT_MAX_IP_FAILURES"`
+	Duration      time.Duration `yaml:"duration" env:"LOCKOUT_DURATION"`
+}
+
+type Password struct {
+	BreachedPasswordsFile string `yaml:"breached_passwords_file" env:"BREACHED_PASSWORDS_FILE"`
+	MinLength             int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MinScore              int    `yaml:"min_score" env:"PASSWORD_MIN_SCORE"`
+	HashAlgorithm         string `yaml:"hash_algorithm" env:"PASSWORD_HASH_ALGORITHM"`
+	Argon2MemoryKiB       uint32 `yaml:"argon2_memory_kib" env:"ARGON2_MEMORY_KIB"`
+	Argon2Iterations      uint32 `yaml:"argon2_iterations" env:"ARGON2_ITERATIONS"`
+	Argon2Threads         uint8  `yaml:"argon2_threads" env:"ARGON2_THREADS"`
+	BcryptCost            int    `yaml:"bcrypt_cost" env:"BCRYPT_COST"`
+	Pepper                string `yaml:"pepper" env:"PASSWORD_PEPPER" secret:"true"`
+	PepperID              string `yaml:"pepper_id" env:"PASSWORD_PEPPER_ID"`
+	// OldPeppers lists retired peppers as comma separated id:secret pairs.
+	OldPeppers string `yaml:"old_peppers" env:"PASSWORD_OLD_PEPPERS" secret:"true"`
+}
+
+type RateLimit struct {
+	// Backend is memory or mongo. The memory store is only correct with a
+	// single replica.
+	Backend  string `yaml:"backend" env:"RATE_LIMIT_BACKEND"`
+	Policies string `yaml:"policies" env:"RATE_LIMIT_POLICIES"`
+}
+
+type Events struct {
+	// Transport is empty, local, nats or kafka. Without one events only go
+	// to the webhooks.
+	Transport string `yaml:"transport" env:"EVENT_TRANSPORT"`
+	NATS      NATS   `yaml:"nats"`
+	Kafka     Kafka  `yaml:"kafka"`
+}
+
+type NATS struct {
+	URL           string `yaml:"url" env:"NATS_URL"`
+	SubjectPrefix string `yaml:"subject_prefix" env:"NATS_SUBJECT_PREFIX"`
+}
+
+type Kafka struct {
+	Brokers []string `yaml:"brokers" env:"KAFKA_BROKERS"`
+	Topic   string   `yaml:"topic" env:"KAFKA_TOPIC"`
+}
+
+type Tracing struct {
+	// Exporter is empty, otlp or stdout. Without one no spans are recorded,
+	// but incoming trace context is still passed on.
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	// OTLPEndpoint is the collector's OTLP/HTTP base URL, spans go to its
+	// /v1/traces. A URL with a path is taken as the full traces URL.
+	OTLPEndpoint string  `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName  string  `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio  float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+const defaultRateLimitPolicies = "login:ip:20/1m,login:username:10/15m,register:ip:5/1h," +
+	"password_forgot:ip:5/1h,password_reset:ip:10/1h,refresh:ip:60/1m"
+
+func Default() *Config {
+	hasher := service.DefaultHasherConfig()
+	lockout := service.DefaultLockoutPolicy()
+	password := service.DefaultPasswordPolicy(nil)
+	session := service.DefaultSessionPolicy()
+	cors := handler.DefaultCORSConfig()
+	return &Config{
+		Server: Server{
+			Port:            80,
+			ReadTimeout:     time.Second,
+			WriteTimeout:    10 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Auth: Auth{
+			AccessTokenLifetime: session.AccessTokenLifetime,
+			SessionLifetime:     session.Lifetime,
+		},
+		Cookies: Cookies{Secure: true, SameSite: "lax"},
+		CORS: CORS{
+			AllowedMethods: cors.AllowedMethods,
+			AllowedHeaders: cors.AllowedHeaders,
+			ExposedHeaders: cors.ExposedHeaders,
+			MaxAge:         cors.MaxAge,
+		},
+		Store: Store{
+			Backend:       "mongo",
+			UserCacheSize: 10000,
+			Mongo:         Mongo{Database: "auth", AutoMigrate: true},
+		},
+		Mail: Mail{
+			DefaultLocale: "en",
+			Dir:           "mail",
+			DirFormat:     "maildir",
+			SMTP:          SMTP{Host: "smtp.gmail.com", Port: 587, TLS: string(service.TLSModeStartTLS)},
+		},
+		Lockout: Lockout{
+			MaxFailures:   lockout.MaxUserFailures,
+			MaxIPFailures: lockout.MaxIPFailures,
+			Duration:      lockout.LockoutDuration,
+		},
+		Password: Password{
+			MinLength:        password.MinLength,
+			MinScore:         password.MinScore,
+			HashAlgorithm:    hasher.Algorithm,
+			Argon2MemoryKiB:  hasher.Argon2.Memory,
+			Argon2Iterations: hasher.Argon2.Iterations,
+			Argon2Threads:    hasher.Argon2.Threads,
+			BcryptCost:       hasher.BcryptCost,
+			PepperID:         "1",
+		},
+		RateLimit: RateLimit{Backend: "memory", Policies: defaultRateLimitPolicies},
+		Events: Events{
+			NATS:  NATS{URL: "nats://localhost:4222", SubjectPrefix: "auth.events"},
+			Kafka: Kafka{Brokers: []string{"localhost:9092"}, Topic: "auth.user-events"},
+		},
+		Tracing: Tracing{
+			OTLPEndpoint: "http://localhost:4318",
+			ServiceName:  "auth-service",
+			SampleRatio:  1,
+		},
+	}
+}
+
+// resolve fills in the defaults that depend on other settings.
+func (c *Config) resolve() {
+	if c.Server.PublicBaseURL == "" {
+		c.Server.PublicBaseURL = fmt.Sprintf("http://localhost:%d", c.Server.Port)
+	}
+	if c.Mail.Transport == "" {
+		c.Mail.Transport = service.MailTransportLog
+		if c.Mail.SMTP.Username != "" && c.Mail.SMTP.Password != "" {
+			c.Mail.Transport = service.MailTransportSMTP
+		}
+	}
+	if c.Mail.From == "" {
+		c.Mail.From = c.Mail.SMTP.Username
+	}
+	if c.Mail.From == "" {
+		c.Mail.From = "no-reply@localhost"
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		quoted := make([]string, len(allowed))
+		for i, a := range allowed {
+			quoted[i] = strconv.Quote(a)
+		}
+		check(false, key, "must be one of %s, not %q", strings.Join(quoted, ", "), value)
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port", "must be between 1 and 65535")
+	publicURL, err := url.Parse(c.Server.PublicBaseURL)
+	check(err == nil && (publicURL.Scheme == "http" || publicURL.Scheme == "https") && publicURL.Host != "", "server.public_base_url", "must be an http or https URL")
+	if _, err := handler.NewClientIPResolver(c.Server.TrustedProxies); err != nil {
+		check(false, "server.trusted_proxies", "%v", err)
+	}
+	check(c.Server.ReadTimeout > 0, "server.read_timeout", "must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout", "must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout", "must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret", "is required")
+	check(c.Auth.AccessTokenLifetime > 0, "auth.access_token_lifetime", "must be positive")
+	check(c.Auth.SessionLifetime > 0, "auth.session_lifetime", "must be positive")
+	for role, max := range c.Auth.SessionLimits {
+		switch model.UserRole(role) {
+		case model.RoleAdmin, model.RoleAuthor, model.RoleTourist:
+			check(max >= 0, "auth.session_limits", "limit of %s must not be negative", role)
+		default:
+			check(false, "auth.session_limits", "unknown role %q", role)
+		}
+	}
+
+	oneOf("cookies.same_site", c.Cookies.SameSite, "lax", "strict", "none")
+	check(c.Cookies.SameSite != "none" || c.Cookies.Secure, "cookies.same_site", "none requires cookies.secure")
+	if _, err := handler.NewCORS(c.CORS.HandlerConfig()); err != nil {
+		check(false, "cors", "%v", err)
+	}
+
+	oneOf("store.backend", c.Store.Backend, "mongo", "postgres", "memory")
+	switch c.Store.Backend {
+	case "mongo":
+		check(c.Store.Mongo.URI != "", "store.mongo.uri", "is required for the mongo backend")
+		check(c.Store.Mongo.Database != "", "store.mongo.database", "is required for the mongo backend")
+	case "postgres":
+		check(c.Store.Postgres.DSN != "", "store.postgres.dsn", "is required for the postgres backend")
+	}
+	check(c.Store.UserCacheSize >= 0, "store.user_cache_size", "must not be negative")
+
+	oneOf("mail.transport", c.Mail.Transport, service.MailTransportSMTP, service.MailTransportFile, service.MailTransportLog)
+	switch c.Mail.Transport {
+	case service.MailTransportSMTP:
+		check(c.Mail.SMTP.Host != "", "mail.smtp.host", "is required for the smtp transport")
+		check(c.Mail.SMTP.Port > 0 && c.Mail.SMTP.Port < 65536, "mail.smtp.port", "must be between 1 and 65535")
+		oneOf("mail.smtp.tls", c.Mail.SMTP.TLS, string(service.TLSModeNone), string(service.TLSModeStartTLS), string(service.TLSModeImplicit))
+	case service.MailTransportFile:
+		check(c.Mail.Dir != "", "mail.dir", "is required for the file transport")
+		oneOf("mail.dir_format", c.Mail.DirFormat, "maildir", "eml")
+	}
+	if _, err := service.ParseDKIMKeys(c.Mail.DKIMKeys); err != nil {
+		check(false, "mail.dkim_keys", "%v", err)
+	}
+
+	check(c.Lockout.MaxFailures > 0, "lockout.max_failures", "must be positive")
+	check(c.Lockout.MaxIPFailures > 0, "lockout.max_ip_failures", "must be positive")
+	check(c.Lockout.Duration > 0, "lockout.duration", "must be positive")
+
+	check(c.Password.MinLength > 0, "password.min_length", "must be positive")
+	check(c.Password.MinScore >= 0 && c.Password.MinScore <= 4, "password.min_score", "must be between 0 and 4")
+	if _, err := service.NewPasswordHasher(c.Password.HasherConfig()); err != nil {
+		check(false, "password", "%v", err)
+	}
+
+	oneOf("rate_limit.backend", c.RateLimit.Backend, "memory", "mongo")
+	check(c.RateLimit.Backend != "mongo" || c.Store.Backend == "mongo", "rate_limit.backend", "mongo requires store.backend mongo")
+	if _, err := ratelimit.ParsePolicies(c.RateLimit.Policies); err != nil {
+		check(false, "rate_limit.policies", "%v", err)
+	}
+
+	oneOf("events.transport", c.Events.Transport, "", "local", "nats", "kafka")
+	switch c.Events.Transport {
+	case "nats":
+		check(c.Events.NATS.URL != "", "events.nats.url", "is required for the nats transport")
+	case "kafka":
+		check(len(c.Events.Kafka.Brokers) > 0, "events.kafka.brokers", "is required for the kafka transport")
+		check(c.Events.Kafka.Topic != "", "events.kafka.topic", "is required for the kafka transport")
+	}
+
+	oneOf("tracing.exporter", c.Tracing.Exporter, "", "otlp", "stdout")
+	if c.Tracing.Exporter == "otlp" {
+		endpoint, err := url.Parse(c.Tracing.OTLPEndpoint)
+		check(err == nil && (endpoint.Scheme == "http" || endpoint.Scheme == "https") && endpoint.Host != "", "tracing.otlp_endpoint", "must be an http or https URL")
+	}
+	check(c.Tracing.ServiceName != "", "tracing.service_name", "is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1")
+	return errors.Join(errs...)
+}
+
+func (a Auth) SessionPolicy() service.SessionPolicy {
+	policy := service.DefaultSessionPolicy()
+	policy.Lifetime = a.SessionLifetime
+	policy.AccessTokenLifetime = a.AccessTokenLifetime
+	if len(a.SessionLimits) > 0 {
+		policy.MaxPerRole = map[model.UserRole]int{}
+		for role, max := range a.SessionLimits {
+			policy.MaxPerRole[model.UserRole(role)] = max
+		}
+	}
+	return policy
+}
+
+func (c Cookies) HandlerConfig() handler.CookieConfig {
+	sameSite := map[string]http.SameSite{
+		"lax":    http.SameSiteLaxMode,
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	}[c.SameSite]
+	return handler.CookieConfig{Enabled: c.Enabled, Domain: c.Domain, Secure: c.Secure, SameSite: sameSite}
+}
+
+func (c CORS) HandlerConfig() handler.CORSConfig {
+	methods := make([]string, len(c.AllowedMethods))
+	for i, method := range c.AllowedMethods {
+		methods[i] = strings.ToUpper(method)
+	}
+	return handler.CORSConfig{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   methods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+func (m Mail) MailerConfig() service.MailerConfig {
+	return service.MailerConfig{
+		Transport:    m.Transport,
+		SMTPHost:     m.SMTP.Host,
+		SMTPPort:     m.SMTP.Port,
+		SMTPUsername: m.SMTP.Username,
+		SMTPPassword: m.SMTP.Password,
+		SMTPTLSMode:  service.TLSMode(m.SMTP.TLS),
+		Dir:          m.Dir,
+		Maildir:      m.DirFormat == "maildir",
+	}
+}
+
+func (l Lockout) Policy() service.LockoutPolicy {
+	policy := service.DefaultLockoutPolicy()
+	policy.MaxUserFailures = l.MaxFailures
+	policy.MaxIPFailures = l.MaxIPFailures
+	policy.LockoutDuration = l.Duration
+	return policy
+}
+
+func (p Password) HasherConfig() service.HasherConfig {
+	cfg := service.DefaultHasherConfig()
+	cfg.Algorithm = p.HashAlgorithm
+	cfg.Argon2.Memory = p.Argon2MemoryKiB
+	cfg.Argon2.Iterations = p.Argon2Iterations
+	cfg.Argon2.Threads = p.Argon2Threads
+	cfg.BcryptCost = p.BcryptCost
+
+	cfg.Peppers = map[string][]byte{}
+	for _, entry := range strings.Split(p.OldPeppers, ",") {
+		if id, secret, ok := strings.Cut(strings.TrimSpace(entry), ":"); ok {
+			cfg.Peppers[id] = []byte(secret)
+		}
+	}
+	if p.Pepper != "" {
+		cfg.PepperID = p.PepperID
+		cfg.Peppers[cfg.PepperID] = []byte(p.Pepper)
+	}
+	return cfg
+}
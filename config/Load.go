@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting is one leaf of the Config struct.
+type setting struct {
+	key    string
+	env    []string
+	secret bool
+	value  reflect.Value
+}
+
+func settings(v reflect.Value, prefix string) []setting {
+	var result []setting
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := prefix + field.Tag.Get("yaml")
+		if field.Type.Kind() == reflect.Struct {
+			result = append(result, settings(v.Field(i), key+".")...)
+			continue
+		}
+		s := setting{key: key, secret: field.Tag.Get("secret") == "true", value: v.Field(i)}
+		if env := field.Tag.Get("env"); env != "" {
+			s.env = strings.Split(env, ",")
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// set parses a setting from its text form. Lists are comma separated, maps
+// are comma separated key=value pairs.
+func (s setting) set(text string) error {
+	v := s.value
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint8, reflect.Uint32:
+		n, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		m := map[string]int{}
+		for _, entry := range strings.Split(text, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(entry, "=")
+			n, err := strconv.Atoi(value)
+			if !ok || err != nil {
+				return fmt.Errorf("invalid entry %q, want key=number", entry)
+			}
+			m[strings.TrimSpace(key)] = n
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// fromEnv reads the first of the setting's variables that is set. For each
+// variable NAME, NAME_FILE may name a file holding the value instead, as
+// Docker and Kubernetes secrets are mounted.
+func (s setting) fromEnv() (string, string, bool, error) {
+	for _, name := range s.env {
+		value, ok := os.LookupEnv(name)
+		ok = ok && value != ""
+		if path := os.Getenv(name + "_FILE"); path != "" {
+			if ok {
+				return "", "", false, fmt.Errorf("both %s and %s_FILE are set", name, name)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", "", false, fmt.Errorf("reading %s_FILE: %w", name, err)
+			}
+			return strings.TrimRight(string(data), "\r\n"), name + "_FILE", true, nil
+		}
+		if ok {
+			return value, name, true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// Load builds the configuration from the defaults, the YAML file named by
+// -config or CONFIG_FILE, the environment and the flags in args, in that
+// order of precedence. Every setting has a flag named after its YAML key,
+// e.g. -server.port. The arguments after the flags are returned. The result
+// is not validated yet.
+func Load(name string, args []string) (*Config, []string, error) {
+	cfg := Default()
+	all := settings(reflect.ValueOf(cfg).Elem(), "")
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file ($CONFIG_FILE)")
+	flagValues := map[string]string{}
+	for _, s := range all {
+		usage := "see the " + s.key + " setting"
+		if len(s.env) > 0 {
+			usage = "overrides $" + strings.Join(s.env, ", $")
+		}
+		flags.Func(s.key, usage, func(value string) error {
+			flagValues[s.key] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("%s: %w", *configFile, err)
+		}
+	}
+
+	for _, s := range all {
+		value, source, ok, err := s.fromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			if err := s.set(value); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s: %w", source, err)
+			}
+		}
+	}
+	for _, s := range all {
+		if value, ok := flagValues[s.key]; ok {
+			if err := s.set(value); err != nil {
+				return nil, nil, fmt.Errorf("invalid -%s: %w", s.key, err)
+			}
+		}
+	}
+
+	cfg.resolve()
+	return cfg, flags.Args(), nil
+}
+
+// Print writes the configuration as YAML, which Load accepts back, with the
+// secrets redacted.
+func Print(w io.Writer, cfg *Config) error {
+	redacted := *cfg
+	for _, s := range settings(reflect.ValueOf(&redacted).Elem(), "") {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString("REDACTED")
+		}
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&redacted); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
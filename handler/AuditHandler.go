@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/service"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// MiddlewareRequestInfo passes the client address, user agent and request ID
+// to the services for the audit log. It must run after MiddlewareRequestID
+// and the ClientIPResolver.
+func MiddlewareRequestInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := service.WithRequestInfo(r.Context(), service.RequestInfo{
+			IP:        ClientIP(r),
+			UserAgent: r.UserAgent(),
+			RequestID: RequestID(r),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type AuditHandler struct {
+	logger       *log.Logger
+	auditService *service.AuditService
+}
+
+func NewAuditHandler(auditService *service.AuditService, logger *log.Logger) *AuditHandler {
+	return &AuditHandler{auditService: auditService, logger: logger}
+}
+
+// auditFilter reads the ?user_id=, ?action=, ?from= and ?to= filters, times
+// are RFC 3339.
+func auditFilter(r *http.Request) (repository.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := repository.AuditFilter{UserID: query.Get("user_id"), Action: query.Get("action")}
+	v := &validator{}
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			v.add(param.name, CodeInvalidFormat, "must be an RFC 3339 timestamp")
+			continue
+		}
+		*param.dst = t
+	}
+	return filter, v.err()
+}
+
+// Query lists audit entries newest first. ?cursor= continues after the page
+// that returned it, ?limit= caps the page size.
+func (h *AuditHandler) Query(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	limit := defaultAuditLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAuditLimit {
+			writeProblem(w, r, h.logger, fieldError("limit", CodeInvalidFormat, fmt.Sprintf("must be a number between 1 and %d", maxAuditLimit)))
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	page, err := h.auditService.Query(ctx, filter, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	writeJSON(w, h.logger, http.StatusOK, page)
+}
+
+// Export streams the matching entries oldest first as JSON Lines.
+func (h *AuditHandler) Export(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	// The export can take longer than the server's write timeout allows, so
+	// the deadline is pushed out as entries are written.
+	controller := http.NewResponseController(w)
+	extendDeadline := func() { controller.SetWriteDeadline(time.Now().Add(30 * time.Second)) }
+	extendDeadline()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.jsonl"`, time.Now().UTC().Format("20060102T150405Z")))
+	encoder := json.NewEncoder(w)
+	count := 0
+	err = h.auditService.Export(r.Context(), filter, func(entry model.AuditEntry) error {
+		if count%100 == 0 {
+			extendDeadline()
+		}
+		count++
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		// Once streaming has started the status can't change anymore.
+		if count == 0 {
+			w.Header().Del("Content-Disposition")
+			writeProblem(w, r, h.logger, err)
+			return
+		}
+		h.logger.Printf("Audit log export aborted after %d entries: %v", count, err)
+		return
+	}
+	h.logger.Printf("Audit log export of %d entries by %s", count, CurrentUser(r).Username)
+}
+
+// Verify checks the hash chain of the whole log.
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Now().Add(5 * time.Minute))
+
+	result, err := h.auditService.Verify(r.Context())
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	if !result.Valid {
+		h.logger.Printf("Audit log hash chain is broken at seq %d", result.BrokenAt)
+	}
+	writeJSON(w, h.logger, http.StatusOK, result)
+}
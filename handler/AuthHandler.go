@@ -2,24 +2,25 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/MicroSOA-09/auth-service/model"
-	"github.com/MicroSOA-09/auth-service/repository"
 	"github.com/MicroSOA-09/auth-service/service"
+	"github.com/gorilla/mux"
 )
 
 type AuthHandler struct {
 	logger      *log.Logger
 	authService *service.AuthService
+	cookies     CookieConfig
 }
 
-func NewAuthHandler(authService *service.AuthService, logger *log.Logger) *AuthHandler {
-	return &AuthHandler{authService: authService, logger: logger}
+func NewAuthHandler(authService *service.AuthService, cookies CookieConfig, logger *log.Logger) *AuthHandler {
+	return &AuthHandler{authService: authService, cookies: cookies, logger: logger}
 }
 
 func (h *AuthHandler) Register(rw http.ResponseWriter, r *http.Request) {
@@ -31,63 +32,132 @@ func (h *AuthHandler) Register(rw http.ResponseWriter, r *http.Request) {
 		Email        string `json:"email"`
 		ProfileImage string `json:"profile_image"`
 		Role         string `json:"role"`
+		Locale       string `json:"locale"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.logger.Printf("Register endpoint - invalid input")
-		http.Error(rw, "Invalid input", http.StatusBadRequest)
+	if err := decodeJSON(rw, r, &input); err != nil {
+		writeProblem(rw, r, h.logger, err)
+		return
+	}
+
+	v := &validator{}
+	v.username("username", input.Username)
+	v.required("password", input.Password)
+	v.name("first_name", input.FirstName)
+	v.name("last_name", input.LastName)
+	v.email("email", input.Email)
+	v.optionalURL("profile_image", input.ProfileImage)
+	v.oneOf("role", strings.ToLower(input.Role), "author", "tourist")
+	v.length("locale", input.Locale, 0, 35)
+	if err := v.err(); err != nil {
+		writeProblem(rw, r, h.logger, err)
 		return
 	}
 
 	user := &model.User{
 		Username: input.Username,
+		Role:     model.RoleTourist,
 	}
-	if input.Role == "Author" || input.Role == "author" {
+	if strings.ToLower(input.Role) == "author" {
 		user.Role = model.RoleAuthor
-	} else if input.Role == "Tourist" || input.Role == "tourist" {
-		user.Role = model.RoleTourist
-	} else {
-		h.logger.Printf("Register endpoint - invalid ROLE input")
-		http.Error(rw, "Invalid role input", http.StatusBadRequest)
-		return
 	}
 
 	person := &model.Person{
-		FirstName:    input.FirstName,
-		LastName:     input.LastName,
+		FirstName:    strings.TrimSpace(input.FirstName),
+		LastName:     strings.TrimSpace(input.LastName),
 		Email:        input.Email,
 		ProfileImage: input.ProfileImage,
+		Locale:       h.authService.EmailClient.ResolveLocale(input.Locale, r.Header.Get("Accept-Language")),
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	token, err := h.authService.Register(ctx, user, person, input.Password)
-
-	if err == repository.ErrDuplicateUser {
-		h.logger.Printf("Register endpoint - username/email already exists")
-		http.Error(rw, "Username or email already exists", http.StatusConflict)
-		return
-	}
 	if err != nil {
-		h.logger.Printf("Register endpoint - Failed to register")
-		http.Error(rw, "Failed to register", http.StatusInternalServerError)
+		h.logger.Printf("Register endpoint - failed to register %s: %v", input.Username, err)
+		writeProblem(rw, r, h.logger, err)
 		return
 	}
 
 	// Send email
 	go func() {
-		emailCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		emailCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
 		defer cancel()
-		if err := h.authService.EmailClient.SendVerificationEmail(emailCtx, person.Email, user.ID.Hex(), token); err != nil {
+		if err := h.authService.EmailClient.SendVerificationEmail(emailCtx, person.Email, person.Locale, user.Username, user.ID.Hex(), token); err != nil {
 			h.logger.Printf("Async email send failed to %s: %v", person.Email, err)
 		}
 	}()
 
-	rw.Header().Set("Content-Type", "application/json")
-	rw.WriteHeader(http.StatusCreated)
-	json.NewEncoder(rw).Encode(map[string]string{"message": "User registered, please verify email"})
+	writeJSON(rw, h.logger, http.StatusCreated, map[string]string{"message": "User registered, please verify email"})
+}
+
+// VerifyEmail is the target of the link in the verification email.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeProblem(w, r, h.logger, fieldError("token", CodeRequired, "is required"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
+	if err := h.authService.VerifyEmail(ctx, token); err != nil {
+		h.logger.Printf("Verify endpoint - failed: %v", err)
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.writeResponse(w, http.StatusOK, map[string]string{"message": "email verified"})
+}
+
+// SecureAccount acts on the token of a "this wasn't me" link. It takes JSON
+// or the form of SecureAccountPage, which gets an HTML page back.
+func (h *AuthHandler) SecureAccount(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	fromPage := strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+	if fromPage {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+		if err := r.ParseForm(); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				err = errBodyTooLarge
+			} else {
+				err = fieldError("token", CodeRequired, "is required")
+			}
+			h.secureAccountPageError(w, err)
+			return
+		}
+		input.Token = r.PostForm.Get("token")
+	} else if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	var err error
+	if input.Token == "" {
+		err = fieldError("token", CodeRequired, "is required")
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		err = h.authService.SecureAccount(ctx, input.Token)
+		if err != nil {
+			h.logger.Printf("Secure account endpoint - failed: %v", err)
+		}
+	}
+
+	switch {
+	case fromPage && err != nil:
+		h.secureAccountPageError(w, err)
+	case fromPage:
+		h.renderSecureAccountPage(w, http.StatusOK, secureAccountPageData{Done: true})
+	case err != nil:
+		writeProblem(w, r, h.logger, err)
+	default:
+		h.writeResponse(w, http.StatusOK, map[string]string{"message": "all sessions ended, check your email to set a new password"})
+	}
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -95,79 +165,230 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.logger.Printf("Login endpoint - invalid input")
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	// Only presence and size are checked, accounts created before the
+	// username rules existed must still be able to log in.
+	v := &validator{}
+	if v.required("username", input.Username) {
+		v.length("username", input.Username, 1, 256)
+	}
+	if v.required("password", input.Password) {
+		v.length("password", input.Password, 1, 1024)
+	}
+	if err := v.err(); err != nil {
+		writeProblem(w, r, h.logger, err)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	token, userId, err := h.authService.Login(ctx, input.Username, input.Password)
-	if err == repository.ErrUserNotFound || err == repository.ErrInvalidCredentials {
-		h.logger.Printf("Login endpoint - invalid credentials")
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	tokens, err := h.authService.Login(ctx, input.Username, input.Password, ClientIP(r))
+	if err != nil {
+		h.logger.Printf("Login endpoint - login failed for %s: %v", input.Username, err)
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.writeTokens(w, tokens, h.cookies.Enabled)
+}
+
+// Refresh trades a refresh token for a new access and refresh token. The old
+// refresh token stops working. In cookie mode a request without a body uses
+// the refresh token cookie and gets the new tokens as cookies. It needs no
+// CSRF token: a forged request would only rotate cookies the attacker can't
+// read.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	fromCookie := false
+	if cookie, err := r.Cookie(refreshTokenCookie); err == nil && h.cookies.Enabled && r.ContentLength == 0 {
+		input.RefreshToken, fromCookie = cookie.Value, true
+	} else if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.logger, err)
 		return
 	}
-	if err == repository.ErrUserNotActive {
-		h.logger.Printf("Login endpoint - account not verified")
-		http.Error(w, "Account not verified", http.StatusForbidden)
+	v := &validator{}
+	if v.required("refresh_token", input.RefreshToken) {
+		v.length("refresh_token", input.RefreshToken, 1, 256)
+	}
+	if err := v.err(); err != nil {
+		writeProblem(w, r, h.logger, err)
 		return
 	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tokens, err := h.authService.Refresh(ctx, input.RefreshToken)
 	if err != nil {
-		h.logger.Printf("Login endpoint - failed to login %v", err)
-		http.Error(w, "Failed to login", http.StatusInternalServerError)
+		h.logger.Printf("Refresh endpoint - failed: %v", err)
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.writeTokens(w, tokens, fromCookie)
+}
+
+// Logout ends the current session and clears the cookies of cookie mode.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if err := h.authService.Sessions.Revoke(ctx, user.ID, user.SessionID); err != nil {
+		writeProblem(w, r, h.logger, err)
 		return
 	}
+	if h.cookies.Enabled {
+		h.cookies.clear(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
+// writeTokens puts the tokens in the response body or, with asCookies, sets
+// them as cookies and only returns the CSRF token.
+func (h *AuthHandler) writeTokens(w http.ResponseWriter, tokens *service.Tokens, asCookies bool) {
 	response := struct {
-		ID          string `json:"id"`
-		AccessToken string `json:"accessToken"`
+		ID           string `json:"id"`
+		SessionID    string `json:"sessionId"`
+		AccessToken  string `json:"accessToken,omitempty"`
+		RefreshToken string `json:"refreshToken,omitempty"`
+		CSRFToken    string `json:"csrfToken,omitempty"`
 	}{
-		ID:          userId,
-		AccessToken: token,
+		ID:        tokens.UserID,
+		SessionID: tokens.SessionID,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if asCookies {
+		h.cookies.setTokens(w, tokens)
+		response.CSRFToken = tokens.CSRFToken
+	} else {
+		response.AccessToken = tokens.AccessToken
+		response.RefreshToken = tokens.RefreshToken
+	}
+	writeJSON(w, h.logger, http.StatusOK, response)
 }
 
 func (h *AuthHandler) ValidateJWT(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		h.writeResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		writeProblemStatus(w, r, h.logger, errMethodNotAllowed, http.StatusMethodNotAllowed)
 		return
 	}
 
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		h.logger.Printf("missing Authorization header")
-		h.writeResponse(w, http.StatusUnauthorized, map[string]string{"error": "missing Authorization header"})
+	token, _ := h.accessToken(r)
+	if token == "" {
+		h.logger.Printf("missing or invalid Authorization header")
+		writeProblem(w, r, h.logger, errMissingToken)
 		return
 	}
 
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		h.logger.Printf("invalid Authorization format")
-		h.writeResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid Authorization format"})
-		return
-	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-	userID, username, role, err := h.authService.ValidateJWT(parts[1])
+	claims, err := h.authService.ValidateJWT(ctx, token)
 	if err != nil {
 		h.logger.Printf("JWT validation failed: %v", err)
-		h.writeResponse(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		writeProblem(w, r, h.logger, err)
 		return
 	}
 
 	response := map[string]string{
-		"userID":   userID,
-		"username": username,
-		"role":     role,
+		"userID":    claims.UserID,
+		"username":  claims.Username,
+		"role":      claims.Role,
+		"sessionID": claims.SessionID,
 	}
 	h.writeResponse(w, http.StatusOK, response)
 }
 
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.authService.ChangePassword(ctx, CurrentUser(r).ID, input.CurrentPassword, input.NewPassword)
+	if err != nil {
+		h.logger.Printf("Change password endpoint - failed: %v", err)
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.writeResponse(w, http.StatusOK, map[string]string{"message": "password changed"})
+}
+
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	v := &validator{}
+	v.email("email", input.Email)
+	if err := v.err(); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.authService.RequestPasswordReset(ctx, input.Email); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	// Same answer whether or not the address is known.
+	h.writeResponse(w, http.StatusAccepted, map[string]string{"message": "if the address is registered, a reset link has been sent"})
+}
+
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.authService.ResetPassword(ctx, input.Token, input.NewPassword)
+	if err != nil {
+		h.logger.Printf("Reset password endpoint - failed: %v", err)
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.writeResponse(w, http.StatusOK, map[string]string{"message": "password reset"})
+}
+
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.authService.UnlockAccount(ctx, id); err != nil {
+		h.logger.Printf("Unlock endpoint - failed to unlock %s: %v", id, err)
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	h.logger.Printf("Account %s unlocked by %s", id, CurrentUser(r).Username)
+	h.writeResponse(w, http.StatusOK, map[string]string{"message": "account unlocked"})
+}
+
 func (a *AuthHandler) MiddlewareContentTypeSet(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, h *http.Request) {
 		a.logger.Println("Method [", h.Method, "] - Hit path :", h.URL.Path)
@@ -179,9 +400,5 @@ func (a *AuthHandler) MiddlewareContentTypeSet(next http.Handler) http.Handler {
 }
 
 func (h *AuthHandler) writeResponse(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		h.logger.Printf("Failed to write response: %v", err)
-	}
+	writeJSON(w, h.logger, status, data)
 }
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/service"
+	"github.com/gorilla/mux"
+)
+
+type currentUserKey struct{}
+
+// AuthenticatedUser holds the claims of the access token that authorized the request.
+type AuthenticatedUser struct {
+	ID        string
+	Username  string
+	Role      model.UserRole
+	SessionID string
+}
+
+// CurrentUser returns the user set by MiddlewareRequireRole, or an empty value.
+func CurrentUser(r *http.Request) AuthenticatedUser {
+	user, _ := r.Context().Value(currentUserKey{}).(AuthenticatedUser)
+	return user
+}
+
+// MiddlewareRequireRole rejects requests without a valid access token, taken
+// from the Authorization header or, in cookie mode, the access token cookie.
+// Cookie authenticated requests that may change state also need the CSRF
+// token. When roles are given the token's role has to be one of them.
+func (h *AuthHandler) MiddlewareRequireRole(roles ...model.UserRole) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, fromCookie := h.accessToken(r)
+			if token == "" {
+				writeProblem(w, r, h.logger, errMissingToken)
+				return
+			}
+
+			claims, err := h.authService.ValidateJWT(r.Context(), token)
+			if err != nil {
+				h.logger.Printf("JWT validation failed: %v", err)
+				writeProblem(w, r, h.logger, err)
+				return
+			}
+			if fromCookie && needsCSRFCheck(r.Method) && !h.authService.ValidCSRFToken(claims.SessionID, r.Header.Get(csrfTokenHeader)) {
+				writeProblem(w, r, h.logger, errInvalidCSRFToken)
+				return
+			}
+			if len(roles) > 0 && !slices.Contains(roles, model.UserRole(claims.Role)) {
+				writeProblem(w, r, h.logger, errForbidden)
+				return
+			}
+
+			user := AuthenticatedUser{
+				ID:        claims.UserID,
+				Username:  claims.Username,
+				Role:      model.UserRole(claims.Role),
+				SessionID: claims.SessionID,
+			}
+			// Requests of these routes come from the user, unlike the
+			// validations of /api/auth/jwt backends make for them.
+			h.authService.Sessions.Touch(r.Context(), claims.SessionID)
+			ctx := context.WithValue(r.Context(), currentUserKey{}, user)
+			ctx = service.WithActor(ctx, claims.UserID, claims.Username)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
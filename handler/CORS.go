@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is the cross-origin policy for browser clients. Origins are
+// exact ("https://app.example.com"), wildcard subdomains
+// ("https://*.example.com") or "*" for any origin.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders: []string{"Authorization", "Content-Type", csrfTokenHeader, "X-Request-ID"},
+		ExposedHeaders: []string{"X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Content-Disposition"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+type CORS struct {
+	config    CORSConfig
+	anyOrigin bool
+	origins   map[string]bool
+	// wildcards hold scheme and host suffix, e.g. "https" and ".example.com".
+	wildcards [][2]string
+	methods   string
+	headers   string
+	exposed   string
+}
+
+func NewCORS(config CORSConfig) (*CORS, error) {
+	c := &CORS{
+		config:  config,
+		origins: map[string]bool{},
+		methods: strings.Join(config.AllowedMethods, ", "),
+		headers: strings.Join(config.AllowedHeaders, ", "),
+		exposed: strings.Join(config.ExposedHeaders, ", "),
+	}
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			if config.AllowCredentials {
+				return nil, fmt.Errorf("CORS origin * can't be combined with credentials")
+			}
+			c.anyOrigin = true
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+			return nil, fmt.Errorf("invalid CORS origin %q", origin)
+		}
+		if suffix, ok := strings.CutPrefix(parsed.Host, "*."); ok {
+			if suffix == "" || strings.Contains(suffix, "*") {
+				return nil, fmt.Errorf("invalid CORS origin %q", origin)
+			}
+			c.wildcards = append(c.wildcards, [2]string{parsed.Scheme, "." + suffix})
+			continue
+		}
+		if strings.Contains(parsed.Host, "*") {
+			return nil, fmt.Errorf("invalid CORS origin %q", origin)
+		}
+		c.origins[parsed.Scheme+"://"+parsed.Host] = true
+	}
+	return c, nil
+}
+
+func (c *CORS) allowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if c.origins[origin] {
+		return true
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok {
+		return false
+	}
+	for _, wildcard := range c.wildcards {
+		if scheme == wildcard[0] && strings.HasSuffix(host, wildcard[1]) && len(host) > len(wildcard[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler wraps the whole router: preflight requests are answered here, as
+// the routes only match the methods they serve and would reject OPTIONS.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			if c.allowed(origin) && c.preflightAllowed(r) {
+				c.setOrigin(header, origin)
+				header.Set("Access-Control-Allow-Methods", c.methods)
+				if c.headers != "" {
+					header.Set("Access-Control-Allow-Headers", c.headers)
+				}
+				if c.config.MaxAge > 0 {
+					header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.config.MaxAge.Seconds())))
+				}
+			}
+			// Without the allow headers the browser blocks the actual request.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if c.allowed(origin) {
+			c.setOrigin(header, origin)
+			if c.exposed != "" {
+				header.Set("Access-Control-Expose-Headers", c.exposed)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CORS) setOrigin(header http.Header, origin string) {
+	if c.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if c.config.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *CORS) preflightAllowed(r *http.Request) bool {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !slices.Contains(c.config.AllowedMethods, method) {
+		return false
+	}
+	for _, requested := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		requested = strings.TrimSpace(requested)
+		if requested == "" {
+			continue
+		}
+		if !slices.ContainsFunc(c.config.AllowedHeaders, func(allowed string) bool {
+			return strings.EqualFold(allowed, requested)
+		}) {
+			return false
+		}
+	}
+	return true
+}
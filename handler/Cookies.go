@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/service"
+)
+
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+	csrfTokenCookie    = "csrf_token"
+	csrfTokenHeader    = "X-CSRF-Token"
+	// The refresh token is only sent to the endpoint that uses it.
+	refreshTokenCookiePath = "/api/auth/refresh"
+)
+
+// CookieConfig configures cookie mode for browser clients. When enabled,
+// login and refresh hand out the tokens as HttpOnly cookies instead of in the
+// response body, so scripts on the page can't read them.
+type CookieConfig struct {
+	Enabled  bool
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func (c CookieConfig) cookie(name, value, path string, expires time.Time, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+	if expires.IsZero() {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = expires.UTC()
+		cookie.MaxAge = max(int(time.Until(expires).Seconds()), 1)
+	}
+	return cookie
+}
+
+// setTokens sets the access and refresh token cookies. The CSRF token cookie
+// is readable by scripts, which echo it in the X-CSRF-Token header.
+func (c CookieConfig) setTokens(w http.ResponseWriter, tokens *service.Tokens) {
+	http.SetCookie(w, c.cookie(accessTokenCookie, tokens.AccessToken, "/", tokens.AccessExpiresAt, true))
+	http.SetCookie(w, c.cookie(refreshTokenCookie, tokens.RefreshToken, refreshTokenCookiePath, tokens.RefreshExpiresAt, true))
+	http.SetCookie(w, c.cookie(csrfTokenCookie, tokens.CSRFToken, "/", tokens.RefreshExpiresAt, false))
+}
+
+func (c CookieConfig) clear(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie(accessTokenCookie, "", "/", time.Time{}, true))
+	http.SetCookie(w, c.cookie(refreshTokenCookie, "", refreshTokenCookiePath, time.Time{}, true))
+	http.SetCookie(w, c.cookie(csrfTokenCookie, "", "/", time.Time{}, false))
+}
+
+// accessToken returns the bearer token of the Authorization header or, in
+// cookie mode and without that header, the access token cookie.
+func (h *AuthHandler) accessToken(r *http.Request) (token string, fromCookie bool) {
+	if header := r.Header.Get("Authorization"); header != "" || !h.cookies.Enabled {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || strings.Contains(token, " ") {
+			return "", false
+		}
+		return token, false
+	}
+	cookie, err := r.Cookie(accessTokenCookie)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// needsCSRFCheck reports whether a request authenticated by cookie has to
+// carry the CSRF token. Browsers attach cookies to cross-site requests too,
+// so anything that may change state must prove it came from our frontend.
+func needsCSRFCheck(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+)
+
+const problemTypePrefix = "urn:auth-service:problem:"
+
+// Problem is an RFC 7807 problem details object. Code repeats the last part of
+// Type so clients can switch on it directly.
+type Problem struct {
+	Type      string             `json:"type"`
+	Title     string             `json:"title"`
+	Status    int                `json:"status"`
+	Detail    string             `json:"detail,omitempty"`
+	Instance  string             `json:"instance,omitempty"`
+	Code      string             `json:"code"`
+	RequestID string             `json:"request_id,omitempty"`
+	Errors    []model.FieldError `json:"errors,omitempty"`
+}
+
+var (
+	errInternal         = apperror.New(apperror.KindInternal, "internal", "an unexpected error occurred")
+	errRouteNotFound    = apperror.New(apperror.KindNotFound, "route.not_found", "no such endpoint")
+	errMethodNotAllowed = apperror.New(apperror.KindInvalid, "route.method_not_allowed", "method not allowed")
+	errMissingToken     = apperror.New(apperror.KindUnauthenticated, "auth.token_missing", "missing or invalid Authorization header")
+	errForbidden        = apperror.New(apperror.KindForbidden, "auth.forbidden", "not allowed to access this resource")
+	errInvalidCSRFToken = apperror.New(apperror.KindForbidden, "auth.csrf_invalid", "missing or invalid CSRF token")
+	errBodyTooLarge     = apperror.New(apperror.KindTooLarge, "request.body_too_large", "request body too large")
+	errRateLimited      = apperror.New(apperror.KindTooManyRequests, "rate_limit.exceeded", "too many requests")
+)
+
+func statusOf(kind apperror.Kind) int {
+	switch kind {
+	case apperror.KindInvalid:
+		return http.StatusBadRequest
+	case apperror.KindUnauthenticated:
+		return http.StatusUnauthorized
+	case apperror.KindForbidden:
+		return http.StatusForbidden
+	case apperror.KindNotFound:
+		return http.StatusNotFound
+	case apperror.KindConflict:
+		return http.StatusConflict
+	case apperror.KindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case apperror.KindLocked:
+		return http.StatusLocked
+	case apperror.KindTooManyRequests:
+		return http.StatusTooManyRequests
+	case apperror.KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeProblem answers err as application/problem+json. Errors that are not
+// an *apperror.Error are reported as internal errors without details.
+func writeProblem(w http.ResponseWriter, r *http.Request, logger *log.Logger, err error) {
+	writeProblemStatus(w, r, logger, err, 0)
+}
+
+// writeProblemStatus is writeProblem with an explicit status, for the few
+// protocol level errors that have no domain kind. Zero derives it from err.
+func writeProblemStatus(w http.ResponseWriter, r *http.Request, logger *log.Logger, err error, status int) {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		appErr = errInternal
+	}
+	if status == 0 {
+		status = statusOf(appErr.Kind)
+	}
+	if status >= http.StatusInternalServerError {
+		logger.Printf("[%s] %s %s failed: %v", RequestID(r), r.Method, r.URL.Path, err)
+	}
+
+	if appErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(appErr.RetryAfter)))
+	}
+	if appErr.Kind == apperror.KindUnauthenticated {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	problem := Problem{
+		Type:      problemTypePrefix + appErr.Code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    appErr.Message,
+		Instance:  r.URL.Path,
+		Code:      appErr.Code,
+		RequestID: RequestID(r),
+		Errors:    appErr.Fields,
+	}
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		logger.Printf("Failed to write problem response: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, logger *log.Logger, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Printf("Failed to write response: %v", err)
+	}
+}
+
+func NotFoundHandler(logger *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, logger, errRouteNotFound)
+	})
+}
+
+func MethodNotAllowedHandler(logger *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProblemStatus(w, r, logger, errMethodNotAllowed, http.StatusMethodNotAllowed)
+	})
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/ratelimit"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/gorilla/mux"
+)
+
+const rateLimitPeekLimit = 1 << 20
+
+type RateLimiter struct {
+	store    ratelimit.Store
+	policies map[string][]ratelimit.Policy
+	logger   *log.Logger
+}
+
+func NewRateLimiter(store ratelimit.Store, policies []ratelimit.Policy, logger *log.Logger) *RateLimiter {
+	byRoute := map[string][]ratelimit.Policy{}
+	for _, policy := range policies {
+		byRoute[policy.Route] = append(byRoute[policy.Route], policy)
+	}
+	return &RateLimiter{store: store, policies: byRoute, logger: logger}
+}
+
+// Limit returns a middleware enforcing all policies configured for route. The
+// RateLimit-* headers describe the most restrictive of them.
+func (l *RateLimiter) Limit(route string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		policies := l.policies[route]
+		if len(policies) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			var body map[string]any
+			var tightest *ratelimit.Result
+			var tightestPolicy ratelimit.Policy
+
+			for _, policy := range policies {
+				key := l.key(r, policy.KeyBy, &body)
+				result, err := l.store.Take(r.Context(), route+":"+policy.KeyBy+":"+key, policy, now)
+				if err != nil {
+					// Fail open: an unavailable store must not take the endpoint down.
+					l.logger.Printf("Rate limit store error on %s: %v", route, err)
+					continue
+				}
+				if tightest == nil || tighter(result, *tightest) {
+					tightest, tightestPolicy = &result, policy
+				}
+			}
+
+			if tightest == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(tightestPolicy.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.ResetAfter)))
+			w.Header().Set("RateLimit-Policy", strconv.Itoa(tightestPolicy.Burst)+";w="+strconv.Itoa(ceilSeconds(tightestPolicy.Period)))
+
+			if !tightest.Allowed {
+				l.logger.Printf("Rate limit exceeded on %s by %s", route, ClientIP(r))
+				writeProblem(w, r, l.logger, errRateLimited.WithRetryAfter(tightest.RetryAfter))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// key extracts the bucket key for a policy. Requests without the username or
+// client_id fall back to the client IP.
+func (l *RateLimiter) key(r *http.Request, keyBy string, body *map[string]any) string {
+	switch keyBy {
+	case ratelimit.ByClientID:
+		if clientID := r.Header.Get("X-Client-ID"); clientID != "" {
+			return clientID
+		}
+		if clientID, ok := peekBodyField(r, body, "client_id"); ok {
+			return clientID
+		}
+	case ratelimit.ByUsername:
+		if username, ok := peekBodyField(r, body, "username"); ok {
+			// "Alice" and "alice" are the same account and share a bucket.
+			if canonical, err := repository.CanonicalUsername(username); err == nil {
+				return canonical
+			}
+			return username
+		}
+	}
+	return "ip=" + ClientIP(r)
+}
+
+// peekBodyField reads a string field from a JSON body without consuming it for
+// the next handler. The decoded body is cached in *body.
+func peekBodyField(r *http.Request, body *map[string]any, field string) (string, bool) {
+	if *body == nil {
+		*body = map[string]any{}
+		if r.Body != nil {
+			data, err := io.ReadAll(io.LimitReader(r.Body, rateLimitPeekLimit))
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+			if err == nil {
+				json.Unmarshal(data, body)
+			}
+		}
+	}
+	value, ok := (*body)[field].(string)
+	return value, ok && value != ""
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func tighter(a, b ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
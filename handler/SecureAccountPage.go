@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+)
+
+// secureAccountPage is what the "this wasn't me" link of a new device alert
+// opens. The link only shows a form, as mail scanners and link previews open
+// links on their own; securing the account takes the POST the form sends.
+var secureAccountPage = template.Must(template.New("secure-account").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Secure your account</title>
+</head>
+<body>
+{{if .Done}}
+<h1>Your account is secured</h1>
+<p>All sessions were ended. Check your email for a link to set a new password.</p>
+{{else if .Error}}
+<h1>Your account could not be secured</h1>
+<p>{{.Error}}</p>
+{{else}}
+<h1>Secure your account</h1>
+<p>If you didn't sign in from the new device, secure your account: all sessions are ended, the password is replaced and we email you a link to set a new one.</p>
+<form method="post" action="/api/auth/secure-account">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Secure my account</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type secureAccountPageData struct {
+	Token string
+	Done  bool
+	Error string
+}
+
+func (h *AuthHandler) renderSecureAccountPage(w http.ResponseWriter, status int, data secureAccountPageData) {
+	header := w.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	// The token is in the URL, it must not leak to other sites.
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("Content-Security-Policy", "default-src 'none'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := secureAccountPage.Execute(w, data); err != nil {
+		h.logger.Printf("Failed to render secure account page: %v", err)
+	}
+}
+
+// SecureAccountPage asks for confirmation before SecureAccount acts on the
+// token. It doesn't check or use the token.
+func (h *AuthHandler) SecureAccountPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		h.renderSecureAccountPage(w, http.StatusBadRequest, secureAccountPageData{Error: "The link is incomplete, open it from the email again."})
+		return
+	}
+	h.renderSecureAccountPage(w, http.StatusOK, secureAccountPageData{Token: token})
+}
+
+// secureAccountPageError renders a failure of SecureAccount for the form.
+func (h *AuthHandler) secureAccountPageError(w http.ResponseWriter, err error) {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		appErr = errInternal
+	}
+	message := appErr.Message
+	if appErr.Kind == apperror.KindInternal {
+		message = "Something went wrong, please try again later."
+	}
+	h.renderSecureAccountPage(w, statusOf(appErr.Kind), secureAccountPageData{Error: message})
+}
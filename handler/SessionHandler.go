@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/service"
+	"github.com/gorilla/mux"
+)
+
+// SessionHandler lets users see and end their own sessions.
+type SessionHandler struct {
+	logger         *log.Logger
+	sessionService *service.SessionService
+}
+
+func NewSessionHandler(sessionService *service.SessionService, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService, logger: logger}
+}
+
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sessions, err := h.sessionService.List(ctx, user.ID, user.SessionID)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	writeJSON(w, h.logger, http.StatusOK, model.PagedResult[model.Session]{Results: sessions, TotalCount: len(sessions)})
+}
+
+// Revoke ends one session, which may be the caller's own.
+func (h *SessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.sessionService.Revoke(ctx, user.ID, id); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.logger.Printf("Session %s of %s revoked", id, user.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOthers ends every session of the caller except the current one.
+func (h *SessionHandler) RevokeOthers(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	revoked, err := h.sessionService.RevokeOthers(ctx, user.ID, user.SessionID)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.logger.Printf("%d other session(s) of %s revoked", revoked, user.Username)
+	writeJSON(w, h.logger, http.StatusOK, map[string]int64{"revoked": revoked})
+}
@@ -2,7 +2,7 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -13,6 +13,9 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// maxBatchIDs caps the IDs of one batch lookup.
+const maxBatchIDs = 100
+
 type UserHandler struct {
 	Logger      *log.Logger
 	UserService *service.UserService
@@ -29,7 +32,7 @@ func (h *UserHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 
 	users, err := h.UserService.GetAll(ctx)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeProblem(w, r, h.Logger, err)
 		return
 	}
 
@@ -37,17 +40,15 @@ func (h *UserHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	result.Results = users
 	result.TotalCount = len(users)
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	writeJSON(w, h.Logger, http.StatusOK, result)
 }
 
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
 	if !ok || id == "" {
-		w.WriteHeader(http.StatusNotFound)
 		h.Logger.Printf("No id provided")
+		writeProblem(w, r, h.Logger, service.ErrInvalidUserID)
 		return
 	}
 
@@ -56,35 +57,33 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.UserService.GetUser(ctx, id)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeProblem(w, r, h.Logger, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, h.Logger, http.StatusOK, user)
 }
 
+// GetUsernames is deprecated in favour of LookupUsers.
 func (h *UserHandler) GetUsernames(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", `</api/user/batch>; rel="successor-version"`)
+
 	vars := mux.Vars(r)
 	ids, ok := vars["ids"]
 	if !ok || ids == "" {
-		w.WriteHeader(http.StatusBadRequest)
+		writeProblem(w, r, h.Logger, service.ErrInvalidUserID)
 		return
 	}
 
 	idList := strings.Split(ids, ",")
-	if len(idList) == 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	users, err := h.UserService.GetUsernames(ctx, idList)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeProblem(w, r, h.Logger, err)
 		return
 	}
 
@@ -92,7 +91,136 @@ func (h *UserHandler) GetUsernames(w http.ResponseWriter, r *http.Request) {
 	result.Results = users
 	result.TotalCount = len(users)
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	writeJSON(w, h.Logger, http.StatusOK, result)
+}
+
+func (h *UserHandler) LookupUsers(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs    []string `json:"ids"`
+		Fields []string `json:"fields"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+
+	v := &validator{}
+	switch {
+	case len(input.IDs) == 0:
+		v.add("ids", CodeRequired, "is required")
+	case len(input.IDs) > maxBatchIDs:
+		v.add("ids", CodeTooLong, fmt.Sprintf("must contain at most %d IDs", maxBatchIDs))
+	}
+	for i, field := range input.Fields {
+		v.oneOf(fmt.Sprintf("fields[%d]", i), field, service.LookupFields...)
+	}
+	if err := v.err(); err != nil {
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	batch, err := h.UserService.LookupUsers(ctx, input.IDs, input.Fields)
+	if err != nil {
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+	writeJSON(w, h.Logger, http.StatusOK, batch)
+}
+
+func (h *UserHandler) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+	v := &validator{}
+	if v.required("role", input.Role) {
+		v.oneOf("role", input.Role, string(model.RoleAdmin), string(model.RoleAuthor), string(model.RoleTourist))
+	}
+	if err := v.err(); err != nil {
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.UserService.ChangeRole(ctx, id, model.UserRole(input.Role))
+	if err != nil {
+		h.Logger.Printf("Change role endpoint - failed for %s: %v", id, err)
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+	h.Logger.Printf("Role of %s set to %s by %s", id, input.Role, CurrentUser(r).Username)
+	writeJSON(w, h.Logger, http.StatusOK, user)
+}
+
+func (h *UserHandler) Deactivate(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.UserService.Deactivate(ctx, id); err != nil {
+		h.Logger.Printf("Deactivate endpoint - failed for %s: %v", id, err)
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+	h.Logger.Printf("Account %s deactivated by %s", id, CurrentUser(r).Username)
+	writeJSON(w, h.Logger, http.StatusOK, map[string]string{"message": "account deactivated"})
+}
+
+// UpdateProfile changes the caller's own profile. Fields left out of the
+// body are kept.
+func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FirstName    *string `json:"first_name"`
+		LastName     *string `json:"last_name"`
+		ProfileImage *string `json:"profile_image"`
+		Locale       *string `json:"locale"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+
+	v := &validator{}
+	update := service.ProfileUpdate{ProfileImage: input.ProfileImage, Locale: input.Locale}
+	if input.FirstName != nil {
+		v.name("first_name", *input.FirstName)
+		firstName := strings.TrimSpace(*input.FirstName)
+		update.FirstName = &firstName
+	}
+	if input.LastName != nil {
+		v.name("last_name", *input.LastName)
+		lastName := strings.TrimSpace(*input.LastName)
+		update.LastName = &lastName
+	}
+	if input.ProfileImage != nil {
+		v.optionalURL("profile_image", *input.ProfileImage)
+	}
+	if input.Locale != nil {
+		v.length("locale", *input.Locale, 0, 35)
+	}
+	if err := v.err(); err != nil {
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	person, err := h.UserService.UpdateProfile(ctx, CurrentUser(r).ID, update)
+	if err != nil {
+		h.Logger.Printf("Update profile endpoint - failed: %v", err)
+		writeProblem(w, r, h.Logger, err)
+		return
+	}
+	writeJSON(w, h.Logger, http.StatusOK, person)
 }
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+)
+
+const maxRequestBodyBytes = 64 << 10
+
+const (
+	CodeRequired      = "required"
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeInvalidFormat = "invalid_format"
+	CodeInvalidChoice = "invalid_choice"
+	CodeInvalidType   = "invalid_type"
+	CodeUnknownField  = "unknown_field"
+	CodeMalformedJSON = "malformed_json"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// decodeJSON strictly decodes the request body into dst: unknown fields,
+// trailing data and bodies over maxRequestBodyBytes are rejected. Decoding
+// problems are returned as a validation error or errBodyTooLarge.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil {
+		if _, extra := decoder.Token(); extra != io.EOF {
+			err = errors.New("body must contain a single JSON object")
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return errBodyTooLarge
+	case errors.As(err, &typeErr):
+		return fieldError(typeErr.Field, CodeInvalidType, fmt.Sprintf("must be of type %s", typeErr.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return fieldError(field, CodeUnknownField, "unknown field")
+	default:
+		return fieldError("", CodeMalformedJSON, "malformed JSON body")
+	}
+}
+
+func fieldError(field, code, message string) error {
+	return apperror.Validation(model.FieldError{Field: field, Code: code, Message: message})
+}
+
+// validator collects field errors so a client gets all problems at once.
+type validator struct {
+	errors []model.FieldError
+}
+
+func (v *validator) add(field, code, message string) {
+	v.errors = append(v.errors, model.FieldError{Field: field, Code: code, Message: message})
+}
+
+func (v *validator) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, CodeRequired, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) length(field, value string, min, max int) {
+	n := utf8.RuneCountInString(value)
+	if n < min {
+		v.add(field, CodeTooShort, fmt.Sprintf("must be at least %d characters long", min))
+	} else if n > max {
+		v.add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters long", max))
+	}
+}
+
+func (v *validator) username(field, value string) {
+	if !v.required(field, value) {
+		return
+	}
+	v.length(field, value, 3, 32)
+	if !usernamePattern.MatchString(value) {
+		v.add(field, CodeInvalidFormat, "may only contain letters, digits, '.', '_' and '-' and must start with a letter or digit")
+	}
+}
+
+// email accepts a bare RFC 5322 addr-spec, display names and comments are rejected.
+func (v *validator) email(field, value string) {
+	if !v.required(field, value) {
+		return
+	}
+	if len(value) > 254 {
+		v.add(field, CodeTooLong, "must be at most 254 characters long")
+		return
+	}
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value || address.Name != "" {
+		v.add(field, CodeInvalidFormat, "must be a valid email address")
+		return
+	}
+	if _, domain, _ := strings.Cut(value, "@"); !strings.Contains(domain, ".") {
+		v.add(field, CodeInvalidFormat, "must be a valid email address")
+	}
+}
+
+func (v *validator) name(field, value string) {
+	if !v.required(field, value) {
+		return
+	}
+	v.length(field, strings.TrimSpace(value), 1, 64)
+}
+
+// optionalURL accepts an empty value or an absolute http(s) URL.
+func (v *validator) optionalURL(field, value string) {
+	if value == "" {
+		return
+	}
+	if len(value) > 2048 {
+		v.add(field, CodeTooLong, "must be at most 2048 characters long")
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.User != nil {
+		v.add(field, CodeInvalidFormat, "must be an absolute http or https URL")
+	}
+}
+
+func (v *validator) oneOf(field, value string, choices ...string) {
+	for _, choice := range choices {
+		if value == choice {
+			return
+		}
+	}
+	v.add(field, CodeInvalidChoice, "must be one of "+strings.Join(choices, ", "))
+}
+
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return apperror.Validation(v.errors...)
+}
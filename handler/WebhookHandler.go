@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+type WebhookHandler struct {
+	logger         *log.Logger
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService, logger *log.Logger) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService, logger: logger}
+}
+
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	v := &validator{}
+	if v.required("url", input.URL) {
+		v.optionalURL("url", input.URL)
+	}
+	if len(input.Events) == 0 {
+		v.add("events", CodeRequired, "is required")
+	}
+	for i, event := range input.Events {
+		v.oneOf(fmt.Sprintf("events[%d]", i), event, append([]string{"*"}, service.EventTypes...)...)
+	}
+	if input.Secret != "" {
+		v.length("secret", input.Secret, 16, 256)
+	}
+	if err := v.err(); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	webhook, err := h.webhookService.CreateWebhook(ctx, input.URL, input.Events, input.Secret)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.logger.Printf("Webhook %s for %s created by %s", webhook.ID.Hex(), webhook.URL, CurrentUser(r).Username)
+
+	// The secret is only returned here.
+	response := struct {
+		*model.Webhook
+		Secret string `json:"secret"`
+	}{webhook, webhook.Secret}
+	writeJSON(w, h.logger, http.StatusCreated, response)
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	webhooks, err := h.webhookService.ListWebhooks(ctx)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	writeJSON(w, h.logger, http.StatusOK, model.PagedResult[model.Webhook]{Results: webhooks, TotalCount: len(webhooks)})
+}
+
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	webhook, err := h.webhookService.GetWebhook(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	writeJSON(w, h.logger, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.webhookService.DeleteWebhook(ctx, id); err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.logger.Printf("Webhook %s deleted by %s", id, CurrentUser(r).Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries lists the most recent deliveries of a webhook, ?limit= caps
+// their number.
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeliveryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxDeliveryLimit {
+			writeProblem(w, r, h.logger, fieldError("limit", CodeInvalidFormat, fmt.Sprintf("must be a number between 1 and %d", maxDeliveryLimit)))
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deliveries, err := h.webhookService.Deliveries(ctx, mux.Vars(r)["id"], limit)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	writeJSON(w, h.logger, http.StatusOK, model.PagedResult[model.WebhookDelivery]{Results: deliveries, TotalCount: len(deliveries)})
+}
+
+func (h *WebhookHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	delivery, err := h.webhookService.ReplayDelivery(ctx, id)
+	if err != nil {
+		writeProblem(w, r, h.logger, err)
+		return
+	}
+	h.logger.Printf("Webhook delivery %s replayed by %s", id, CurrentUser(r).Username)
+	writeJSON(w, h.logger, http.StatusAccepted, delivery)
+}
@@ -2,99 +2,239 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
+	"github.com/MicroSOA-09/auth-service/config"
 	"github.com/MicroSOA-09/auth-service/handler"
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/outbox"
+	"github.com/MicroSOA-09/auth-service/ratelimit"
 	"github.com/MicroSOA-09/auth-service/repository"
 	"github.com/MicroSOA-09/auth-service/service"
+	"github.com/MicroSOA-09/auth-service/webhook"
 
-	// gorillaHandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 func main() {
 
-	// Load .env file
 	// Load .env file
 	err := godotenv.Load()
 	if err != nil {
-		fmt.Println("Warning: Could not load .env file, using defaults:", err)
+		fmt.Fprintln(os.Stderr, "Warning: Could not load .env file, using defaults:", err)
 	}
 
-	port := os.Getenv("PORT")
-	if len(port) == 0 {
-		port = "80"
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
 	}
-
-	timeoutContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
 
 	logger := log.New(os.Stdout, "[auth-handler] ", log.LstdFlags)
 	storeLogger := log.New(os.Stdout, "[user-repo] ", log.LstdFlags)
 
-	userRepo, err := repository.New(timeoutContext, storeLogger)
+	cfg, args, code := loadConfig(os.Args[0], os.Args[1:])
+	if cfg == nil {
+		os.Exit(code)
+	}
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "unknown command %q, want migrate or config\n", args[0])
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Fatalf("invalid configuration:\n%v", err)
+	}
+
+	shutdownTracing, err := setupTracing(cfg.Tracing)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	startupContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stores, err := openStores(startupContext, cfg.Store, storeLogger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer stores.users.Disconnect(context.Background())
+
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	emailTemplates, err := service.NewEmailTemplates(cfg.Mail.TemplateDir, cfg.Mail.DefaultLocale)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	emailClient := service.NewEmailClient(mailer, emailTemplates, cfg.Mail.From, cfg.Server.PublicBaseURL, logger)
+
+	loginGuard := service.NewLoginGuard(stores.loginAttempts, cfg.Lockout.Policy())
+
+	breachedPasswords, err := service.NewBreachedPasswords(cfg.Password.BreachedPasswordsFile)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	passwordPolicy := service.DefaultPasswordPolicy(breachedPasswords)
+	passwordPolicy.MinLength = cfg.Password.MinLength
+	passwordPolicy.MinScore = cfg.Password.MinScore
+
+	passwordHasher, err := service.NewPasswordHasher(cfg.Password.HasherConfig())
 	if err != nil {
 		logger.Fatal(err)
 	}
-	defer userRepo.Disconnect(timeoutContext)
 
-	jwt_secret := os.Getenv("JWT_SECRET")
-	mailUser := os.Getenv("MAIL_USER")
-	mailAppPassword := os.Getenv("MAIL_APP_PASSWORD")
-	if mailUser == "" || mailAppPassword == "" {
-		logger.Fatal("MAIL_USER and MAIL_APP_PASSWORD are required")
+	auditor := service.NewAuditor(stores.audit, log.New(os.Stdout, "[audit] ", log.LstdFlags))
+	auditHandler := handler.NewAuditHandler(service.NewAuditService(stores.audit), logger)
+
+	var geoIP *service.GeoIP
+	if path := cfg.Auth.GeoIPDatabase; path != "" {
+		if geoIP, err = service.OpenGeoIP(path); err != nil {
+			logger.Fatal("opening the GeoIP database: ", err)
+		}
+		defer geoIP.Close()
 	}
-	emailClient := service.NewEmailClient("smtp.gmail.com", 587, mailUser, mailAppPassword, mailUser, logger)
+	sessionService := service.NewSessionService(stores.sessions, stores.knownDevices, geoIP, cfg.Auth.SessionPolicy(), auditor, logger)
+	sessionHandler := handler.NewSessionHandler(sessionService, logger)
+
+	authService := service.NewAuthService(stores.users, cfg.Auth.JWTSecret, emailClient, loginGuard, passwordPolicy, passwordHasher, sessionService, auditor, logger)
+	authHandler := handler.NewAuthHandler(authService, cfg.Cookies.HandlerConfig(), logger)
+	backgroundContext, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	auditDone := make(chan struct{})
+	go func() {
+		auditor.Run(backgroundContext)
+		close(auditDone)
+	}()
+
+	webhookLogger := log.New(os.Stdout, "[webhooks] ", log.LstdFlags)
+	go webhook.NewWorker(stores.webhooks, webhookLogger).Run(backgroundContext)
+	webhookHandler := handler.NewWebhookHandler(service.NewWebhookService(stores.webhooks, auditor), logger)
 
-	authService := service.NewAuthService(userRepo, jwt_secret, emailClient)
-	authHandler := handler.NewAuthHandler(authService, logger)
-	userService := service.NewUserService(userRepo)
+	err = startOutboxRelay(backgroundContext, cfg.Events, stores.users, webhook.NewDispatcher(stores.webhooks), log.New(os.Stdout, "[outbox] ", log.LstdFlags))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	userService := service.NewUserService(newUserCache(backgroundContext, cfg.Store.UserCacheSize, stores.users, storeLogger), sessionService, auditor)
 	userHandler := handler.NewUserHandler(userService, logger)
 
+	clientIPResolver, err := handler.NewClientIPResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	rateLimitStore, err := newRateLimitStore(cfg.RateLimit.Backend, stores.mongo, storeLogger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	rateLimitPolicies, err := ratelimit.ParsePolicies(cfg.RateLimit.Policies)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	rateLimiter := handler.NewRateLimiter(rateLimitStore, rateLimitPolicies, logger)
+
 	router := mux.NewRouter()
+	router.NotFoundHandler = handler.MiddlewareMetrics(handler.MiddlewareRequestID(handler.NotFoundHandler(logger)))
+	router.MethodNotAllowedHandler = handler.MiddlewareMetrics(handler.MiddlewareRequestID(handler.MethodNotAllowedHandler(logger)))
+	router.Use(otelmux.Middleware(cfg.Tracing.ServiceName))
+	router.Use(handler.MiddlewareMetrics)
+	router.Use(handler.MiddlewareRequestID)
+	router.Use(clientIPResolver.Middleware)
+	router.Use(handler.MiddlewareRequestInfo)
 	router.Use(authHandler.MiddlewareContentTypeSet)
 
 	// AUTH ROUTES
 	authRouter := router.Methods(http.MethodPost).Subrouter()
-	authRouter.HandleFunc("/api/auth/register", authHandler.Register)
-	authRouter.HandleFunc("/api/auth/login", authHandler.Login)
+	authRouter.Handle("/api/auth/register", rateLimiter.Limit("register")(http.HandlerFunc(authHandler.Register)))
+	authRouter.Handle("/api/auth/login", rateLimiter.Limit("login")(http.HandlerFunc(authHandler.Login)))
+	authRouter.Handle("/api/auth/refresh", rateLimiter.Limit("refresh")(http.HandlerFunc(authHandler.Refresh)))
+	authRouter.Handle("/api/auth/logout", authHandler.MiddlewareRequireRole()(http.HandlerFunc(authHandler.Logout)))
 	authRouter.HandleFunc("/api/auth/jwt", authHandler.ValidateJWT)
-	// confirm mail
-	// password reset
+	authRouter.Handle("/api/auth/password/forgot", rateLimiter.Limit("password_forgot")(http.HandlerFunc(authHandler.ForgotPassword)))
+	authRouter.Handle("/api/auth/password/reset", rateLimiter.Limit("password_reset")(http.HandlerFunc(authHandler.ResetPassword)))
+	authRouter.Handle("/api/auth/password/change", authHandler.MiddlewareRequireRole()(http.HandlerFunc(authHandler.ChangePassword)))
+	router.HandleFunc("/api/auth/verify", authHandler.VerifyEmail).Methods(http.MethodGet)
+	router.HandleFunc("/api/auth/secure-account", authHandler.SecureAccountPage).Methods(http.MethodGet)
+	router.HandleFunc("/api/auth/secure-account", authHandler.SecureAccount).Methods(http.MethodPost)
+
+	router.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
 
 	// USER ROUTES
+	router.HandleFunc("/api/user/batch", userHandler.LookupUsers).Methods(http.MethodPost)
+	router.Handle("/api/user/me", authHandler.MiddlewareRequireRole()(http.HandlerFunc(userHandler.UpdateProfile))).Methods(http.MethodPatch)
+	sessionRouter := router.PathPrefix("/api/user/me/sessions").Subrouter()
+	sessionRouter.Use(authHandler.MiddlewareRequireRole())
+	sessionRouter.HandleFunc("", sessionHandler.List).Methods(http.MethodGet)
+	sessionRouter.HandleFunc("", sessionHandler.RevokeOthers).Methods(http.MethodDelete)
+	sessionRouter.HandleFunc("/{id}", sessionHandler.Revoke).Methods(http.MethodDelete)
 	getRouter := router.Methods(http.MethodGet).Subrouter()
 	getRouter.HandleFunc("/api/user", userHandler.GetAll)
 	getRouter.HandleFunc("/api/user/{id}", userHandler.GetUser)
 	getRouter.HandleFunc("/api/user/getUsernames/{ids}", userHandler.GetUsernames)
 
-	// cors := gorillaHandlers.CORS(gorillaHandlers.AllowedOrigins([]string{"*"}))
+	// ADMIN ROUTES
+	adminRouter := router.PathPrefix("/api/admin").Subrouter()
+	adminRouter.Use(authHandler.MiddlewareRequireRole(model.RoleAdmin))
+	adminRouter.HandleFunc("/users/{id}/unlock", authHandler.UnlockAccount).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/users/{id}/role", userHandler.ChangeRole).Methods(http.MethodPut)
+	adminRouter.HandleFunc("/users/{id}/deactivate", userHandler.Deactivate).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/webhooks", webhookHandler.Create).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/webhooks", webhookHandler.List).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/webhooks/{id}", webhookHandler.Get).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/webhooks/{id}", webhookHandler.Delete).Methods(http.MethodDelete)
+	adminRouter.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.Deliveries).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/webhooks/deliveries/{id}/replay", webhookHandler.Replay).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/audit", auditHandler.Query).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/audit/export", auditHandler.Export).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/audit/verify", auditHandler.Verify).Methods(http.MethodGet)
 
-	//Initialize the server
+	cors, err := handler.NewCORS(cfg.CORS.HandlerConfig())
+	if err != nil {
+		logger.Fatal(err)
+	}
 	server := http.Server{
-		Addr:         ":" + port,
-		Handler:      router,
-		IdleTimeout:  120 * time.Second,
-		ReadTimeout:  1 * time.Second,
-		WriteTimeout: 1 * time.Second,
+		Addr:         ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:      cors.Handler(router),
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
-	logger.Println("Server listening on port", port)
+	logger.Println("Server listening on port", cfg.Server.Port)
 	//Distribute all the connections to goroutines
 	go func() {
 		err := server.ListenAndServe()
-		if err != nil {
+		// Shutdown makes it return ErrServerClosed, the shutdown below
+		// still has to finish.
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Fatal(err)
 		}
 	}()
 
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 	signal.Notify(sigCh, os.Kill)
 
@@ -102,9 +242,236 @@ func main() {
 	logger.Println("Received terminate, graceful shutdown", sig)
 
 	//Try to shutdown gracefully
-	if server.Shutdown(timeoutContext) != nil {
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+	if server.Shutdown(shutdownContext) != nil {
 		logger.Fatal("Cannot gracefully shutdown...")
 	}
+	// Write the audit entries of the last requests.
+	stopBackground()
+	select {
+	case <-auditDone:
+	case <-shutdownContext.Done():
+		logger.Println("Writing queued audit entries timed out")
+	}
+	if err := shutdownTracing(shutdownContext); err != nil {
+		logger.Printf("Flushing traces failed: %v", err)
+	}
 	logger.Println("Server stopped")
 
 }
+
+// loadConfig loads the configuration for a command. On failure it returns a
+// nil config and the exit code, usage and errors are already printed.
+func loadConfig(name string, args []string) (*config.Config, []string, int) {
+	cfg, rest, err := config.Load(name, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, nil, 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, nil, 2
+	}
+	return cfg, rest, 0
+}
+
+// setupTracing installs the W3C trace context propagator and, if an exporter
+// is configured, a tracer provider sending spans to it. The returned function
+// flushes the spans still buffered.
+func setupTracing(cfg config.Tracing) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = newOTLPExporter(context.Background(), cfg.OTLPEndpoint)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating the %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newOTLPExporter sends spans to the collector at endpoint. A base URL without
+// a path gets the standard /v1/traces, other paths are used as they are.
+func newOTLPExporter(ctx context.Context, endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	path := u.Path
+	if path == "" || path == "/" {
+		path = "/v1/traces"
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithURLPath(path)}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(ctx, options...)
+}
+
+// newMailer creates the mail transport, signing with DKIM if keys are set.
+func newMailer(cfg config.Mail) (service.Mailer, error) {
+	mailer, err := service.NewMailer(cfg.MailerConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	dkimKeys, err := service.ParseDKIMKeys(cfg.DKIMKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(dkimKeys) > 0 {
+		mailer, err = service.NewDKIMMailer(mailer, dkimKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mailer, nil
+}
+
+// stores holds the storage backends selected by store.backend.
+type stores struct {
+	users         repository.UserStore
+	loginAttempts repository.LoginAttemptStore
+	webhooks      repository.WebhookStore
+	audit         repository.AuditStore
+	sessions      repository.SessionStore
+	knownDevices  repository.KnownDeviceStore
+	// mongo is nil unless the Mongo backend is used.
+	mongo *mongo.Database
+}
+
+// openStores connects the configured backend: mongo, postgres or memory.
+func openStores(ctx context.Context, cfg config.Store, logger *log.Logger) (*stores, error) {
+	switch cfg.Backend {
+	case "mongo":
+		userRepo, err := repository.New(ctx, cfg.Mongo.URI, cfg.Mongo.Database, logger)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Mongo.AutoMigrate {
+			if err := repository.NewMongoMigrator(userRepo.Database(), logger).Up(ctx); err != nil {
+				userRepo.Disconnect(ctx)
+				return nil, err
+			}
+		}
+		return &stores{
+			users:         userRepo,
+			loginAttempts: repository.NewLoginAttemptRepo(userRepo.Database(), logger),
+			webhooks:      repository.NewWebhookRepo(userRepo.Database(), logger),
+			audit:         repository.NewAuditRepo(userRepo.Database(), logger),
+			sessions:      repository.NewSessionRepo(userRepo.Database(), logger),
+			knownDevices:  repository.NewKnownDeviceRepo(userRepo.Database(), logger),
+			mongo:         userRepo.Database(),
+		}, nil
+	case "postgres":
+		pool, err := repository.NewPostgres(ctx, cfg.Postgres.DSN, logger)
+		if err != nil {
+			return nil, err
+		}
+		return &stores{
+			users:         repository.NewPostgresUserStore(pool, logger),
+			loginAttempts: repository.NewPostgresLoginAttemptStore(pool, logger),
+			webhooks:      repository.NewPostgresWebhookStore(pool, logger),
+			audit:         repository.NewPostgresAuditStore(pool, logger),
+			sessions:      repository.NewPostgresSessionStore(pool, logger),
+			knownDevices:  repository.NewPostgresKnownDeviceStore(pool, logger),
+		}, nil
+	case "memory":
+		logger.Println("Using in-memory stores, data is lost on restart")
+		return &stores{
+			users:         repository.NewMemoryUserStore(),
+			loginAttempts: repository.NewMemoryLoginAttemptStore(),
+			webhooks:      repository.NewMemoryWebhookStore(),
+			audit:         repository.NewMemoryAuditStore(),
+			sessions:      repository.NewMemorySessionStore(),
+			knownDevices:  repository.NewMemoryKnownDeviceStore(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.Backend)
+	}
+}
+
+// newUserCache puts a cache of size entries in front of users if the store
+// can report changes. Size 0 disables it.
+func newUserCache(ctx context.Context, size int, users repository.UserStore, logger *log.Logger) repository.UserStore {
+	if size <= 0 {
+		return users
+	}
+	source, ok := users.(repository.UserChangeSource)
+	if !ok {
+		logger.Println("User cache disabled, the store can't report changes")
+		return users
+	}
+	cache := repository.NewCachedUserStore(users, size, logger)
+	go cache.Follow(ctx, source)
+	return cache
+}
+
+// startOutboxRelay publishes the domain events of users to the webhooks and
+// through the configured transport: local, nats or kafka. Without a
+// transport events only go to the webhooks.
+func startOutboxRelay(ctx context.Context, cfg config.Events, users repository.UserStore, webhooks outbox.Publisher, logger *log.Logger) error {
+	publisher := outbox.FanOut{webhooks}
+	switch cfg.Transport {
+	case "":
+		logger.Println("No event transport configured, domain events are only sent to webhooks")
+	case "local":
+		publisher = append(publisher, outbox.NewLocalPublisher())
+	case "nats":
+		natsPublisher, err := outbox.NewNATSPublisher(cfg.NATS.URL, cfg.NATS.SubjectPrefix)
+		if err != nil {
+			return fmt.Errorf("connecting to NATS: %w", err)
+		}
+		publisher = append(publisher, natsPublisher)
+	case "kafka":
+		publisher = append(publisher, outbox.NewKafkaPublisher(cfg.Kafka.Brokers, cfg.Kafka.Topic))
+	default:
+		return fmt.Errorf("unknown event transport %q", cfg.Transport)
+	}
+
+	store, ok := users.(repository.OutboxStore)
+	if !ok {
+		publisher.Close()
+		return fmt.Errorf("the user store has no outbox to publish events from")
+	}
+	relay := outbox.NewRelay(store, publisher, logger)
+	go func() {
+		relay.Run(ctx)
+		if err := publisher.Close(); err != nil {
+			logger.Printf("Closing event publisher failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// newRateLimitStore selects the bucket store. The memory store is only
+// correct with a single replica, use "mongo" when scaling out.
+func newRateLimitStore(backend string, db *mongo.Database, logger *log.Logger) (ratelimit.Store, error) {
+	switch backend {
+	case "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "mongo":
+		if db == nil {
+			return nil, fmt.Errorf("the mongo rate limit store requires the mongo store backend")
+		}
+		return repository.NewRateLimitRepo(db, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+}
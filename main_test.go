@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestOTLPExporterPath(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer collector.Close()
+
+	for _, tt := range []struct {
+		endpoint string
+		want     string
+	}{
+		{collector.URL, "/v1/traces"},
+		{collector.URL + "/", "/v1/traces"},
+		{collector.URL + "/otel/v1/traces", "/otel/v1/traces"},
+	} {
+		mu.Lock()
+		paths = nil
+		mu.Unlock()
+
+		ctx := context.Background()
+		exporter, err := newOTLPExporter(ctx, tt.endpoint)
+		if err != nil {
+			t.Fatalf("newOTLPExporter(%s): %v", tt.endpoint, err)
+		}
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		_, span := provider.Tracer("test").Start(ctx, "span")
+		span.End()
+		if err := provider.Shutdown(ctx); err != nil {
+			t.Fatalf("exporting to %s: %v", tt.endpoint, err)
+		}
+
+		mu.Lock()
+		if len(paths) != 1 || paths[0] != tt.want {
+			t.Errorf("exporter for %s requested %v, want [%s]", tt.endpoint, paths, tt.want)
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+const migrateUsage = "usage: auth-service migrate [flags] up | down [steps] | status"
+
+// runMigrate implements the migrate subcommand for the Mongo backend and
+// returns the process exit code. Postgres migrations run on startup.
+func runMigrate(args []string) int {
+	logger := log.New(os.Stdout, "[migrate] ", log.LstdFlags)
+	cfg, args, code := loadConfig("migrate", args)
+	if cfg == nil {
+		return code
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	if cfg.Store.Backend != "mongo" {
+		fmt.Fprintf(os.Stderr, "migrate only supports the mongo store backend, not %q\n", cfg.Store.Backend)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	userRepo, err := repository.New(ctx, cfg.Store.Mongo.URI, cfg.Store.Mongo.Database, logger)
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	defer userRepo.Disconnect(context.Background())
+	migrator := repository.NewMongoMigrator(userRepo.Database(), logger)
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				return 2
+			}
+		}
+		err = migrator.Down(ctx, steps)
+	case "status":
+		var statuses []repository.MigrationStatus
+		if statuses, err = migrator.Status(ctx); err == nil {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.Applied {
+					appliedAt = status.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+			}
+			w.Flush()
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audited actions.
+const (
+	AuditRegister             = "user.register"
+	AuditVerifyEmail          = "user.verify_email"
+	AuditProfileUpdate        = "user.profile_update"
+	AuditLogin                = "auth.login"
+	AuditAccountLocked        = "auth.account_locked"
+	AuditPasswordChange       = "auth.password_change"
+	AuditPasswordResetRequest = "auth.password_reset_request"
+	AuditPasswordReset        = "auth.password_reset"
+	AuditSessionRevoke        = "auth.session_revoke"
+	AuditRefreshTokenReuse    = "auth.refresh_token_reuse"
+	AuditNewDevice            = "auth.new_device"
+	AuditAccountSecure        = "auth.account_secure"
+	AuditAccountUnlock        = "admin.account_unlock"
+	AuditRoleChange           = "admin.role_change"
+	AuditUserDeactivate       = "admin.user_deactivate"
+	AuditWebhookCreate        = "admin.webhook_create"
+	AuditWebhookDelete        = "admin.webhook_delete"
+	AuditWebhookReplay        = "admin.webhook_replay"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEntry is one record of the security audit log. Entries form a hash
+// chain: Hash covers all other fields including PrevHash, the Hash of the
+// entry with the previous Seq, so editing or removing an entry breaks the
+// chain from there on.
+type AuditEntry struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Seq       int64              `bson:"seq" json:"seq"`
+	Time      time.Time          `bson:"time" json:"time"`
+	Action    string             `bson:"action" json:"action"`
+	Result    string             `bson:"result" json:"result"`
+	ActorID   string             `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	ActorName string             `bson:"actor_name,omitempty" json:"actor_name,omitempty"`
+	TargetID  string             `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	IP        string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	RequestID string             `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	Details   map[string]string  `bson:"details,omitempty" json:"details,omitempty"`
+	PrevHash  string             `bson:"prev_hash" json:"prev_hash"`
+	Hash      string             `bson:"hash" json:"hash"`
+}
+
+// ComputeHash returns the hex SHA-256 of the entry without its Hash. Time is
+// hashed with millisecond precision, which every store keeps.
+func (e *AuditEntry) ComputeHash() string {
+	data, _ := json.Marshal(struct {
+		ID        string            `json:"id"`
+		Seq       int64             `json:"seq"`
+		Time      int64             `json:"time"`
+		Action    string            `json:"action"`
+		Result    string            `json:"result"`
+		ActorID   string            `json:"actor_id"`
+		ActorName string            `json:"actor_name"`
+		TargetID  string            `json:"target_id"`
+		IP        string            `json:"ip"`
+		UserAgent string            `json:"user_agent"`
+		RequestID string            `json:"request_id"`
+		Details   map[string]string `json:"details"`
+		PrevHash  string            `json:"prev_hash"`
+	}{
+		e.ID.Hex(), e.Seq, e.Time.UnixMilli(), e.Action, e.Result, e.ActorID, e.ActorName,
+		e.TargetID, e.IP, e.UserAgent, e.RequestID, e.Details, e.PrevHash,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditPage is one page of a newest-first audit query. NextCursor is passed
+// as cursor to get the following page and is empty on the last one.
+type AuditPage struct {
+	Results    []AuditEntry `json:"results"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event is a domain event in the outbox. The JSON form is what subscribers
+// receive; ID stays the same across redeliveries so they can deduplicate.
+type Event struct {
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	Type          string             `bson:"type" json:"type"`
+	AggregateID   string             `bson:"aggregate_id" json:"aggregate_id"`
+	OccurredAt    time.Time          `bson:"occurred_at" json:"occurred_at"`
+	Payload       json.RawMessage    `bson:"payload" json:"payload"`
+	Published     bool               `bson:"published" json:"-"`
+	PublishedAt   *time.Time         `bson:"published_at,omitempty" json:"-"`
+	Attempts      int                `bson:"attempts" json:"-"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"-"`
+	LastError     string             `bson:"last_error,omitempty" json:"-"`
+}
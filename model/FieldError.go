@@ -0,0 +1,9 @@
+package model
+
+// FieldError describes why a single request field was rejected. Code is a
+// stable identifier clients can map to their own messages.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KnownDevice is a device and location a user has logged in from before.
+// Fingerprint identifies the pair, logins with an unknown fingerprint
+// trigger a new-device alert.
+type KnownDevice struct {
+	UserID      primitive.ObjectID `bson:"user_id" json:"-"`
+	Fingerprint string             `bson:"fingerprint" json:"-"`
+	Device      string             `bson:"device" json:"device"`
+	Location    string             `bson:"location" json:"location"`
+	IP          string             `bson:"ip" json:"ip"`
+	FirstSeenAt time.Time          `bson:"first_seen_at" json:"first_seen_at"`
+	LastSeenAt  time.Time          `bson:"last_seen_at" json:"last_seen_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// LoginAttempt counts failed logins for one key, e.g. "user:alice" or "ip:10.0.0.1".
+type LoginAttempt struct {
+	Key           string    `bson:"_id" json:"key"`
+	Failures      int       `bson:"failures" json:"failures"`
+	LastFailure   time.Time `bson:"last_failure" json:"last_failure"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil   time.Time `bson:"locked_until" json:"locked_until"`
+	ExpiresAt     time.Time `bson:"expires_at" json:"-"`
+}
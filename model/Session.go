@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one login of a user on a device. It lives as long as its
+// refresh token keeps being rotated before ExpiresAt.
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"-"`
+	Device     string             `bson:"device" json:"device"`
+	UserAgent  string             `bson:"user_agent" json:"user_agent"`
+	IP         string             `bson:"ip" json:"ip"`
+	Location   string             `bson:"location" json:"location"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	LastSeenAt time.Time          `bson:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	// RefreshTokenHash is the SHA-256 of the current refresh token. The
+	// hashes of the tokens it replaced are kept to detect their reuse.
+	RefreshTokenHash  string   `bson:"refresh_token_hash" json:"-"`
+	UsedRefreshTokens []string `bson:"used_refresh_tokens" json:"-"`
+	// Current marks the session of the caller when listing sessions.
+	Current bool `bson:"-" json:"current"`
+}
@@ -13,20 +13,23 @@ const (
 )
 
 type User struct {
-	ID           primitive.ObjectID `bson:"_id" json:"id"`
-	Username     string             `bson:"username" json:"username"`
-	PasswordHash string             `bson:"password_hash" json:"-"`
-	Role         UserRole           `bson:"role" json:"role"`
-	IsActive     bool               `bson:"is_active" json:"-"`
+	ID                primitive.ObjectID `bson:"_id" json:"id"`
+	Username          string             `bson:"username" json:"username"`
+	UsernameCanonical string             `bson:"username_canonical" json:"-"`
+	PasswordHash      string             `bson:"password_hash" json:"-"`
+	Role              UserRole           `bson:"role" json:"role"`
+	IsActive          bool               `bson:"is_active" json:"-"`
 }
 
 type Person struct {
-	ID           primitive.ObjectID `bson:"_id" json:"id"`
-	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
-	FirstName    string             `bson:"first_name" json:"first_name"`
-	LastName     string             `bson:"last_name" json:"last_name"`
-	Email        string             `bson:"email" json:"email"`
-	ProfileImage string             `bson:"profile_image" json:"profile_image"`
+	ID             primitive.ObjectID `bson:"_id" json:"id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	FirstName      string             `bson:"first_name" json:"first_name"`
+	LastName       string             `bson:"last_name" json:"last_name"`
+	Email          string             `bson:"email" json:"email"`
+	EmailCanonical string             `bson:"email_canonical" json:"-"`
+	ProfileImage   string             `bson:"profile_image" json:"profile_image"`
+	Locale         string             `bson:"locale" json:"locale"`
 }
 
 type PagedResult[T any] struct {
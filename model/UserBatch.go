@@ -0,0 +1,8 @@
+package model
+
+// UserBatch answers a batch lookup. Users maps each found ID to the requested
+// fields; IDs of unknown, inactive or malformed users are listed in NotFound.
+type UserBatch struct {
+	Users    map[string]map[string]string `json:"users"`
+	NotFound []string                     `json:"not_found"`
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook is an admin managed subscription of an external endpoint to domain
+// events. Events lists the event types to deliver, "*" matches all of them.
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	URL       string             `bson:"url" json:"url"`
+	Events    []string           `bson:"events" json:"events"`
+	Secret    string             `bson:"secret" json:"-"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+func (w *Webhook) Matches(eventType string) bool {
+	for _, filter := range w.Events {
+		if filter == "*" || filter == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event to be sent to one webhook. Attempts counts
+// the tries since the delivery was queued or last replayed, Log keeps the
+// outcome of the most recent tries.
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	WebhookID     primitive.ObjectID `bson:"webhook_id" json:"webhook_id"`
+	EventID       primitive.ObjectID `bson:"event_id" json:"event_id"`
+	EventType     string             `bson:"event_type" json:"event_type"`
+	Payload       json.RawMessage    `bson:"payload" json:"payload"`
+	Status        string             `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	Log           []DeliveryAttempt  `bson:"log" json:"log"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type DeliveryAttempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMS int64     `bson:"duration_ms" json:"duration_ms"`
+}
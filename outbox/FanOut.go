@@ -0,0 +1,30 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+
+	"github.com/MicroSOA-09/auth-service/model"
+)
+
+// FanOut publishes every event to all of its publishers. If one fails the
+// event is retried on all of them, so each publisher has to tolerate
+// duplicates.
+type FanOut []Publisher
+
+func (f FanOut) Publish(ctx context.Context, event model.Event) error {
+	for _, publisher := range f {
+		if err := publisher.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f FanOut) Close() error {
+	var errs []error
+	for _, publisher := range f {
+		errs = append(errs, publisher.Close())
+	}
+	return errors.Join(errs...)
+}
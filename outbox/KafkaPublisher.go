@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher writes all events to one topic, keyed by user ID so the
+// events of a user stay in order within their partition.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// The relay publishes one event at a time and waits for the ack.
+		BatchSize: 1,
+	}}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, event model.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.AggregateID),
+		Value: data,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(event.ID.Hex())},
+			{Key: "event-type", Value: []byte(event.Type)},
+		},
+	})
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
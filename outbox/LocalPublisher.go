@@ -0,0 +1,56 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MicroSOA-09/auth-service/model"
+)
+
+// LocalPublisher delivers events to in-process subscribers and records them.
+// It is meant for tests and for running the service without a broker.
+type LocalPublisher struct {
+	mu          sync.Mutex
+	subscribers []func(ctx context.Context, event model.Event) error
+	published   []model.Event
+}
+
+func NewLocalPublisher() *LocalPublisher {
+	return &LocalPublisher{}
+}
+
+// Subscribe registers fn for all events. An error from fn fails the
+// publication, so the relay delivers the event again later.
+func (p *LocalPublisher) Subscribe(fn func(ctx context.Context, event model.Event) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribers = append(p.subscribers, fn)
+}
+
+func (p *LocalPublisher) Publish(ctx context.Context, event model.Event) error {
+	p.mu.Lock()
+	subscribers := p.subscribers
+	p.mu.Unlock()
+
+	for _, fn := range subscribers {
+		if err := fn(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, event)
+	return nil
+}
+
+// Published returns the successfully published events in order.
+func (p *LocalPublisher) Published() []model.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]model.Event(nil), p.published...)
+}
+
+func (p *LocalPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATSPublisher publishes to JetStream on <prefix>.<event type>, e.g.
+// auth.events.UserRegistered. A stream covering these subjects has to exist.
+// The event ID is used as message ID, so JetStream drops redeliveries within
+// its duplicate window.
+type NATSPublisher struct {
+	conn          *nats.Conn
+	js            jetstream.JetStream
+	subjectPrefix string
+}
+
+func NewNATSPublisher(url, subjectPrefix string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("auth-service"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NATSPublisher{conn: conn, js: js, subjectPrefix: subjectPrefix}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event model.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(p.subjectPrefix + "." + event.Type)
+	msg.Data = data
+	msg.Header.Set("Content-Type", "application/json")
+	_, err = p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(event.ID.Hex()))
+	return err
+}
+
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,93 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+// Publisher delivers events to a message broker. Publish must only return nil
+// once the broker has accepted the event.
+type Publisher interface {
+	Publish(ctx context.Context, event model.Event) error
+	Close() error
+}
+
+// Relay moves events from the outbox to a Publisher. Delivery is at least
+// once: an event whose publication isn't confirmed, or whose relay dies before
+// marking it published, is sent again after its lease expired. Subscribers
+// deduplicate by event ID. Events go out in the order they were written,
+// except that an event waiting for a retry is overtaken by later ones.
+type Relay struct {
+	store     repository.OutboxStore
+	publisher Publisher
+	logger    *log.Logger
+
+	// PollInterval is the wait after the outbox was found empty.
+	PollInterval time.Duration
+	// Lease hides a claimed event from other replicas while it is published.
+	Lease time.Duration
+	// Failed publications are retried after RetryDelay, doubled per attempt
+	// up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+func NewRelay(store repository.OutboxStore, publisher Publisher, logger *log.Logger) *Relay {
+	return &Relay{
+		store:         store,
+		publisher:     publisher,
+		logger:        logger,
+		PollInterval:  time.Second,
+		Lease:         30 * time.Second,
+		RetryDelay:    time.Second,
+		MaxRetryDelay: 10 * time.Minute,
+	}
+}
+
+// Run relays events until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		relayed, err := r.relayOne(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Printf("Outbox relay failed: %v", err)
+		}
+		if relayed {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+// relayOne publishes the next due event. It reports whether an event was
+// claimed, so Run only sleeps when the outbox is drained or unreachable.
+func (r *Relay) relayOne(ctx context.Context) (bool, error) {
+	event, err := r.store.ClaimEvent(ctx, time.Now(), r.Lease)
+	if err != nil || event == nil {
+		return false, err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.Lease/2)
+	err = r.publisher.Publish(publishCtx, *event)
+	cancel()
+	if err != nil {
+		nextAttemptAt := time.Now().Add(r.retryDelay(event.Attempts))
+		r.logger.Printf("Publishing %s event %s failed (attempt %d), retrying at %v: %v",
+			event.Type, event.ID.Hex(), event.Attempts, nextAttemptAt, err)
+		return true, r.store.RetryEvent(ctx, event.ID, nextAttemptAt, err.Error())
+	}
+	return true, r.store.MarkPublished(ctx, event.ID, time.Now())
+}
+
+func (r *Relay) retryDelay(attempts int) time.Duration {
+	if shift := attempts - 1; shift >= 0 && shift < 20 {
+		return min(r.RetryDelay<<shift, r.MaxRetryDelay)
+	}
+	return r.MaxRetryDelay
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// period is the time an idle bucket needs to refill completely.
+	period time.Duration
+}
+
+// MemoryStore keeps buckets in process memory. It is only correct for
+// a single replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*tokenBucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.takes++
+	if s.takes%1000 == 0 {
+		s.sweep(now)
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(policy.Burst), updatedAt: now, period: policy.Period}
+		s.buckets[key] = bucket
+	}
+
+	elapsed := max(now.Sub(bucket.updatedAt).Seconds(), 0)
+	bucket.tokens = math.Min(float64(policy.Burst), bucket.tokens+elapsed*policy.RefillRate())
+	bucket.updatedAt = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	return BucketResult(policy, bucket.tokens, allowed), nil
+}
+
+// sweep drops buckets that were idle long enough to be full again.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.updatedAt) > bucket.period {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ByIP       = "ip"
+	ByUsername = "username"
+	ByClientID = "client_id"
+)
+
+// Policy is a token bucket holding up to Burst tokens that refills
+// Burst tokens every Period.
+type Policy struct {
+	Route  string
+	KeyBy  string
+	Burst  int
+	Period time.Duration
+}
+
+func (p Policy) RefillRate() float64 {
+	return float64(p.Burst) / p.Period.Seconds()
+}
+
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Store takes one token from the bucket stored under key.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error)
+}
+
+// ParsePolicies parses a comma separated list of
+// route:key:burst/period entries, e.g. "login:ip:10/1m,login:username:5/15m".
+func ParsePolicies(value string) ([]Policy, error) {
+	var policies []Policy
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid rate limit policy %q, expected route:key:burst/period", entry)
+		}
+		burst, period, ok := strings.Cut(parts[2], "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit policy %q, expected route:key:burst/period", entry)
+		}
+
+		policy := Policy{Route: parts[0], KeyBy: parts[1]}
+		switch policy.KeyBy {
+		case ByIP, ByUsername, ByClientID:
+		default:
+			return nil, fmt.Errorf("invalid rate limit key %q in policy %q", policy.KeyBy, entry)
+		}
+		var err error
+		if policy.Burst, err = strconv.Atoi(burst); err != nil || policy.Burst <= 0 {
+			return nil, fmt.Errorf("invalid burst in rate limit policy %q", entry)
+		}
+		if policy.Period, err = time.ParseDuration(period); err != nil || policy.Period <= 0 {
+			return nil, fmt.Errorf("invalid period in rate limit policy %q", entry)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// BucketResult derives the response values from the tokens left in a bucket
+// after a take attempt.
+func BucketResult(policy Policy, tokens float64, allowed bool) Result {
+	rate := policy.RefillRate()
+	result := Result{
+		Allowed:    allowed,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(policy.Burst) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRepo keeps the audit log in the audit_log collection. The unique
+// index on seq serializes appends: of two writers linking to the same entry
+// only one insert succeeds, the other re-reads the head and retries until
+// ctx is done. Each conflict means another entry was appended, so the log
+// always makes progress.
+type AuditRepo struct {
+	logger  *log.Logger
+	entries *mongo.Collection
+}
+
+func NewAuditRepo(db *mongo.Database, logger *log.Logger) *AuditRepo {
+	return &AuditRepo{
+		logger:  logger,
+		entries: db.Collection("audit_log"),
+	}
+}
+
+func (r *AuditRepo) AppendAudit(ctx context.Context, entry *model.AuditEntry) error {
+	for ctx.Err() == nil {
+		var prev *model.AuditEntry
+		last := model.AuditEntry{}
+		err := r.entries.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})).Decode(&last)
+		switch {
+		case err == nil:
+			prev = &last
+		case !errors.Is(err, mongo.ErrNoDocuments):
+			return err
+		}
+
+		entry.ID = primitive.NilObjectID
+		chainAuditEntry(entry, prev)
+		_, err = r.entries.InsertOne(ctx, entry)
+		if !mongo.IsDuplicateKeyError(err) {
+			if err != nil {
+				r.logger.Printf("Failed to append %s audit entry: %v", entry.Action, err)
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("audit log append kept conflicting with concurrent writers: %w", ctx.Err())
+}
+
+func auditQuery(filter AuditFilter) bson.M {
+	query := bson.M{}
+	if filter.UserID != "" {
+		query["$or"] = bson.A{bson.M{"actor_id": filter.UserID}, bson.M{"target_id": filter.UserID}}
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	timeRange := bson.M{}
+	if !filter.From.IsZero() {
+		timeRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timeRange["$lt"] = filter.To
+	}
+	if len(timeRange) > 0 {
+		query["time"] = timeRange
+	}
+	if filter.BeforeSeq != 0 {
+		query["seq"] = bson.M{"$lt": filter.BeforeSeq}
+	}
+	return query
+}
+
+func (r *AuditRepo) QueryAudit(ctx context.Context, filter AuditFilter, limit int) ([]model.AuditEntry, error) {
+	cursor, err := r.entries.Find(ctx, auditQuery(filter),
+		options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	entries := []model.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *AuditRepo) ExportAudit(ctx context.Context, filter AuditFilter, fn func(entry model.AuditEntry) error) error {
+	cursor, err := r.entries.Find(ctx, auditQuery(filter), options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		entry := model.AuditEntry{}
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,17 @@
+package repository_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMongoAuditStore(t *testing.T) {
+	uri := mongoURI(t)
+	storetest.TestAuditStore(t, func(t *testing.T) repository.AuditStore {
+		return repository.NewAuditRepo(newMongoUserRepo(t, uri).Database(), log.New(io.Discard, "", 0))
+	})
+}
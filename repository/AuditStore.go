@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditStore is the append-only audit log. There is deliberately no way to
+// change or delete entries.
+type AuditStore interface {
+	// AppendAudit assigns the next Seq, links the entry to the last one and
+	// stores it. Concurrent appends, also from other replicas, are serialized.
+	AppendAudit(ctx context.Context, entry *model.AuditEntry) error
+	// QueryAudit returns up to limit matching entries, newest first.
+	QueryAudit(ctx context.Context, filter AuditFilter, limit int) ([]model.AuditEntry, error)
+	// ExportAudit calls fn for every matching entry, oldest first.
+	ExportAudit(ctx context.Context, filter AuditFilter, fn func(entry model.AuditEntry) error) error
+}
+
+// AuditFilter selects audit entries. Zero fields match everything.
+type AuditFilter struct {
+	// UserID matches entries where the user is the actor or the target.
+	UserID string
+	Action string
+	// From is inclusive, To exclusive.
+	From time.Time
+	To   time.Time
+	// BeforeSeq only matches entries older than this sequence number.
+	BeforeSeq int64
+}
+
+func (f AuditFilter) matches(entry model.AuditEntry) bool {
+	return (f.UserID == "" || entry.ActorID == f.UserID || entry.TargetID == f.UserID) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.From.IsZero() || !entry.Time.Before(f.From)) &&
+		(f.To.IsZero() || entry.Time.Before(f.To)) &&
+		(f.BeforeSeq == 0 || entry.Seq < f.BeforeSeq)
+}
+
+var (
+	_ AuditStore = (*AuditRepo)(nil)
+	_ AuditStore = (*MemoryAuditStore)(nil)
+	_ AuditStore = (*PostgresAuditStore)(nil)
+)
+
+// chainAuditEntry makes entry the successor of prev, which is nil for the
+// first entry of the log.
+func chainAuditEntry(entry *model.AuditEntry, prev *model.AuditEntry) {
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC().Truncate(time.Millisecond)
+	if len(entry.Details) == 0 {
+		entry.Details = nil
+	}
+	entry.Seq, entry.PrevHash = 1, ""
+	if prev != nil {
+		entry.Seq, entry.PrevHash = prev.Seq+1, prev.Hash
+	}
+	entry.Hash = entry.ComputeHash()
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	userCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Subsystem: "user_cache",
+		Name:      "lookups_total",
+		Help:      "IDs looked up in the user cache by result: hit, miss or bypassed while the cache isn't coherent.",
+	}, []string{"result"})
+	userCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "auth",
+		Subsystem: "user_cache",
+		Name:      "evictions_total",
+		Help:      "Entries evicted from the user cache to make room.",
+	})
+	userCacheInvalidations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "auth",
+		Subsystem: "user_cache",
+		Name:      "invalidations_total",
+		Help:      "User cache invalidations caused by changes.",
+	})
+	userCacheResets = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "auth",
+		Subsystem: "user_cache",
+		Name:      "resets_total",
+		Help:      "Times the user cache was emptied because the change stream started or stopped.",
+	})
+	userCacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "auth",
+		Subsystem: "user_cache",
+		Name:      "entries",
+		Help:      "Users and persons in the user cache.",
+	})
+)
+
+// CachedUserStore is a read-through LRU cache for the lookups by ID that other
+// services make to render user names. It only serves from the cache while
+// Follow is connected to a change stream; without one every call goes to the
+// wrapped store. Lookups by username and email are never cached, they are
+// used for authentication and must see the current password hash.
+type CachedUserStore struct {
+	UserStore
+	logger *log.Logger
+
+	mu      sync.Mutex
+	users   *lru[primitive.ObjectID, model.User]
+	persons *lru[primitive.ObjectID, model.Person]
+	// coherent is set while the change stream runs.
+	coherent bool
+	// generation changes on every invalidation. A value read from the store
+	// is only cached if no invalidation happened during the read.
+	generation uint64
+}
+
+func NewCachedUserStore(store UserStore, size int, logger *log.Logger) *CachedUserStore {
+	return &CachedUserStore{
+		UserStore: store,
+		logger:    logger,
+		users:     newLRU[primitive.ObjectID, model.User](size),
+		persons:   newLRU[primitive.ObjectID, model.Person](size),
+	}
+}
+
+// Follow invalidates entries as the change stream of source reports changes,
+// reconnecting with backoff until ctx is done. Events missed while the stream
+// was down can't be replayed, so the cache is cleared and bypassed meanwhile.
+func (c *CachedUserStore) Follow(ctx context.Context, source UserChangeSource) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		changes, err := source.WatchUserChanges(ctx)
+		if err == nil {
+			backoff = time.Second
+			c.setCoherent(true)
+			err = c.apply(ctx, changes)
+			changes.Close(context.Background())
+		}
+		c.setCoherent(false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.logger.Printf("User cache disabled, change stream failed: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+func (c *CachedUserStore) apply(ctx context.Context, changes UserChanges) error {
+	for {
+		userID, err := changes.Next(ctx)
+		if err != nil {
+			return err
+		}
+		c.invalidate(userID)
+	}
+}
+
+func (c *CachedUserStore) setCoherent(coherent bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.coherent = coherent
+	c.generation++
+	c.users.clear()
+	c.persons.clear()
+	userCacheResets.Inc()
+	c.updateSize()
+}
+
+// invalidate drops the entries of userID, or all entries for the zero ID.
+func (c *CachedUserStore) invalidate(userID primitive.ObjectID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if userID.IsZero() {
+		c.users.clear()
+		c.persons.clear()
+	} else {
+		c.users.remove(userID)
+		c.persons.remove(userID)
+	}
+	userCacheInvalidations.Inc()
+	c.updateSize()
+}
+
+func (c *CachedUserStore) updateSize() {
+	userCacheEntries.Set(float64(c.users.len() + c.persons.len()))
+}
+
+// cacheLookup returns the cached entries of ids, the ids that have to be read and
+// the generation to pass to cachePut.
+func cacheLookup[V any](c *CachedUserStore, cache *lru[primitive.ObjectID, V], ids []primitive.ObjectID) (found []V, missing []primitive.ObjectID, generation uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.coherent {
+		userCacheLookups.WithLabelValues("bypassed").Add(float64(len(ids)))
+		return nil, ids, 0, false
+	}
+
+	seen := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if value, hit := cache.get(id); hit {
+			found = append(found, value)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	userCacheLookups.WithLabelValues("hit").Add(float64(len(found)))
+	userCacheLookups.WithLabelValues("miss").Add(float64(len(missing)))
+	return found, missing, c.generation, true
+}
+
+func cachePut[V any](c *CachedUserStore, cache *lru[primitive.ObjectID, V], generation uint64, key func(V) primitive.ObjectID, values []V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.coherent || c.generation != generation {
+		return
+	}
+	for _, value := range values {
+		if cache.put(key(value), value) {
+			userCacheEvictions.Inc()
+		}
+	}
+	c.updateSize()
+}
+
+func userKey(user model.User) primitive.ObjectID       { return user.ID }
+func personKey(person model.Person) primitive.ObjectID { return person.UserID }
+
+func (c *CachedUserStore) GetUser(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	users, err := c.GetUserByIds(ctx, []primitive.ObjectID{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return &users[0], nil
+}
+
+// GetUserByIds caches active users only, like the wrapped store returns them.
+// Unknown and inactive IDs are looked up again on every call.
+func (c *CachedUserStore) GetUserByIds(ctx context.Context, ids []primitive.ObjectID) ([]model.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	found, missing, generation, ok := cacheLookup(c, c.users, ids)
+	if len(missing) == 0 {
+		return found, nil
+	}
+	users, err := c.UserStore.GetUserByIds(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cachePut(c, c.users, generation, userKey, users)
+	}
+	return append(found, users...), nil
+}
+
+func (c *CachedUserStore) GetPerson(ctx context.Context, userID primitive.ObjectID) (*model.Person, error) {
+	persons, err := c.GetPersonsByUserIds(ctx, []primitive.ObjectID{userID})
+	if err != nil {
+		return nil, err
+	}
+	if len(persons) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return &persons[0], nil
+}
+
+func (c *CachedUserStore) GetPersonsByUserIds(ctx context.Context, userIDs []primitive.ObjectID) ([]model.Person, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	found, missing, generation, ok := cacheLookup(c, c.persons, userIDs)
+	if len(missing) == 0 {
+		return found, nil
+	}
+	persons, err := c.UserStore.GetPersonsByUserIds(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cachePut(c, c.persons, generation, personKey, persons)
+	}
+	return append(found, persons...), nil
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"golang.org/x/text/secure/precis"
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrInvalidUsername = apperror.New(apperror.KindInvalid, "user.invalid_username", "username contains characters that are not allowed")
+
+// CanonicalUsername maps a username to the form uniqueness is checked on:
+// the PRECIS UsernameCaseMapped profile (RFC 8265), which applies width
+// mapping, case folding and NFC. "Alice" and "ａｌｉｃｅ" both become "alice".
+func CanonicalUsername(username string) (string, error) {
+	canonical, err := precis.UsernameCaseMapped.String(strings.TrimSpace(username))
+	if err != nil {
+		return "", ErrInvalidUsername.Wrap(err)
+	}
+	return canonical, nil
+}
+
+// CanonicalEmail trims, NFKC-normalizes and lowercases an address. RFC 5321
+// allows case-sensitive local parts, but providers treat them as
+// case-insensitive and so do users.
+func CanonicalEmail(email string) string {
+	return strings.ToLower(norm.NFKC.String(strings.TrimSpace(email)))
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// KnownDeviceRepo keeps known devices in the known_devices collection, whose
+// TTL index on expires_at forgets devices that weren't used for a while.
+type KnownDeviceRepo struct {
+	logger  *log.Logger
+	devices *mongo.Collection
+}
+
+func NewKnownDeviceRepo(db *mongo.Database, logger *log.Logger) *KnownDeviceRepo {
+	return &KnownDeviceRepo{
+		logger:  logger,
+		devices: db.Collection("known_devices"),
+	}
+}
+
+func (r *KnownDeviceRepo) RememberDevice(ctx context.Context, device *model.KnownDevice) (bool, error) {
+	previous := model.KnownDevice{}
+	err := r.devices.FindOneAndUpdate(ctx,
+		bson.M{"user_id": device.UserID, "fingerprint": device.Fingerprint},
+		bson.M{
+			"$set": bson.M{
+				"device":       device.Device,
+				"location":     device.Location,
+				"ip":           device.IP,
+				"last_seen_at": device.LastSeenAt,
+				"expires_at":   device.LastSeenAt.Add(knownDeviceRetention),
+			},
+			"$setOnInsert": bson.M{"first_seen_at": device.FirstSeenAt},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		r.logger.Printf("Failed to remember device of %s: %v", device.UserID.Hex(), err)
+		return false, err
+	}
+	// The TTL monitor only runs periodically, so a stale device counts as new.
+	if previous.LastSeenAt.Before(time.Now().Add(-knownDeviceRetention)) {
+		return false, nil
+	}
+	device.FirstSeenAt = previous.FirstSeenAt
+	return true, nil
+}
+
+func (r *KnownDeviceRepo) CountDevices(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return r.devices.CountDocuments(ctx, bson.M{"user_id": userID, "expires_at": bson.M{"$gt": time.Now()}})
+}
+
+func (r *KnownDeviceRepo) ForgetDevices(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.devices.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KnownDeviceStore remembers the devices and locations users logged in from.
+// Devices not seen for knownDeviceRetention are forgotten.
+type KnownDeviceStore interface {
+	// RememberDevice records a login from device and reports whether the
+	// user had logged in from it before. FirstSeenAt is only set for new
+	// devices.
+	RememberDevice(ctx context.Context, device *model.KnownDevice) (bool, error)
+	// CountDevices returns how many devices of userID are remembered.
+	CountDevices(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	// ForgetDevices forgets all devices of userID.
+	ForgetDevices(ctx context.Context, userID primitive.ObjectID) error
+}
+
+var (
+	_ KnownDeviceStore = (*KnownDeviceRepo)(nil)
+	_ KnownDeviceStore = (*MemoryKnownDeviceStore)(nil)
+	_ KnownDeviceStore = (*PostgresKnownDeviceStore)(nil)
+)
+
+const knownDeviceRetention = 180 * 24 * time.Hour
@@ -0,0 +1,62 @@
+package repository
+
+import "container/list"
+
+// lru is a fixed size least recently used map. It is not safe for concurrent
+// use, callers hold their own lock.
+type lru[K comparable, V any] struct {
+	capacity int
+	order    *list.List
+	items    map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRU[K comparable, V any](capacity int) *lru[K, V] {
+	return &lru[K, V]{capacity: capacity, order: list.New(), items: map[K]*list.Element{}}
+}
+
+func (c *lru[K, V]) get(key K) (V, bool) {
+	if element, ok := c.items[key]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*lruEntry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// put stores value and reports whether an older entry was evicted for it.
+func (c *lru[K, V]) put(key K, value V) bool {
+	if element, ok := c.items[key]; ok {
+		element.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return false
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.order.Len() <= c.capacity {
+		return false
+	}
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+	return true
+}
+
+func (c *lru[K, V]) remove(key K) {
+	if element, ok := c.items[key]; ok {
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+}
+
+func (c *lru[K, V]) clear() {
+	c.order.Init()
+	c.items = map[K]*list.Element{}
+}
+
+func (c *lru[K, V]) len() int {
+	return c.order.Len()
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptRepo keeps failed login counters in Mongo. All writes are single
+// atomic updates so replicas sharing the database see consistent counts.
+type LoginAttemptRepo struct {
+	logger   *log.Logger
+	attempts *mongo.Collection
+}
+
+// NewLoginAttemptRepo uses the login_attempts collection, whose TTL index on
+// expires_at removes documents once the failure window and any lockout passed.
+func NewLoginAttemptRepo(db *mongo.Database, logger *log.Logger) *LoginAttemptRepo {
+	return &LoginAttemptRepo{
+		logger:   logger,
+		attempts: db.Collection("login_attempts"),
+	}
+}
+
+func (repo *LoginAttemptRepo) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	attempt := model.LoginAttempt{}
+	err := repo.attempts.FindOne(ctx, bson.M{"_id": key}).Decode(&attempt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &model.LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The TTL monitor only runs periodically, so treat expired documents as gone.
+	if !attempt.ExpiresAt.IsZero() && attempt.ExpiresAt.Before(time.Now()) {
+		return &model.LoginAttempt{Key: key}, nil
+	}
+	return &attempt, nil
+}
+
+// RecordFailure increments the failure counter of key and returns the updated
+// document. Counters that expired are restarted from one.
+func (repo *LoginAttemptRepo) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*model.LoginAttempt, error) {
+	expired := bson.M{"$lt": []interface{}{"$expires_at", now}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": []interface{}{
+				expired, 1, bson.M{"$add": []interface{}{bson.M{"$ifNull": []interface{}{"$failures", 0}}, 1}},
+			}},
+			"next_attempt_at": bson.M{"$cond": []interface{}{expired, time.Time{}, "$next_attempt_at"}},
+			"locked_until":    bson.M{"$cond": []interface{}{expired, time.Time{}, "$locked_until"}},
+			"last_failure":    now,
+			"expires_at": bson.M{"$max": []interface{}{
+				now.Add(window),
+				bson.M{"$cond": []interface{}{expired, time.Time{}, "$expires_at"}},
+			}},
+		}}},
+	}
+
+	attempt := model.LoginAttempt{}
+	err := repo.attempts.FindOneAndUpdate(ctx, bson.M{"_id": key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	if err != nil {
+		repo.logger.Printf("Failed to record login failure for %s: %v", key, err)
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Block pushes out the earliest time of the next attempt and the lockout end.
+// $max keeps concurrent writers from shortening each other's blocks.
+func (repo *LoginAttemptRepo) Block(ctx context.Context, key string, nextAttemptAt, lockedUntil time.Time) error {
+	_, err := repo.attempts.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$max": bson.M{
+		"next_attempt_at": nextAttemptAt,
+		"locked_until":    lockedUntil,
+		"expires_at":      lockedUntil,
+	}})
+	return err
+}
+
+func (repo *LoginAttemptRepo) Reset(ctx context.Context, key string) error {
+	_, err := repo.attempts.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,17 @@
+package repository_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMongoLoginAttemptStore(t *testing.T) {
+	uri := mongoURI(t)
+	storetest.TestLoginAttemptStore(t, func(t *testing.T) repository.LoginAttemptStore {
+		return repository.NewLoginAttemptRepo(newMongoUserRepo(t, uri).Database(), log.New(io.Discard, "", 0))
+	})
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MicroSOA-09/auth-service/model"
+)
+
+// MemoryAuditStore keeps the audit log in process memory, for tests and
+// local runs.
+type MemoryAuditStore struct {
+	mu      sync.RWMutex
+	entries []model.AuditEntry
+}
+
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{}
+}
+
+func (s *MemoryAuditStore) AppendAudit(ctx context.Context, entry *model.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prev *model.AuditEntry
+	if len(s.entries) > 0 {
+		prev = &s.entries[len(s.entries)-1]
+	}
+	chainAuditEntry(entry, prev)
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *MemoryAuditStore) QueryAudit(ctx context.Context, filter AuditFilter, limit int) ([]model.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []model.AuditEntry{}
+	for i := len(s.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if filter.matches(s.entries[i]) {
+			entries = append(entries, s.entries[i])
+		}
+	}
+	return entries, nil
+}
+
+func (s *MemoryAuditStore) ExportAudit(ctx context.Context, filter AuditFilter, fn func(entry model.AuditEntry) error) error {
+	s.mu.RLock()
+	entries := s.entries
+	s.mu.RUnlock()
+
+	// Entries are never changed, so the snapshot can be read without the lock.
+	for _, entry := range entries {
+		if !filter.matches(entry) {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMemoryAuditStore(t *testing.T) {
+	storetest.TestAuditStore(t, func(t *testing.T) repository.AuditStore {
+		return repository.NewMemoryAuditStore()
+	})
+}
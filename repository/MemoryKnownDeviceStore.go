@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryKnownDeviceStore is a KnownDeviceStore kept in process memory, for
+// tests and local runs.
+type MemoryKnownDeviceStore struct {
+	mu      sync.Mutex
+	devices map[primitive.ObjectID]map[string]model.KnownDevice
+}
+
+func NewMemoryKnownDeviceStore() *MemoryKnownDeviceStore {
+	return &MemoryKnownDeviceStore{devices: map[primitive.ObjectID]map[string]model.KnownDevice{}}
+}
+
+// userDevices returns the devices of userID after dropping the stale ones.
+// The caller holds the lock.
+func (s *MemoryKnownDeviceStore) userDevices(userID primitive.ObjectID) map[string]model.KnownDevice {
+	devices := s.devices[userID]
+	cutoff := time.Now().Add(-knownDeviceRetention)
+	for fingerprint, device := range devices {
+		if device.LastSeenAt.Before(cutoff) {
+			delete(devices, fingerprint)
+		}
+	}
+	return devices
+}
+
+func (s *MemoryKnownDeviceStore) RememberDevice(ctx context.Context, device *model.KnownDevice) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	devices := s.userDevices(device.UserID)
+	if devices == nil {
+		devices = map[string]model.KnownDevice{}
+		s.devices[device.UserID] = devices
+	}
+	existing, known := devices[device.Fingerprint]
+	if known {
+		device.FirstSeenAt = existing.FirstSeenAt
+	}
+	devices[device.Fingerprint] = *device
+	return known, nil
+}
+
+func (s *MemoryKnownDeviceStore) CountDevices(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.userDevices(userID))), nil
+}
+
+func (s *MemoryKnownDeviceStore) ForgetDevices(ctx context.Context, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.devices, userID)
+	return nil
+}
@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMemoryKnownDeviceStore(t *testing.T) {
+	storetest.TestKnownDeviceStore(t, func(t *testing.T) repository.KnownDeviceStore {
+		return repository.NewMemoryKnownDeviceStore()
+	}, anyUser)
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+)
+
+// MemoryLoginAttemptStore is a LoginAttemptStore kept in process memory. It
+// only works for a single instance of the service.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: map[string]model.LoginAttempt{}}
+}
+
+func (s *MemoryLoginAttemptStore) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok || attempt.ExpiresAt.Before(time.Now()) {
+		return &model.LoginAttempt{Key: key}, nil
+	}
+	return &attempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired entries are dropped here, there is no TTL monitor to do it.
+	for k, attempt := range s.attempts {
+		if attempt.ExpiresAt.Before(now) {
+			delete(s.attempts, k)
+		}
+	}
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key}
+	}
+	attempt.Failures++
+	attempt.LastFailure = now
+	if expires := now.Add(window); expires.After(attempt.ExpiresAt) {
+		attempt.ExpiresAt = expires
+	}
+	s.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) Block(ctx context.Context, key string, nextAttemptAt, lockedUntil time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+	if nextAttemptAt.After(attempt.NextAttemptAt) {
+		attempt.NextAttemptAt = nextAttemptAt
+	}
+	if lockedUntil.After(attempt.LockedUntil) {
+		attempt.LockedUntil = lockedUntil
+	}
+	if lockedUntil.After(attempt.ExpiresAt) {
+		attempt.ExpiresAt = lockedUntil
+	}
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
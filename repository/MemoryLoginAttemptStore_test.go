@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMemoryLoginAttemptStore(t *testing.T) {
+	storetest.TestLoginAttemptStore(t, func(t *testing.T) repository.LoginAttemptStore {
+		return repository.NewMemoryLoginAttemptStore()
+	})
+}
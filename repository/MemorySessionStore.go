@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemorySessionStore is a SessionStore kept in process memory, for tests and
+// local runs.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[primitive.ObjectID]model.Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[primitive.ObjectID]model.Session{}}
+}
+
+func cloneSession(session model.Session) *model.Session {
+	session.UsedRefreshTokens = slices.Clone(session.UsedRefreshTokens)
+	return &session
+}
+
+func (s *MemorySessionStore) CreateSession(ctx context.Context, session *model.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired sessions are dropped here, there is no TTL monitor to do it.
+	now := time.Now()
+	for id, existing := range s.sessions {
+		if !existing.ExpiresAt.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	s.sessions[session.ID] = *cloneSession(*session)
+	return nil
+}
+
+// live returns the session with id unless it is missing or expired. The
+// caller holds the lock.
+func (s *MemorySessionStore) live(id primitive.ObjectID, now time.Time) (model.Session, bool) {
+	session, ok := s.sessions[id]
+	return session, ok && session.ExpiresAt.After(now)
+}
+
+func (s *MemorySessionStore) GetSession(ctx context.Context, id primitive.ObjectID) (*model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.live(id, time.Now())
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return cloneSession(session), nil
+}
+
+// userSessions returns the live sessions of userID, most recently seen
+// first. The caller holds the lock.
+func (s *MemorySessionStore) userSessions(userID primitive.ObjectID, now time.Time) []model.Session {
+	sessions := []model.Session{}
+	for id, session := range s.sessions {
+		if _, ok := s.live(id, now); ok && session.UserID == userID {
+			sessions = append(sessions, *cloneSession(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		}
+		return sessions[i].ID.Hex() > sessions[j].ID.Hex()
+	})
+	return sessions
+}
+
+func (s *MemorySessionStore) ListSessions(ctx context.Context, userID primitive.ObjectID) ([]model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userSessions(userID, time.Now()), nil
+}
+
+func (s *MemorySessionStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, now, expiresAt time.Time, ip string) (*model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.RefreshTokenHash == oldHash {
+			if _, ok := s.live(id, now); !ok {
+				return nil, ErrRefreshTokenInvalid
+			}
+			session.UsedRefreshTokens = rotatedRefreshTokens(session.UsedRefreshTokens, oldHash)
+			session.RefreshTokenHash = newHash
+			session.LastSeenAt, session.ExpiresAt, session.IP = now, expiresAt, ip
+			s.sessions[id] = session
+			return cloneSession(session), nil
+		}
+		if slices.Contains(session.UsedRefreshTokens, oldHash) {
+			delete(s.sessions, id)
+			return nil, ErrRefreshTokenReused
+		}
+	}
+	return nil, ErrRefreshTokenInvalid
+}
+
+func (s *MemorySessionStore) TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.live(id, now)
+	if ok && session.LastSeenAt.Before(now.Add(-sessionTouchInterval)) {
+		session.LastSeenAt, session.IP = now, ip
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteSession(ctx context.Context, userID, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.live(id, time.Now())
+	if !ok || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteSessions(ctx context.Context, userID, keep primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for _, session := range s.userSessions(userID, time.Now()) {
+		if session.ID != keep {
+			delete(s.sessions, session.ID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemorySessionStore) EvictSessions(ctx context.Context, userID primitive.ObjectID, max int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := s.userSessions(userID, time.Now())
+	if len(sessions) <= max {
+		return 0, nil
+	}
+	for _, session := range sessions[max:] {
+		delete(s.sessions, session.ID)
+	}
+	return int64(len(sessions) - max), nil
+}
@@ -0,0 +1,20 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// anyUser stands in for stores that don't check the user exists.
+func anyUser(t *testing.T) primitive.ObjectID {
+	return primitive.NewObjectID()
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	storetest.TestSessionStore(t, func(t *testing.T) repository.SessionStore {
+		return repository.NewMemorySessionStore()
+	}, anyUser)
+}
@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryUserStore is a UserStore kept in process memory, for tests and local
+// runs without a database. Values are copied in and out so callers can't
+// modify stored records.
+type MemoryUserStore struct {
+	mu      sync.RWMutex
+	users   map[primitive.ObjectID]model.User
+	persons map[primitive.ObjectID]model.Person
+	// outbox holds events in insertion order, which is also ID order.
+	outbox []model.Event
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users:   map[primitive.ObjectID]model.User{},
+		persons: map[primitive.ObjectID]model.Person{},
+	}
+}
+
+func (s *MemoryUserStore) GetAll(ctx context.Context) ([]model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []model.User{}
+	for _, user := range s.users {
+		if user.IsActive {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryUserStore) GetUser(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok || !user.IsActive {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryUserStore) GetUserIncludingInactive(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryUserStore) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	canonical, err := CanonicalUsername(username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.UsernameCanonical == canonical {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *MemoryUserStore) GetUserByIds(ctx context.Context, ids []primitive.ObjectID) ([]model.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[primitive.ObjectID]struct{}, len(ids))
+	users := []model.User{}
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		if user, ok := s.users[id]; ok && user.IsActive {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryUserStore) GetPersonsByUserIds(ctx context.Context, userIDs []primitive.ObjectID) ([]model.Person, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[primitive.ObjectID]struct{}, len(userIDs))
+	persons := []model.Person{}
+	for _, id := range userIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		if person, ok := s.persons[id]; ok {
+			persons = append(persons, person)
+		}
+	}
+	return persons, nil
+}
+
+func (s *MemoryUserStore) GetPerson(ctx context.Context, userID primitive.ObjectID) (*model.Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	person, ok := s.persons[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &person, nil
+}
+
+func (s *MemoryUserStore) GetPersonByEmail(ctx context.Context, email string) (*model.Person, error) {
+	canonical := CanonicalEmail(email)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, person := range s.persons {
+		if person.EmailCanonical == canonical {
+			return &person, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *MemoryUserStore) CreateUser(ctx context.Context, user *model.User, person *model.Person, events ...model.Event) error {
+	usernameCanonical, err := CanonicalUsername(user.Username)
+	if err != nil {
+		return err
+	}
+	emailCanonical := CanonicalEmail(person.Email)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.UsernameCanonical == usernameCanonical {
+			return ErrDuplicateUser
+		}
+	}
+	for _, existing := range s.persons {
+		if existing.EmailCanonical == emailCanonical {
+			return ErrDuplicateUser
+		}
+	}
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	user.UsernameCanonical = usernameCanonical
+	user.IsActive = false
+	person.ID = primitive.NewObjectID()
+	person.UserID = user.ID
+	person.EmailCanonical = emailCanonical
+
+	s.users[user.ID] = *user
+	s.persons[user.ID] = *person
+	s.appendEvents(events)
+	return nil
+}
+
+// appendEvents adds events to the outbox. The caller holds the write lock.
+func (s *MemoryUserStore) appendEvents(events []model.Event) {
+	prepareEvents(events, time.Now())
+	s.outbox = append(s.outbox, events...)
+}
+
+func (s *MemoryUserStore) SetUserActive(ctx context.Context, id primitive.ObjectID, active bool, events ...model.Event) (bool, error) {
+	changed := false
+	err := s.update(id, func(user *model.User) bool {
+		changed = user.IsActive != active
+		user.IsActive = active
+		return changed
+	}, events...)
+	return changed, err
+}
+
+func (s *MemoryUserStore) SetUserRole(ctx context.Context, id primitive.ObjectID, role model.UserRole, events ...model.Event) (bool, error) {
+	changed := false
+	err := s.update(id, func(user *model.User) bool {
+		changed = user.Role != role
+		user.Role = role
+		return changed
+	}, events...)
+	return changed, err
+}
+
+func (s *MemoryUserStore) UpdatePerson(ctx context.Context, person *model.Person, events ...model.Event) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.persons[person.UserID]
+	if !ok {
+		return false, ErrUserNotFound
+	}
+	updated := stored
+	updated.FirstName = person.FirstName
+	updated.LastName = person.LastName
+	updated.ProfileImage = person.ProfileImage
+	updated.Locale = person.Locale
+	if updated == stored {
+		return false, nil
+	}
+	s.persons[person.UserID] = updated
+	s.appendEvents(events)
+	return true, nil
+}
+
+func (s *MemoryUserStore) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	return s.update(id, func(user *model.User) bool {
+		user.PasswordHash = passwordHash
+		return true
+	})
+}
+
+func (s *MemoryUserStore) ReplacePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) (bool, error) {
+	replaced := false
+	err := s.update(id, func(user *model.User) bool {
+		if user.PasswordHash != oldHash {
+			return false
+		}
+		user.PasswordHash = newHash
+		replaced = true
+		return true
+	})
+	if err == ErrUserNotFound {
+		return false, nil
+	}
+	return replaced, err
+}
+
+// update applies fn to the user with id under the write lock. If fn returns
+// true the result is stored and events are added to the outbox.
+func (s *MemoryUserStore) update(id primitive.ObjectID, fn func(user *model.User) bool, events ...model.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if fn(&user) {
+		s.users[id] = user
+		s.appendEvents(events)
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) ClaimEvent(ctx context.Context, now time.Time, lease time.Duration) (*model.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.outbox {
+		event := &s.outbox[i]
+		if event.Published || event.NextAttemptAt.After(now) {
+			continue
+		}
+		event.NextAttemptAt = now.Add(lease)
+		event.Attempts++
+		claimed := *event
+		return &claimed, nil
+	}
+	return nil, nil
+}
+
+func (s *MemoryUserStore) MarkPublished(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Published events are only kept for publishedEventRetention, like the
+	// TTL index does in Mongo.
+	kept := s.outbox[:0]
+	for _, event := range s.outbox {
+		if event.ID == id {
+			event.Published = true
+			event.PublishedAt = &at
+			event.LastError = ""
+		}
+		if event.Published && at.Sub(*event.PublishedAt) > publishedEventRetention {
+			continue
+		}
+		kept = append(kept, event)
+	}
+	s.outbox = kept
+	return nil
+}
+
+func (s *MemoryUserStore) RetryEvent(ctx context.Context, id primitive.ObjectID, nextAttemptAt time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.outbox {
+		if s.outbox[i].ID == id {
+			s.outbox[i].NextAttemptAt = nextAttemptAt
+			s.outbox[i].LastError = lastError
+		}
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) Disconnect(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMemoryUserStore(t *testing.T) {
+	storetest.TestUserStore(t, func(t *testing.T) repository.UserStore {
+		return repository.NewMemoryUserStore()
+	})
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryWebhookStore is a WebhookStore kept in process memory, for tests and
+// local runs.
+type MemoryWebhookStore struct {
+	mu       sync.Mutex
+	webhooks map[primitive.ObjectID]model.Webhook
+	// deliveries are kept in insertion order, which is also ID order.
+	deliveries []model.WebhookDelivery
+}
+
+func NewMemoryWebhookStore() *MemoryWebhookStore {
+	return &MemoryWebhookStore{webhooks: map[primitive.ObjectID]model.Webhook{}}
+}
+
+func (s *MemoryWebhookStore) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	stored := *webhook
+	stored.Events = slices.Clone(webhook.Events)
+	s.webhooks[webhook.ID] = stored
+	return nil
+}
+
+func (s *MemoryWebhookStore) GetWebhook(ctx context.Context, id primitive.ObjectID) (*model.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	webhook.Events = slices.Clone(webhook.Events)
+	return &webhook, nil
+}
+
+func (s *MemoryWebhookStore) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := []model.Webhook{}
+	for _, webhook := range s.webhooks {
+		webhook.Events = slices.Clone(webhook.Events)
+		webhooks = append(webhooks, webhook)
+	}
+	slices.SortFunc(webhooks, func(a, b model.Webhook) int { return bytes.Compare(a.ID[:], b.ID[:]) })
+	return webhooks, nil
+}
+
+func (s *MemoryWebhookStore) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.webhooks, id)
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d model.WebhookDelivery) bool { return d.WebhookID == id })
+	return nil
+}
+
+func (s *MemoryWebhookStore) EnqueueDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	now := time.Now()
+	prepareDeliveries(deliveries, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Old deliveries are dropped here, there is no TTL monitor to do it.
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d model.WebhookDelivery) bool {
+		return d.Status != model.DeliveryPending && now.Sub(d.UpdatedAt) > deliveryRetention
+	})
+	for _, delivery := range deliveries {
+		if slices.ContainsFunc(s.deliveries, func(d model.WebhookDelivery) bool {
+			return d.WebhookID == delivery.WebhookID && d.EventID == delivery.EventID
+		}) {
+			continue
+		}
+		s.deliveries = append(s.deliveries, delivery)
+	}
+	return nil
+}
+
+func (s *MemoryWebhookStore) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*model.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.deliveries {
+		delivery := &s.deliveries[i]
+		if delivery.Status != model.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		delivery.NextAttemptAt = now.Add(lease)
+		delivery.Attempts++
+		return cloneDelivery(*delivery), nil
+	}
+	return nil, nil
+}
+
+func (s *MemoryWebhookStore) RecordAttempt(ctx context.Context, id primitive.ObjectID, attempt model.DeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(id)
+	if i < 0 {
+		return ErrDeliveryNotFound
+	}
+	delivery := &s.deliveries[i]
+	delivery.Log = append(delivery.Log, attempt)
+	if len(delivery.Log) > maxDeliveryLog {
+		delivery.Log = slices.Clone(delivery.Log[len(delivery.Log)-maxDeliveryLog:])
+	}
+	delivery.Status = status
+	delivery.NextAttemptAt = nextAttemptAt
+	delivery.UpdatedAt = attempt.At
+	return nil
+}
+
+func (s *MemoryWebhookStore) ListDeliveries(ctx context.Context, webhookID primitive.ObjectID, limit int) ([]model.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []model.WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if s.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, *cloneDelivery(s.deliveries[i]))
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryWebhookStore) ReplayDelivery(ctx context.Context, id primitive.ObjectID, now time.Time) (*model.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(id)
+	if i < 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	delivery := &s.deliveries[i]
+	delivery.Status = model.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	delivery.UpdatedAt = now
+	return cloneDelivery(*delivery), nil
+}
+
+func (s *MemoryWebhookStore) indexOf(id primitive.ObjectID) int {
+	return slices.IndexFunc(s.deliveries, func(d model.WebhookDelivery) bool { return d.ID == id })
+}
+
+func cloneDelivery(delivery model.WebhookDelivery) *model.WebhookDelivery {
+	delivery.Log = slices.Clone(delivery.Log)
+	return &delivery
+}
@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMemoryWebhookStore(t *testing.T) {
+	storetest.TestWebhookStore(t, func(t *testing.T) repository.WebhookStore {
+		return repository.NewMemoryWebhookStore()
+	})
+}
@@ -0,0 +1,376 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigrations lists the schema changes of the auth database in version
+// order. Applied migrations must never be edited, add a new one instead.
+var mongoMigrations = []MongoMigration{
+	{
+		Version: 1,
+		Name:    "create_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Creating an index that exists with the same options is a no-op,
+			// so databases set up before migrations existed pass too.
+			_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true),
+			})
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection("persons").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+			})
+			if err != nil {
+				return err
+			}
+			for _, collection := range []string{"login_attempts", "rate_limits"} {
+				_, err := db.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			drops := []struct{ collection, index string }{
+				{"users", "username_1"},
+				{"persons", "user_id_1"},
+				{"persons", "email_1"},
+				{"login_attempts", "expires_at_1"},
+				{"rate_limits", "expires_at_1"},
+			}
+			for _, drop := range drops {
+				if _, err := db.Collection(drop.collection).Indexes().DropOne(ctx, drop.index); err != nil && !isNamespaceNotFound(err) {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "backfill_role_and_is_active",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+			if _, err := users.UpdateMany(ctx,
+				bson.M{"role": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"role": model.RoleTourist}},
+			); err != nil {
+				return err
+			}
+			_, err := users.UpdateMany(ctx,
+				bson.M{"is_active": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"is_active": false}},
+			)
+			return err
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_schema_validators",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := setValidator(ctx, db, "users", usersSchema); err != nil {
+				return err
+			}
+			return setValidator(ctx, db, "persons", personsSchema)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := setValidator(ctx, db, "users", bson.M{}); err != nil {
+				return err
+			}
+			return setValidator(ctx, db, "persons", bson.M{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "canonical_username_and_email",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := backfillCanonical(ctx, db.Collection("users"), "username", "username_canonical", CanonicalUsername); err != nil {
+				return err
+			}
+			canonicalEmail := func(email string) (string, error) { return CanonicalEmail(email), nil }
+			if err := backfillCanonical(ctx, db.Collection("persons"), "email", "email_canonical", canonicalEmail); err != nil {
+				return err
+			}
+
+			_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "username_canonical", Value: 1}},
+				Options: options.Index().SetUnique(true).SetCollation(canonicalCollation),
+			})
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection("persons").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "email_canonical", Value: 1}},
+				Options: options.Index().SetUnique(true).SetCollation(canonicalCollation),
+			})
+			if err != nil {
+				return err
+			}
+
+			if err := setValidator(ctx, db, "users", requireFields(usersSchema, "username_canonical")); err != nil {
+				return err
+			}
+			return setValidator(ctx, db, "persons", requireFields(personsSchema, "email_canonical"))
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := setValidator(ctx, db, "users", usersSchema); err != nil {
+				return err
+			}
+			if err := setValidator(ctx, db, "persons", personsSchema); err != nil {
+				return err
+			}
+			drops := []struct{ collection, index, field string }{
+				{"users", "username_canonical_1", "username_canonical"},
+				{"persons", "email_canonical_1", "email_canonical"},
+			}
+			for _, drop := range drops {
+				if _, err := db.Collection(drop.collection).Indexes().DropOne(ctx, drop.index); err != nil && !isNamespaceNotFound(err) {
+					return err
+				}
+				if _, err := db.Collection(drop.collection).UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{drop.field: ""}}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_outbox",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Collections cannot be created implicitly inside a transaction on
+			// older servers, and the outbox is only written in transactions.
+			if err := db.CreateCollection(ctx, "outbox"); err != nil && !isNamespaceExists(err) {
+				return err
+			}
+			_, err := db.Collection("outbox").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "published", Value: 1}, {Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}},
+				{
+					Keys:    bson.D{{Key: "published_at", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(int32(publishedEventRetention.Seconds())),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("outbox").Drop(ctx)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_webhooks",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("webhook_deliveries").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+				{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}},
+				{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := db.Collection("webhook_deliveries").Drop(ctx); err != nil {
+				return err
+			}
+			return db.Collection("webhooks").Drop(ctx)
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_audit_log",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("audit_log").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "seq", Value: -1}}},
+				{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "seq", Value: -1}}},
+				{Keys: bson.D{{Key: "action", Value: 1}, {Key: "seq", Value: -1}}},
+				{Keys: bson.D{{Key: "time", Value: 1}}},
+			})
+			return err
+		},
+		// Down keeps the entries, only the indexes are dropped.
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("audit_log").Indexes().DropAll(ctx)
+			if isNamespaceNotFound(err) {
+				return nil
+			}
+			return err
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create_sessions",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("sessions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "refresh_token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "used_refresh_tokens", Value: 1}}},
+				{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+				{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("sessions").Drop(ctx)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create_known_devices",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("known_devices").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "fingerprint", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+				{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("known_devices").Drop(ctx)
+		},
+	},
+}
+
+var usersSchema = bson.M{"$jsonSchema": bson.M{
+	"bsonType": "object",
+	"required": bson.A{"_id", "username", "password_hash", "role", "is_active"},
+	"properties": bson.M{
+		"_id":           bson.M{"bsonType": "objectId"},
+		"username":      bson.M{"bsonType": "string", "minLength": 1},
+		"password_hash": bson.M{"bsonType": "string", "minLength": 1},
+		"role":          bson.M{"enum": bson.A{model.RoleAdmin, model.RoleAuthor, model.RoleTourist}},
+		"is_active":     bson.M{"bsonType": "bool"},
+	},
+}}
+
+var personsSchema = bson.M{"$jsonSchema": bson.M{
+	"bsonType": "object",
+	"required": bson.A{"_id", "user_id", "email"},
+	"properties": bson.M{
+		"_id":           bson.M{"bsonType": "objectId"},
+		"user_id":       bson.M{"bsonType": "objectId"},
+		"first_name":    bson.M{"bsonType": "string"},
+		"last_name":     bson.M{"bsonType": "string"},
+		"email":         bson.M{"bsonType": "string", "minLength": 3},
+		"profile_image": bson.M{"bsonType": "string"},
+		"locale":        bson.M{"bsonType": "string"},
+	},
+}}
+
+// requireFields returns a copy of a $jsonSchema validator that additionally
+// requires the given string fields.
+func requireFields(validator bson.M, fields ...string) bson.M {
+	schema := validator["$jsonSchema"].(bson.M)
+	required := append(bson.A{}, schema["required"].(bson.A)...)
+	properties := bson.M{}
+	for key, value := range schema["properties"].(bson.M) {
+		properties[key] = value
+	}
+	for _, field := range fields {
+		required = append(required, field)
+		properties[field] = bson.M{"bsonType": "string", "minLength": 1}
+	}
+
+	extended := bson.M{}
+	for key, value := range schema {
+		extended[key] = value
+	}
+	extended["required"] = required
+	extended["properties"] = properties
+	return bson.M{"$jsonSchema": extended}
+}
+
+// backfillCanonical stores canonicalize(field) in canonicalField of every
+// document. It fails without writing anything if two documents share a
+// canonical value, those have to be resolved by hand first.
+func backfillCanonical(ctx context.Context, collection *mongo.Collection, field, canonicalField string, canonicalize func(string) (string, error)) error {
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{field: 1}))
+	if err != nil {
+		return err
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+
+	owners := map[string][]string{}
+	updates := make([]mongo.WriteModel, 0, len(docs))
+	var problems []string
+	for _, doc := range docs {
+		value, _ := doc[field].(string)
+		canonical, err := canonicalize(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q of %v cannot be canonicalized", field, value, doc["_id"]))
+			continue
+		}
+		owners[canonical] = append(owners[canonical], value)
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc["_id"]}).
+			SetUpdate(bson.M{"$set": bson.M{canonicalField: canonical}}))
+	}
+	for canonical, values := range owners {
+		if len(values) > 1 {
+			problems = append(problems, fmt.Sprintf("%s collision on %q: %s", field, canonical, strings.Join(values, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%d %s value(s) must be fixed before migrating:\n%s", len(problems), field, strings.Join(problems, "\n"))
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+	_, err = collection.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// setValidator replaces the validator of a collection, creating the
+// collection if it doesn't exist yet. An empty validator removes it.
+func setValidator(ctx context.Context, db *mongo.Database, collection string, validator bson.M) error {
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": collection})
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return db.CreateCollection(ctx, collection, options.CreateCollection().SetValidator(validator))
+	}
+	return db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "strict"},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+}
+
+// isNamespaceExists reports whether err says the collection to create exists.
+func isNamespaceExists(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 48
+}
+
+// isNamespaceNotFound reports whether err says the collection or index to
+// drop doesn't exist, which leaves nothing to revert.
+func isNamespaceNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 26 || cmdErr.Code == 27)
+}
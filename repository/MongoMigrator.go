@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	migrationLockID    = "migrations"
+	migrationLockLease = 5 * time.Minute
+)
+
+var ErrMigrationLocked = errors.New("migrations are locked by another process")
+
+// MongoMigration is one versioned schema change. Down may be nil when there
+// is nothing to undo, e.g. for a backfill of default values.
+type MongoMigration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// MongoMigrator applies mongoMigrations and records them in the migrations
+// collection. A lease in migration_lock keeps replicas that start together
+// from running the same migration twice.
+type MongoMigrator struct {
+	db         *mongo.Database
+	logger     *log.Logger
+	migrations []MongoMigration
+	applied    *mongo.Collection
+	lock       *mongo.Collection
+}
+
+func NewMongoMigrator(db *mongo.Database, logger *log.Logger) *MongoMigrator {
+	return &MongoMigrator{
+		db:         db,
+		logger:     logger,
+		migrations: mongoMigrations,
+		applied:    db.Collection("migrations"),
+		lock:       db.Collection("migration_lock"),
+	}
+}
+
+// Up applies all pending migrations in version order.
+func (m *MongoMigrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		applied, err := m.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := migration.Up(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			_, err := m.applied.InsertOne(ctx, appliedMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()})
+			if err != nil {
+				return err
+			}
+			m.logger.Printf("Applied migration %d %s", migration.Version, migration.Name)
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *MongoMigrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func() error {
+		applied, err := m.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down != nil {
+				if err := migration.Down(ctx, m.db); err != nil {
+					return fmt.Errorf("reverting migration %d %s: %w", migration.Version, migration.Name, err)
+				}
+			}
+			if _, err := m.applied.DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+				return err
+			}
+			m.logger.Printf("Reverted migration %d %s", migration.Version, migration.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+func (m *MongoMigrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		record, ok := applied[migration.Version]
+		statuses[i] = MigrationStatus{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: record.AppliedAt,
+		}
+	}
+	return statuses, nil
+}
+
+func (m *MongoMigrator) appliedVersions(ctx context.Context) (map[int]appliedMigration, error) {
+	cursor, err := m.applied.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []appliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]appliedMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// locked runs fn while holding the migration lock, waiting for another
+// holder until ctx is done. The lease expires on its own if a process dies
+// while migrating.
+func (m *MongoMigrator) locked(ctx context.Context, fn func() error) error {
+	owner := make([]byte, 8)
+	if _, err := rand.Read(owner); err != nil {
+		return err
+	}
+	ownerID := hex.EncodeToString(owner)
+
+	for {
+		acquired, err := m.acquire(ctx, ownerID)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+		m.logger.Printf("Waiting for the migration lock")
+		select {
+		case <-ctx.Done():
+			return ErrMigrationLocked
+		case <-time.After(time.Second):
+		}
+	}
+	defer m.lock.DeleteOne(context.Background(), bson.M{"_id": migrationLockID, "owner": ownerID})
+
+	return fn()
+}
+
+func (m *MongoMigrator) acquire(ctx context.Context, owner string) (bool, error) {
+	now := time.Now()
+	// The upsert only matches a free lock; if another process holds it the
+	// insert of a second document with the same _id fails.
+	_, err := m.lock.UpdateOne(ctx,
+		bson.M{"_id": migrationLockID, "locked_until": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"owner": owner, "locked_until": now.Add(migrationLockLease)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+)
+
+var mongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "auth",
+	Subsystem: "mongo",
+	Name:      "command_duration_seconds",
+	Help:      "Duration of Mongo commands by command, collection and outcome: success or failure.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"command", "collection", "outcome"})
+
+// newMongoMonitor times and traces every command sent over the client, so
+// the repositories sharing the connection are covered without wrapping each
+// of their methods.
+func newMongoMonitor() *event.CommandMonitor {
+	tracing := otelmongo.NewMonitor()
+	// The finished events don't name the collection, it is kept from the
+	// started event until then.
+	var collections sync.Map
+	finished := func(e event.CommandFinishedEvent, outcome string) {
+		collection, _ := collections.LoadAndDelete(e.RequestID)
+		name, _ := collection.(string)
+		mongoCommandDuration.WithLabelValues(e.CommandName, name, outcome).Observe(e.Duration.Seconds())
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			tracing.Started(ctx, e)
+			field := e.CommandName
+			if field == "getMore" {
+				field = "collection"
+			}
+			// Commands that don't work on a collection carry a number here.
+			collection, _ := e.Command.Lookup(field).StringValueOK()
+			collections.Store(e.RequestID, collection)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			tracing.Succeeded(ctx, e)
+			finished(e.CommandFinishedEvent, "success")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			tracing.Failed(ctx, e)
+			finished(e.CommandFinishedEvent, "failure")
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxStore hands the events written together with user changes to the
+// relay. Events stay in the outbox until they were published successfully.
+type OutboxStore interface {
+	// ClaimEvent returns the oldest unpublished event that is due and hides it
+	// from other relays for lease. It returns nil if no event is due.
+	ClaimEvent(ctx context.Context, now time.Time, lease time.Duration) (*model.Event, error)
+	MarkPublished(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	RetryEvent(ctx context.Context, id primitive.ObjectID, nextAttemptAt time.Time, lastError string) error
+}
+
+// publishedEventRetention is how long published events are kept for debugging.
+const publishedEventRetention = 7 * 24 * time.Hour
+
+var (
+	_ OutboxStore = (*UserRepo)(nil)
+	_ OutboxStore = (*MemoryUserStore)(nil)
+	_ OutboxStore = (*PostgresUserStore)(nil)
+)
+
+// prepareEvents fills in the outbox bookkeeping of new events.
+func prepareEvents(events []model.Event, now time.Time) {
+	for i := range events {
+		if events[i].ID.IsZero() {
+			events[i].ID = primitive.NewObjectID()
+		}
+		if events[i].OccurredAt.IsZero() {
+			events[i].OccurredAt = now
+		}
+		events[i].NextAttemptAt = now
+	}
+}
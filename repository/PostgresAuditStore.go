@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// postgresAuditLock is the advisory lock key that serializes appends.
+const postgresAuditLock = 0x61756474 // "audt"
+
+const auditColumns = "seq, id, time, action, result, actor_id, actor_name, target_id, ip, user_agent, request_id, details, prev_hash, hash"
+
+// PostgresAuditStore keeps the audit log in PostgreSQL. A trigger rejects
+// updates and deletes of the table.
+type PostgresAuditStore struct {
+	pool   *pgxpool.Pool
+	logger *log.Logger
+}
+
+func NewPostgresAuditStore(pool *pgxpool.Pool, logger *log.Logger) *PostgresAuditStore {
+	return &PostgresAuditStore{pool: pool, logger: logger}
+}
+
+func scanAuditEntry(row pgx.Row) (*model.AuditEntry, error) {
+	var entry model.AuditEntry
+	var id string
+	err := row.Scan(&entry.Seq, &id, &entry.Time, &entry.Action, &entry.Result, &entry.ActorID, &entry.ActorName,
+		&entry.TargetID, &entry.IP, &entry.UserAgent, &entry.RequestID, &entry.Details, &entry.PrevHash, &entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if entry.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *PostgresAuditStore) AppendAudit(ctx context.Context, entry *model.AuditEntry) error {
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", postgresAuditLock); err != nil {
+			return err
+		}
+		prev, err := scanAuditEntry(tx.QueryRow(ctx, "SELECT "+auditColumns+" FROM audit_log ORDER BY seq DESC LIMIT 1"))
+		if errors.Is(err, pgx.ErrNoRows) {
+			prev, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		chainAuditEntry(entry, prev)
+		_, err = tx.Exec(ctx, "INSERT INTO audit_log ("+auditColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)",
+			entry.Seq, entry.ID.Hex(), entry.Time, entry.Action, entry.Result, entry.ActorID, entry.ActorName,
+			entry.TargetID, entry.IP, entry.UserAgent, entry.RequestID, entry.Details, entry.PrevHash, entry.Hash)
+		return err
+	})
+	if err != nil {
+		s.logger.Printf("Failed to append %s audit entry: %v", entry.Action, err)
+	}
+	return err
+}
+
+func auditWhere(filter AuditFilter) (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.UserID != "" {
+		add("(actor_id = $%[1]d OR target_id = $%[1]d)", filter.UserID)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		add("time >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("time < $%d", filter.To)
+	}
+	if filter.BeforeSeq != 0 {
+		add("seq < $%d", filter.BeforeSeq)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *PostgresAuditStore) QueryAudit(ctx context.Context, filter AuditFilter, limit int) ([]model.AuditEntry, error) {
+	where, args := auditWhere(filter)
+	args = append(args, limit)
+	rows, err := s.pool.Query(ctx, fmt.Sprintf("SELECT %s FROM audit_log%s ORDER BY seq DESC LIMIT $%d", auditColumns, where, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *PostgresAuditStore) ExportAudit(ctx context.Context, filter AuditFilter, fn func(entry model.AuditEntry) error) error {
+	where, args := auditWhere(filter)
+	rows, err := s.pool.Query(ctx, "SELECT "+auditColumns+" FROM audit_log"+where+" ORDER BY seq", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(*entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PostgresKnownDeviceStore is a KnownDeviceStore backed by PostgreSQL. Stale
+// devices of a user are purged when the user logs in.
+type PostgresKnownDeviceStore struct {
+	pool   *pgxpool.Pool
+	logger *log.Logger
+}
+
+func NewPostgresKnownDeviceStore(pool *pgxpool.Pool, logger *log.Logger) *PostgresKnownDeviceStore {
+	return &PostgresKnownDeviceStore{pool: pool, logger: logger}
+}
+
+func (s *PostgresKnownDeviceStore) RememberDevice(ctx context.Context, device *model.KnownDevice) (bool, error) {
+	var known bool
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM known_devices WHERE user_id = $1 AND last_seen_at < $2",
+			device.UserID.Hex(), time.Now().Add(-knownDeviceRetention))
+		if err != nil {
+			return err
+		}
+		// xmax is zero for freshly inserted rows.
+		return tx.QueryRow(ctx, `INSERT INTO known_devices (user_id, fingerprint, device, location, ip, first_seen_at, last_seen_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (user_id, fingerprint) DO UPDATE
+			SET device = EXCLUDED.device, location = EXCLUDED.location, ip = EXCLUDED.ip, last_seen_at = EXCLUDED.last_seen_at
+			RETURNING xmax <> 0, first_seen_at`,
+			device.UserID.Hex(), device.Fingerprint, device.Device, device.Location, device.IP, device.FirstSeenAt, device.LastSeenAt,
+		).Scan(&known, &device.FirstSeenAt)
+	})
+	if err != nil {
+		s.logger.Printf("Failed to remember device of %s: %v", device.UserID.Hex(), err)
+		return false, err
+	}
+	return known, nil
+}
+
+func (s *PostgresKnownDeviceStore) CountDevices(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	var count int64
+	err := s.pool.QueryRow(ctx, "SELECT count(*) FROM known_devices WHERE user_id = $1 AND last_seen_at >= $2",
+		userID.Hex(), time.Now().Add(-knownDeviceRetention)).Scan(&count)
+	return count, err
+}
+
+func (s *PostgresKnownDeviceStore) ForgetDevices(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM known_devices WHERE user_id = $1", userID.Hex())
+	return err
+}
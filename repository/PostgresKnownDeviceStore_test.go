@@ -0,0 +1,19 @@
+package repository_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestPostgresKnownDeviceStore(t *testing.T) {
+	dsn := postgresDSN(t)
+	users := &postgresUsers{}
+	storetest.TestKnownDeviceStore(t, func(t *testing.T) repository.KnownDeviceStore {
+		users.pool = newPostgresPool(t, dsn)
+		return repository.NewPostgresKnownDeviceStore(users.pool, log.New(io.Discard, "", 0))
+	}, users.newUser)
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const loginAttemptColumns = "key, failures, last_failure, next_attempt_at, locked_until, expires_at"
+
+// PostgresLoginAttemptStore keeps failed login counters in PostgreSQL. Like
+// LoginAttemptRepo every change is a single statement, so replicas sharing
+// the database see consistent counts.
+type PostgresLoginAttemptStore struct {
+	pool   *pgxpool.Pool
+	logger *log.Logger
+}
+
+func NewPostgresLoginAttemptStore(pool *pgxpool.Pool, logger *log.Logger) *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{pool: pool, logger: logger}
+}
+
+func scanLoginAttempt(row pgx.Row) (*model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	err := row.Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailure, &attempt.NextAttemptAt, &attempt.LockedUntil, &attempt.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (s *PostgresLoginAttemptStore) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	attempt, err := scanLoginAttempt(s.pool.QueryRow(ctx,
+		"SELECT "+loginAttemptColumns+" FROM login_attempts WHERE key = $1 AND expires_at >= $2", key, time.Now()))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &model.LoginAttempt{Key: key}, nil
+	}
+	return attempt, err
+}
+
+// RecordFailure increments the failure counter of key and returns the updated
+// row. Expired counters restart from one; other expired rows are removed on
+// the way since Postgres has no TTL index.
+func (s *PostgresLoginAttemptStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*model.LoginAttempt, error) {
+	attempt, err := scanLoginAttempt(s.pool.QueryRow(ctx, `
+		WITH swept AS (
+			DELETE FROM login_attempts WHERE expires_at < $2 AND key <> $1
+		)
+		INSERT INTO login_attempts AS a (`+loginAttemptColumns+`)
+		VALUES ($1, 1, $2, $4, $4, $3)
+		ON CONFLICT (key) DO UPDATE SET
+			failures        = CASE WHEN a.expires_at < $2 THEN 1 ELSE a.failures + 1 END,
+			next_attempt_at = CASE WHEN a.expires_at < $2 THEN $4 ELSE a.next_attempt_at END,
+			locked_until    = CASE WHEN a.expires_at < $2 THEN $4 ELSE a.locked_until END,
+			last_failure    = $2,
+			expires_at      = CASE WHEN a.expires_at < $2 THEN $3 ELSE GREATEST(a.expires_at, $3) END
+		RETURNING `+loginAttemptColumns,
+		key, now, now.Add(window), time.Time{}))
+	if err != nil {
+		s.logger.Printf("Failed to record login failure for %s: %v", key, err)
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// Block pushes out the earliest time of the next attempt and the lockout end.
+// GREATEST keeps concurrent writers from shortening each other's blocks.
+func (s *PostgresLoginAttemptStore) Block(ctx context.Context, key string, nextAttemptAt, lockedUntil time.Time) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE login_attempts SET
+			next_attempt_at = GREATEST(next_attempt_at, $2),
+			locked_until    = GREATEST(locked_until, $3),
+			expires_at      = GREATEST(expires_at, $3)
+		WHERE key = $1`,
+		key, nextAttemptAt, lockedUntil)
+	return err
+}
+
+func (s *PostgresLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
@@ -0,0 +1,17 @@
+package repository_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestPostgresLoginAttemptStore(t *testing.T) {
+	dsn := postgresDSN(t)
+	storetest.TestLoginAttemptStore(t, func(t *testing.T) repository.LoginAttemptStore {
+		return repository.NewPostgresLoginAttemptStore(newPostgresPool(t, dsn), log.New(io.Discard, "", 0))
+	})
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresMigrationLock is the advisory lock key that keeps replicas starting
+// at the same time from applying migrations twice.
+const postgresMigrationLock = 0x61757468 // "auth"
+
+// postgresMigration is either an embedded SQL file or, for changes SQL can't
+// express such as PRECIS canonicalization, a function in postgresCodeMigrations.
+type postgresMigration struct {
+	version int
+	name    string
+	sql     string
+	run     func(ctx context.Context, tx pgx.Tx) error
+}
+
+var postgresCodeMigrations = []postgresMigration{
+	{version: 3, name: "0003_canonical_username_and_email", run: migrateCanonicalNames},
+}
+
+func loadPostgresMigrations() ([]postgresMigration, error) {
+	files, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []postgresMigration
+	for _, file := range files {
+		name := strings.TrimSuffix(file[strings.LastIndex(file, "/")+1:], ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no numeric version prefix", file)
+		}
+		content, err := postgresMigrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, postgresMigration{version: version, name: name, sql: string(content)})
+	}
+	migrations = append(migrations, postgresCodeMigrations...)
+
+	seen := map[int]string{}
+	for _, migration := range migrations {
+		if other, ok := seen[migration.version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, migration.name, migration.version)
+		}
+		seen[migration.version] = migration.name
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// migratePostgres applies the embedded migrations that are not recorded in
+// schema_migrations yet, each in its own transaction.
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool, logger *log.Logger) error {
+	migrations, err := loadPostgresMigrations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", postgresMigrationLock)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	applied := map[int]bool{}
+	rows, err := conn.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		applied[version] = true
+	}
+
+	for _, migration := range migrations {
+		if applied[migration.version] {
+			continue
+		}
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if migration.run != nil {
+				if err := migration.run(ctx, tx); err != nil {
+					return err
+				}
+			} else if _, err := tx.Exec(ctx, migration.sql); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.version, migration.name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", migration.name, err)
+		}
+		logger.Printf("Applied migration %s", migration.name)
+	}
+	return nil
+}
+
+// migrateCanonicalNames adds and backfills users.username_canonical and
+// persons.email_canonical. It fails if existing rows collide once
+// canonicalized; those have to be resolved by hand first.
+func migrateCanonicalNames(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		ALTER TABLE users ADD COLUMN username_canonical TEXT;
+		ALTER TABLE persons ADD COLUMN email_canonical TEXT`)
+	if err != nil {
+		return err
+	}
+
+	if err := backfillCanonicalColumn(ctx, tx, "users", "username", "username_canonical", CanonicalUsername); err != nil {
+		return err
+	}
+	canonicalEmail := func(email string) (string, error) { return CanonicalEmail(email), nil }
+	if err := backfillCanonicalColumn(ctx, tx, "persons", "email", "email_canonical", canonicalEmail); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		ALTER TABLE users ALTER COLUMN username_canonical SET NOT NULL;
+		ALTER TABLE users ADD CONSTRAINT users_username_canonical_key UNIQUE (username_canonical);
+		ALTER TABLE persons ALTER COLUMN email_canonical SET NOT NULL;
+		ALTER TABLE persons ADD CONSTRAINT persons_email_canonical_key UNIQUE (email_canonical)`)
+	return err
+}
+
+func backfillCanonicalColumn(ctx context.Context, tx pgx.Tx, table, column, canonicalColumn string, canonicalize func(string) (string, error)) error {
+	rows, err := tx.Query(ctx, "SELECT id, "+column+" FROM "+table)
+	if err != nil {
+		return err
+	}
+	type row struct{ id, value string }
+	values, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (row, error) {
+		var v row
+		err := r.Scan(&v.id, &v.value)
+		return v, err
+	})
+	if err != nil {
+		return err
+	}
+
+	owners := map[string][]string{}
+	batch := &pgx.Batch{}
+	var problems []string
+	for _, v := range values {
+		canonical, err := canonicalize(v.value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q of %s cannot be canonicalized", column, v.value, v.id))
+			continue
+		}
+		owners[canonical] = append(owners[canonical], v.value)
+		batch.Queue("UPDATE "+table+" SET "+canonicalColumn+" = $2 WHERE id = $1", v.id, canonical)
+	}
+	for canonical, values := range owners {
+		if len(values) > 1 {
+			problems = append(problems, fmt.Sprintf("%s collision on %q: %s", column, canonical, strings.Join(values, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%d %s value(s) must be fixed before migrating:\n%s", len(problems), column, strings.Join(problems, "\n"))
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
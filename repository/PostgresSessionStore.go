@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sessionColumns = "id, user_id, device, user_agent, ip, location, created_at, last_seen_at, expires_at, refresh_token_hash, used_refresh_tokens"
+
+// PostgresSessionStore is a SessionStore backed by PostgreSQL. Expired
+// sessions of a user are purged when the user logs in again.
+type PostgresSessionStore struct {
+	pool   *pgxpool.Pool
+	logger *log.Logger
+}
+
+func NewPostgresSessionStore(pool *pgxpool.Pool, logger *log.Logger) *PostgresSessionStore {
+	return &PostgresSessionStore{pool: pool, logger: logger}
+}
+
+func scanSession(row pgx.Row) (*model.Session, error) {
+	var session model.Session
+	var id, userID string
+	err := row.Scan(&id, &userID, &session.Device, &session.UserAgent, &session.IP, &session.Location, &session.CreatedAt,
+		&session.LastSeenAt, &session.ExpiresAt, &session.RefreshTokenHash, &session.UsedRefreshTokens)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if session.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *PostgresSessionStore) CreateSession(ctx context.Context, session *model.Session) error {
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	if session.UsedRefreshTokens == nil {
+		session.UsedRefreshTokens = []string{}
+	}
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1 AND expires_at <= now()", session.UserID.Hex())
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO sessions ("+sessionColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+			session.ID.Hex(), session.UserID.Hex(), session.Device, session.UserAgent, session.IP, session.Location, session.CreatedAt,
+			session.LastSeenAt, session.ExpiresAt, session.RefreshTokenHash, session.UsedRefreshTokens)
+		return err
+	})
+	if err != nil {
+		s.logger.Printf("Failed to insert session: %v", err)
+	}
+	return err
+}
+
+func (s *PostgresSessionStore) GetSession(ctx context.Context, id primitive.ObjectID) (*model.Session, error) {
+	return scanSession(s.pool.QueryRow(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = $1 AND expires_at > now()", id.Hex()))
+}
+
+func (s *PostgresSessionStore) ListSessions(ctx context.Context, userID primitive.ObjectID) ([]model.Session, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 AND expires_at > now() ORDER BY last_seen_at DESC, id DESC", userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *PostgresSessionStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, now, expiresAt time.Time, ip string) (*model.Session, error) {
+	session, err := scanSession(s.pool.QueryRow(ctx, `UPDATE sessions
+		SET refresh_token_hash = $2, used_refresh_tokens = (array_prepend($1::text, used_refresh_tokens))[1:$6::int],
+			last_seen_at = $3, expires_at = $4, ip = $5
+		WHERE refresh_token_hash = $1 AND expires_at > $3
+		RETURNING `+sessionColumns, oldHash, newHash, now, expiresAt, ip, maxUsedRefreshTokens))
+	if !errors.Is(err, ErrSessionNotFound) {
+		return session, err
+	}
+
+	tag, err := s.pool.Exec(ctx, "DELETE FROM sessions WHERE $1 = ANY (used_refresh_tokens)", oldHash)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil, ErrRefreshTokenReused
+	}
+	return nil, ErrRefreshTokenInvalid
+}
+
+func (s *PostgresSessionStore) TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time, ip string) error {
+	_, err := s.pool.Exec(ctx, "UPDATE sessions SET last_seen_at = $2, ip = $3 WHERE id = $1 AND last_seen_at < $4",
+		id.Hex(), now, ip, now.Add(-sessionTouchInterval))
+	return err
+}
+
+func (s *PostgresSessionStore) DeleteSession(ctx context.Context, userID, id primitive.ObjectID) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM sessions WHERE id = $1 AND user_id = $2 AND expires_at > now()", id.Hex(), userID.Hex())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *PostgresSessionStore) DeleteSessions(ctx context.Context, userID, keep primitive.ObjectID) (int64, error) {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1 AND id <> $2 AND expires_at > now()", userID.Hex(), keep.Hex())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *PostgresSessionStore) EvictSessions(ctx context.Context, userID primitive.ObjectID, max int) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM sessions WHERE id IN (
+		SELECT id FROM sessions WHERE user_id = $1 AND expires_at > now()
+		ORDER BY last_seen_at DESC, id DESC OFFSET $2)`, userID.Hex(), max)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,41 @@
+package repository_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// postgresUsers creates the users rows that sessions and known devices
+// reference. The suites call newUser within the subtest whose store was
+// created last, so it writes to that store's schema.
+type postgresUsers struct {
+	pool *pgxpool.Pool
+}
+
+func (u *postgresUsers) newUser(t *testing.T) primitive.ObjectID {
+	t.Helper()
+	id := primitive.NewObjectID()
+	user := &model.User{ID: id, Username: "user" + id.Hex(), Role: model.RoleTourist}
+	person := &model.Person{Email: id.Hex() + "@example.com"}
+	if err := repository.NewPostgresUserStore(u.pool, log.New(io.Discard, "", 0)).CreateUser(context.Background(), user, person); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return id
+}
+
+func TestPostgresSessionStore(t *testing.T) {
+	dsn := postgresDSN(t)
+	users := &postgresUsers{}
+	storetest.TestSessionStore(t, func(t *testing.T) repository.SessionStore {
+		users.pool = newPostgresPool(t, dsn)
+		return repository.NewPostgresSessionStore(users.pool, log.New(io.Discard, "", 0))
+	}, users.newUser)
+}
@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const pgUniqueViolation = "23505"
+
+const userColumns = "id, username, username_canonical, password_hash, role, is_active"
+const personColumns = "id, user_id, first_name, last_name, email, email_canonical, profile_image, locale"
+
+// PostgresUserStore is a UserStore backed by PostgreSQL. Uniqueness of
+// usernames and emails is enforced by constraints of the schema.
+type PostgresUserStore struct {
+	pool   *pgxpool.Pool
+	logger *log.Logger
+}
+
+// NewPostgres connects to the database at dsn and applies pending migrations.
+func NewPostgres(ctx context.Context, dsn string, logger *log.Logger) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if err := migratePostgres(ctx, pool, logger); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+func NewPostgresUserStore(pool *pgxpool.Pool, logger *log.Logger) *PostgresUserStore {
+	return &PostgresUserStore{pool: pool, logger: logger}
+}
+
+func scanUser(row pgx.Row) (*model.User, error) {
+	var user model.User
+	var id string
+	if err := row.Scan(&id, &user.Username, &user.UsernameCanonical, &user.PasswordHash, &user.Role, &user.IsActive); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	var err error
+	if user.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func scanPerson(row pgx.Row) (*model.Person, error) {
+	var person model.Person
+	var id, userID string
+	err := row.Scan(&id, &userID, &person.FirstName, &person.LastName, &person.Email, &person.EmailCanonical, &person.ProfileImage, &person.Locale)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if person.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if person.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
+
+func (s *PostgresUserStore) queryUsers(ctx context.Context, sql string, args ...any) ([]model.User, error) {
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (s *PostgresUserStore) GetAll(ctx context.Context) ([]model.User, error) {
+	return s.queryUsers(ctx, "SELECT "+userColumns+" FROM users WHERE is_active ORDER BY username")
+}
+
+func (s *PostgresUserStore) GetUser(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	return scanUser(s.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE is_active AND id = $1", id.Hex()))
+}
+
+func (s *PostgresUserStore) GetUserIncludingInactive(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	return scanUser(s.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id.Hex()))
+}
+
+func (s *PostgresUserStore) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	canonical, err := CanonicalUsername(username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return scanUser(s.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE username_canonical = $1", canonical))
+}
+
+func (s *PostgresUserStore) GetUserByIds(ctx context.Context, ids []primitive.ObjectID) ([]model.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	hexIDs := make([]string, len(ids))
+	for i, id := range ids {
+		hexIDs[i] = id.Hex()
+	}
+	return s.queryUsers(ctx, "SELECT "+userColumns+" FROM users WHERE is_active AND id = ANY($1)", hexIDs)
+}
+
+func (s *PostgresUserStore) GetPersonsByUserIds(ctx context.Context, userIDs []primitive.ObjectID) ([]model.Person, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	hexIDs := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		hexIDs[i] = id.Hex()
+	}
+
+	rows, err := s.pool.Query(ctx, "SELECT "+personColumns+" FROM persons WHERE user_id = ANY($1)", hexIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := []model.Person{}
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, err
+		}
+		persons = append(persons, *person)
+	}
+	return persons, rows.Err()
+}
+
+func (s *PostgresUserStore) GetPerson(ctx context.Context, userID primitive.ObjectID) (*model.Person, error) {
+	return scanPerson(s.pool.QueryRow(ctx, "SELECT "+personColumns+" FROM persons WHERE user_id = $1", userID.Hex()))
+}
+
+func (s *PostgresUserStore) GetPersonByEmail(ctx context.Context, email string) (*model.Person, error) {
+	return scanPerson(s.pool.QueryRow(ctx, "SELECT "+personColumns+" FROM persons WHERE email_canonical = $1", CanonicalEmail(email)))
+}
+
+func (s *PostgresUserStore) CreateUser(ctx context.Context, user *model.User, person *model.Person, events ...model.Event) error {
+	usernameCanonical, err := CanonicalUsername(user.Username)
+	if err != nil {
+		return err
+	}
+	emailCanonical := CanonicalEmail(person.Email)
+	userID := user.ID
+	if userID.IsZero() {
+		userID = primitive.NewObjectID()
+	}
+	personID := primitive.NewObjectID()
+
+	err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			"INSERT INTO users ("+userColumns+") VALUES ($1, $2, $3, $4, $5, FALSE)",
+			userID.Hex(), user.Username, usernameCanonical, user.PasswordHash, user.Role)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO persons ("+personColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			personID.Hex(), userID.Hex(), person.FirstName, person.LastName, person.Email, emailCanonical, person.ProfileImage, person.Locale)
+		if err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, events)
+	})
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		s.logger.Printf("Username %s or email %s already exists", user.Username, person.Email)
+		return ErrDuplicateUser
+	}
+	if err != nil {
+		s.logger.Printf("Failed to insert user: %v", err)
+		return err
+	}
+
+	user.ID = userID
+	user.UsernameCanonical = usernameCanonical
+	user.IsActive = false
+	person.ID = personID
+	person.UserID = userID
+	person.EmailCanonical = emailCanonical
+	return nil
+}
+
+// exec runs an update of a single user and maps "no rows" to ErrUserNotFound.
+func (s *PostgresUserStore) exec(ctx context.Context, sql string, args ...any) error {
+	tag, err := s.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		s.logger.Printf("Failed to update user: %v", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// update runs a single row UPDATE that only matches if it changes something
+// and writes events in the same transaction if it did. Zero rows are told
+// apart from a missing user with a second query.
+func (s *PostgresUserStore) update(ctx context.Context, userID primitive.ObjectID, events []model.Event, sql string, args ...any) (bool, error) {
+	changed := false
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sql, args...)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		changed = true
+		return insertEvents(ctx, tx, events)
+	})
+	if err != nil {
+		s.logger.Printf("Failed to update user %s: %v", userID.Hex(), err)
+		return false, err
+	}
+	if changed {
+		return true, nil
+	}
+
+	var exists bool
+	if err := s.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID.Hex()).Scan(&exists); err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, ErrUserNotFound
+	}
+	return false, nil
+}
+
+func (s *PostgresUserStore) SetUserActive(ctx context.Context, id primitive.ObjectID, active bool, events ...model.Event) (bool, error) {
+	return s.update(ctx, id, events,
+		"UPDATE users SET is_active = $2 WHERE id = $1 AND is_active <> $2", id.Hex(), active)
+}
+
+func (s *PostgresUserStore) SetUserRole(ctx context.Context, id primitive.ObjectID, role model.UserRole, events ...model.Event) (bool, error) {
+	return s.update(ctx, id, events,
+		"UPDATE users SET role = $2 WHERE id = $1 AND role <> $2", id.Hex(), role)
+}
+
+func (s *PostgresUserStore) UpdatePerson(ctx context.Context, person *model.Person, events ...model.Event) (bool, error) {
+	return s.update(ctx, person.UserID, events, `
+		UPDATE persons SET first_name = $2, last_name = $3, profile_image = $4, locale = $5
+		WHERE user_id = $1 AND (first_name, last_name, profile_image, locale) IS DISTINCT FROM ($2, $3, $4, $5)`,
+		person.UserID.Hex(), person.FirstName, person.LastName, person.ProfileImage, person.Locale)
+}
+
+func insertEvents(ctx context.Context, tx pgx.Tx, events []model.Event) error {
+	prepareEvents(events, time.Now())
+	for _, event := range events {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO outbox (id, type, aggregate_id, occurred_at, payload, next_attempt_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			event.ID.Hex(), event.Type, event.AggregateID, event.OccurredAt, string(event.Payload), event.NextAttemptAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const eventColumns = "id, type, aggregate_id, occurred_at, payload, attempts, next_attempt_at, last_error"
+
+// ClaimEvent uses SKIP LOCKED so concurrent relays claim different events.
+func (s *PostgresUserStore) ClaimEvent(ctx context.Context, now time.Time, lease time.Duration) (*model.Event, error) {
+	var event model.Event
+	var id, payload string
+	err := s.pool.QueryRow(ctx, `
+		UPDATE outbox SET next_attempt_at = $2, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL AND next_attempt_at <= $1
+			ORDER BY id LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+eventColumns,
+		now, now.Add(lease),
+	).Scan(&id, &event.Type, &event.AggregateID, &event.OccurredAt, &payload, &event.Attempts, &event.NextAttemptAt, &event.LastError)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if event.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	event.Payload = []byte(payload)
+	return &event, nil
+}
+
+// MarkPublished also removes events published longer than
+// publishedEventRetention ago, Postgres has no TTL index for that.
+func (s *PostgresUserStore) MarkPublished(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := s.pool.Exec(ctx, `
+		WITH expired AS (
+			DELETE FROM outbox WHERE published_at < $3
+		)
+		UPDATE outbox SET published_at = $2, last_error = '' WHERE id = $1`,
+		id.Hex(), at, at.Add(-publishedEventRetention))
+	return err
+}
+
+func (s *PostgresUserStore) RetryEvent(ctx context.Context, id primitive.ObjectID, nextAttemptAt time.Time, lastError string) error {
+	_, err := s.pool.Exec(ctx, "UPDATE outbox SET next_attempt_at = $2, last_error = $3 WHERE id = $1",
+		id.Hex(), nextAttemptAt, lastError)
+	return err
+}
+
+func (s *PostgresUserStore) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	return s.exec(ctx, "UPDATE users SET password_hash = $2 WHERE id = $1", id.Hex(), passwordHash)
+}
+
+func (s *PostgresUserStore) ReplacePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) (bool, error) {
+	tag, err := s.pool.Exec(ctx,
+		"UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2",
+		id.Hex(), oldHash, newHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Disconnect closes the pool, which is shared with the other Postgres stores.
+func (s *PostgresUserStore) Disconnect(ctx context.Context) error {
+	s.pool.Close()
+	return nil
+}
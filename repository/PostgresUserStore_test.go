@@ -0,0 +1,74 @@
+package repository_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresDSN skips the test unless POSTGRES_DSN names a database to test
+// against.
+func postgresDSN(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN is not set")
+	}
+	return dsn
+}
+
+// newPostgresPool connects to a fresh schema, so tests don't see each other's
+// rows, and applies the embedded migrations to it. The schema is dropped
+// after the test.
+func newPostgresPool(t *testing.T, dsn string) *pgxpool.Pool {
+	t.Helper()
+	ctx := context.Background()
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	schema := "auth_test_" + hex.EncodeToString(suffix)
+
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connecting to Postgres: %v", err)
+	}
+	t.Cleanup(admin.Close)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	// Unknown DSN parameters are sent to the server as run-time settings.
+	if strings.Contains(dsn, "://") {
+		if strings.Contains(dsn, "?") {
+			dsn += "&search_path=" + schema
+		} else {
+			dsn += "?search_path=" + schema
+		}
+	} else {
+		dsn += " search_path=" + schema
+	}
+	pool, err := repository.NewPostgres(ctx, dsn, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("connecting and migrating: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestPostgresUserStore(t *testing.T) {
+	dsn := postgresDSN(t)
+	storetest.TestUserStore(t, func(t *testing.T) repository.UserStore {
+		return repository.NewPostgresUserStore(newPostgresPool(t, dsn), log.New(io.Discard, "", 0))
+	})
+}
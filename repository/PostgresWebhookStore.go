@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const webhookColumns = "id, url, events, secret, created_at"
+const deliveryColumns = "id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, log, created_at, updated_at"
+
+// PostgresWebhookStore is a WebhookStore backed by PostgreSQL. Deliveries of
+// deleted webhooks go with them through the foreign key.
+type PostgresWebhookStore struct {
+	pool   *pgxpool.Pool
+	logger *log.Logger
+}
+
+func NewPostgresWebhookStore(pool *pgxpool.Pool, logger *log.Logger) *PostgresWebhookStore {
+	return &PostgresWebhookStore{pool: pool, logger: logger}
+}
+
+func scanWebhook(row pgx.Row) (*model.Webhook, error) {
+	var webhook model.Webhook
+	var id string
+	err := row.Scan(&id, &webhook.URL, &webhook.Events, &webhook.Secret, &webhook.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if webhook.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func scanDelivery(row pgx.Row) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	var id, webhookID, eventID, payload string
+	err := row.Scan(&id, &webhookID, &eventID, &delivery.EventType, &payload, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.Log, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if delivery.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if delivery.WebhookID, err = primitive.ObjectIDFromHex(webhookID); err != nil {
+		return nil, err
+	}
+	if delivery.EventID, err = primitive.ObjectIDFromHex(eventID); err != nil {
+		return nil, err
+	}
+	delivery.Payload = []byte(payload)
+	return &delivery, nil
+}
+
+func (s *PostgresWebhookStore) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	_, err := s.pool.Exec(ctx, "INSERT INTO webhooks ("+webhookColumns+") VALUES ($1, $2, $3, $4, $5)",
+		webhook.ID.Hex(), webhook.URL, webhook.Events, webhook.Secret, webhook.CreatedAt)
+	if err != nil {
+		s.logger.Printf("Failed to insert webhook: %v", err)
+	}
+	return err
+}
+
+func (s *PostgresWebhookStore) GetWebhook(ctx context.Context, id primitive.ObjectID) (*model.Webhook, error) {
+	return scanWebhook(s.pool.QueryRow(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id.Hex()))
+}
+
+func (s *PostgresWebhookStore) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []model.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *PostgresWebhookStore) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", id.Hex())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// EnqueueDeliveries also removes deliveries finished longer than
+// deliveryRetention ago, Postgres has no TTL index for that.
+func (s *PostgresWebhookStore) EnqueueDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	now := time.Now()
+	prepareDeliveries(deliveries, now)
+
+	batch := &pgx.Batch{}
+	batch.Queue("DELETE FROM webhook_deliveries WHERE status <> $1 AND updated_at < $2",
+		model.DeliveryPending, now.Add(-deliveryRetention))
+	for _, d := range deliveries {
+		batch.Queue(`
+			INSERT INTO webhook_deliveries (`+deliveryColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, '[]', $9, $10)
+			ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+			d.ID.Hex(), d.WebhookID.Hex(), d.EventID.Hex(), d.EventType, string(d.Payload), d.Status,
+			d.Attempts, d.NextAttemptAt, d.CreatedAt, d.UpdatedAt)
+	}
+	if err := s.pool.SendBatch(ctx, batch).Close(); err != nil {
+		s.logger.Printf("Failed to enqueue webhook deliveries: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ClaimDelivery uses SKIP LOCKED so concurrent workers claim different deliveries.
+func (s *PostgresWebhookStore) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*model.WebhookDelivery, error) {
+	delivery, err := scanDelivery(s.pool.QueryRow(ctx, `
+		UPDATE webhook_deliveries SET next_attempt_at = $3, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY id LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns,
+		model.DeliveryPending, now, now.Add(lease)))
+	if errors.Is(err, ErrDeliveryNotFound) {
+		return nil, nil
+	}
+	return delivery, err
+}
+
+// RecordAttempt appends to the log and keeps only its last maxDeliveryLog entries.
+func (s *PostgresWebhookStore) RecordAttempt(ctx context.Context, id primitive.ObjectID, attempt model.DeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	entry, err := json.Marshal([]model.DeliveryAttempt{attempt})
+	if err != nil {
+		return err
+	}
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE webhook_deliveries SET
+			log = (
+				SELECT COALESCE(jsonb_agg(e ORDER BY i), '[]')
+				FROM jsonb_array_elements(log || $2::jsonb) WITH ORDINALITY AS t(e, i)
+				WHERE i > jsonb_array_length(log) + 1 - $3
+			),
+			status = $4, next_attempt_at = $5, updated_at = $6
+		WHERE id = $1`,
+		id.Hex(), string(entry), maxDeliveryLog, status, nextAttemptAt, attempt.At)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+func (s *PostgresWebhookStore) ListDeliveries(ctx context.Context, webhookID primitive.ObjectID, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2",
+		webhookID.Hex(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *PostgresWebhookStore) ReplayDelivery(ctx context.Context, id primitive.ObjectID, now time.Time) (*model.WebhookDelivery, error) {
+	return scanDelivery(s.pool.QueryRow(ctx, `
+		UPDATE webhook_deliveries SET status = $2, attempts = 0, next_attempt_at = $3, updated_at = $3
+		WHERE id = $1
+		RETURNING `+deliveryColumns,
+		id.Hex(), model.DeliveryPending, now))
+}
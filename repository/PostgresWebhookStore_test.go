@@ -0,0 +1,17 @@
+package repository_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestPostgresWebhookStore(t *testing.T) {
+	dsn := postgresDSN(t)
+	storetest.TestWebhookStore(t, func(t *testing.T) repository.WebhookStore {
+		return repository.NewPostgresWebhookStore(newPostgresPool(t, dsn), log.New(io.Discard, "", 0))
+	})
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/ratelimit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimitRepo stores token buckets in Mongo so all replicas share them. The
+// refill and the take happen in one pipeline update, which makes it atomic.
+type RateLimitRepo struct {
+	logger  *log.Logger
+	buckets *mongo.Collection
+}
+
+func NewRateLimitRepo(db *mongo.Database, logger *log.Logger) *RateLimitRepo {
+	return &RateLimitRepo{
+		logger:  logger,
+		buckets: db.Collection("rate_limits"),
+	}
+}
+
+func (repo *RateLimitRepo) Take(ctx context.Context, key string, policy ratelimit.Policy, now time.Time) (ratelimit.Result, error) {
+	burst := float64(policy.Burst)
+	elapsedSeconds := bson.M{"$divide": []interface{}{
+		bson.M{"$max": []interface{}{0, bson.M{"$subtract": []interface{}{now, bson.M{"$ifNull": []interface{}{"$updated_at", now}}}}}},
+		1000,
+	}}
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": []interface{}{
+				burst,
+				bson.M{"$add": []interface{}{
+					bson.M{"$ifNull": []interface{}{"$tokens", burst}},
+					bson.M{"$multiply": []interface{}{elapsedSeconds, policy.RefillRate()}},
+				}},
+			}},
+			"updated_at": now,
+			"expires_at": now.Add(policy.Period),
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"allowed": bson.M{"$gte": []interface{}{"$tokens", 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$cond": []interface{}{"$allowed", bson.M{"$subtract": []interface{}{"$tokens", 1}}, "$tokens"}},
+		}}},
+	}
+
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := repo.buckets.FindOneAndUpdate(ctx, bson.M{"_id": key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&bucket)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	return ratelimit.BucketResult(policy, bucket.Tokens, bucket.Allowed), nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SessionRepo keeps sessions in the sessions collection, whose TTL index on
+// expires_at removes them once they ran out. Refresh tokens live in their
+// session's document, so rotating one is a single atomic update.
+type SessionRepo struct {
+	logger   *log.Logger
+	sessions *mongo.Collection
+}
+
+func NewSessionRepo(db *mongo.Database, logger *log.Logger) *SessionRepo {
+	return &SessionRepo{
+		logger:   logger,
+		sessions: db.Collection("sessions"),
+	}
+}
+
+func (r *SessionRepo) CreateSession(ctx context.Context, session *model.Session) error {
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	if session.UsedRefreshTokens == nil {
+		session.UsedRefreshTokens = []string{}
+	}
+	_, err := r.sessions.InsertOne(ctx, session)
+	if err != nil {
+		r.logger.Printf("Failed to insert session: %v", err)
+	}
+	return err
+}
+
+func (r *SessionRepo) GetSession(ctx context.Context, id primitive.ObjectID) (*model.Session, error) {
+	session := model.Session{}
+	err := r.sessions.FindOne(ctx, bson.M{"_id": id, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepo) ListSessions(ctx context.Context, userID primitive.ObjectID) ([]model.Session, error) {
+	cursor, err := r.sessions.Find(ctx, bson.M{"user_id": userID, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	sessions := []model.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *SessionRepo) RotateRefreshToken(ctx context.Context, oldHash, newHash string, now, expiresAt time.Time, ip string) (*model.Session, error) {
+	session := model.Session{}
+	err := r.sessions.FindOneAndUpdate(ctx,
+		bson.M{"refresh_token_hash": oldHash, "expires_at": bson.M{"$gt": now}},
+		bson.M{
+			"$set": bson.M{"refresh_token_hash": newHash, "last_seen_at": now, "expires_at": expiresAt, "ip": ip},
+			"$push": bson.M{"used_refresh_tokens": bson.M{
+				"$each": []string{oldHash}, "$position": 0, "$slice": maxUsedRefreshTokens,
+			}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err == nil {
+		return &session, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	result, err := r.sessions.DeleteOne(ctx, bson.M{"used_refresh_tokens": oldHash})
+	if err != nil {
+		return nil, err
+	}
+	if result.DeletedCount > 0 {
+		return nil, ErrRefreshTokenReused
+	}
+	return nil, ErrRefreshTokenInvalid
+}
+
+func (r *SessionRepo) TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time, ip string) error {
+	_, err := r.sessions.UpdateOne(ctx,
+		bson.M{"_id": id, "last_seen_at": bson.M{"$lt": now.Add(-sessionTouchInterval)}},
+		bson.M{"$set": bson.M{"last_seen_at": now, "ip": ip}},
+	)
+	return err
+}
+
+func (r *SessionRepo) DeleteSession(ctx context.Context, userID, id primitive.ObjectID) error {
+	result, err := r.sessions.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID, "expires_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *SessionRepo) DeleteSessions(ctx context.Context, userID, keep primitive.ObjectID) (int64, error) {
+	result, err := r.sessions.DeleteMany(ctx, bson.M{
+		"user_id":    userID,
+		"_id":        bson.M{"$ne": keep},
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *SessionRepo) EvictSessions(ctx context.Context, userID primitive.ObjectID, max int) (int64, error) {
+	cursor, err := r.sessions.Find(ctx, bson.M{"user_id": userID, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().
+			SetSort(bson.D{{Key: "last_seen_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(int64(max)).
+			SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var evicted []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &evicted); err != nil {
+		return 0, err
+	}
+	if len(evicted) == 0 {
+		return 0, nil
+	}
+	ids := make([]primitive.ObjectID, len(evicted))
+	for i, session := range evicted {
+		ids[i] = session.ID
+	}
+	result, err := r.sessions.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
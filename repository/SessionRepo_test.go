@@ -0,0 +1,17 @@
+package repository_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMongoSessionStore(t *testing.T) {
+	uri := mongoURI(t)
+	storetest.TestSessionStore(t, func(t *testing.T) repository.SessionStore {
+		return repository.NewSessionRepo(newMongoUserRepo(t, uri).Database(), log.New(io.Discard, "", 0))
+	}, anyUser)
+}
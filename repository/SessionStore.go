@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrSessionNotFound     = apperror.New(apperror.KindNotFound, "session.not_found", "session not found")
+	ErrRefreshTokenInvalid = apperror.New(apperror.KindUnauthenticated, "auth.refresh_token_invalid", "invalid or expired refresh token")
+	ErrRefreshTokenReused  = apperror.New(apperror.KindUnauthenticated, "auth.refresh_token_reused", "refresh token was already used, the session has been revoked")
+)
+
+// SessionStore keeps the login sessions. Expired sessions are never returned.
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *model.Session) error
+	GetSession(ctx context.Context, id primitive.ObjectID) (*model.Session, error)
+	// ListSessions returns the sessions of a user, most recently seen first.
+	ListSessions(ctx context.Context, userID primitive.ObjectID) ([]model.Session, error)
+	// RotateRefreshToken replaces the refresh token oldHash of a live session
+	// with newHash and extends the session to expiresAt. If oldHash was
+	// already rotated out, the session it belonged to is deleted and
+	// ErrRefreshTokenReused returned: either the client or a thief holds a
+	// stolen copy.
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, now, expiresAt time.Time, ip string) (*model.Session, error)
+	// TouchSession records activity. Stores may skip the write if the
+	// session was seen less than sessionTouchInterval ago, and ignore
+	// sessions that don't exist.
+	TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time, ip string) error
+	// DeleteSession ends a session of userID.
+	DeleteSession(ctx context.Context, userID, id primitive.ObjectID) error
+	// DeleteSessions ends all sessions of userID except keep, which may be
+	// the nil ID, and returns how many were ended.
+	DeleteSessions(ctx context.Context, userID, keep primitive.ObjectID) (int64, error)
+	// EvictSessions ends all but the max most recently seen sessions of
+	// userID and returns how many were ended.
+	EvictSessions(ctx context.Context, userID primitive.ObjectID, max int) (int64, error)
+}
+
+var (
+	_ SessionStore = (*SessionRepo)(nil)
+	_ SessionStore = (*MemorySessionStore)(nil)
+	_ SessionStore = (*PostgresSessionStore)(nil)
+)
+
+const (
+	// maxUsedRefreshTokens is the number of rotated out tokens kept per
+	// session for reuse detection.
+	maxUsedRefreshTokens = 10
+	// sessionTouchInterval limits how often activity is written.
+	sessionTouchInterval = time.Minute
+)
+
+// rotatedRefreshTokens returns used with oldHash added, capped to the most
+// recent maxUsedRefreshTokens.
+func rotatedRefreshTokens(used []string, oldHash string) []string {
+	rotated := append([]string{oldHash}, used...)
+	if len(rotated) > maxUsedRefreshTokens {
+		rotated = rotated[:maxUsedRefreshTokens]
+	}
+	return rotated
+}
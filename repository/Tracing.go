@@ -0,0 +1,7 @@
+package repository
+
+import "go.opentelemetry.io/otel"
+
+// tracer spans the repository methods; the Mongo commands they send show up
+// as children through the client's command monitor.
+var tracer = otel.Tracer("github.com/MicroSOA-09/auth-service/repository")
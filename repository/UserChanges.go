@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserChanges reports users whose user or person record changed. Next returns
+// a zero ID when the user can't be determined, e.g. for a deleted person or a
+// dropped collection, and callers have to assume that everything changed.
+type UserChanges interface {
+	Next(ctx context.Context) (primitive.ObjectID, error)
+	Close(ctx context.Context) error
+}
+
+// UserChangeSource is implemented by stores that can notify about changes
+// made by any process, which is what makes caching their reads safe.
+type UserChangeSource interface {
+	WatchUserChanges(ctx context.Context) (UserChanges, error)
+}
+
+var _ UserChangeSource = (*UserRepo)(nil)
+
+var errChangeStreamClosed = errors.New("change stream closed")
+
+type mongoUserChanges struct {
+	stream *mongo.ChangeStream
+}
+
+// WatchUserChanges opens a change stream on the users and persons
+// collections. Change streams need a replica set, which Atlas always is.
+func (repo *UserRepo) WatchUserChanges(ctx context.Context) (UserChanges, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"$or": bson.A{
+		bson.M{"ns.coll": bson.M{"$in": bson.A{"users", "persons"}}},
+		bson.M{"operationType": bson.M{"$in": bson.A{"dropDatabase", "invalidate"}}},
+	}}}}}
+	stream, err := repo.db.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return nil, err
+	}
+	return &mongoUserChanges{stream: stream}, nil
+}
+
+func (c *mongoUserChanges) Next(ctx context.Context) (primitive.ObjectID, error) {
+	if !c.stream.Next(ctx) {
+		if err := c.stream.Err(); err != nil {
+			return primitive.NilObjectID, err
+		}
+		return primitive.NilObjectID, errChangeStreamClosed
+	}
+
+	var event struct {
+		OperationType string `bson:"operationType"`
+		NS            struct {
+			Coll string `bson:"coll"`
+		} `bson:"ns"`
+		DocumentKey struct {
+			ID primitive.ObjectID `bson:"_id"`
+		} `bson:"documentKey"`
+		FullDocument *struct {
+			UserID primitive.ObjectID `bson:"user_id"`
+		} `bson:"fullDocument"`
+	}
+	if err := c.stream.Decode(&event); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	switch {
+	case event.NS.Coll == "users" && !event.DocumentKey.ID.IsZero():
+		return event.DocumentKey.ID, nil
+	case event.NS.Coll == "persons" && event.FullDocument != nil:
+		return event.FullDocument.UserID, nil
+	default:
+		return primitive.NilObjectID, nil
+	}
+}
+
+func (c *mongoUserChanges) Close(ctx context.Context) error {
+	return c.stream.Close(ctx)
+}
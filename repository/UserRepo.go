@@ -3,33 +3,50 @@ package repository
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log"
-	"os"
+	"time"
 
+	"github.com/MicroSOA-09/auth-service/apperror"
 	"github.com/MicroSOA-09/auth-service/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrDuplicateUser      = errors.New("username or email already exists")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserNotActive      = errors.New("user not active")
+	ErrDuplicateUser      = apperror.New(apperror.KindConflict, "user.duplicate", "username or email already exists")
+	ErrUserNotFound       = apperror.New(apperror.KindNotFound, "user.not_found", "user not found")
+	ErrInvalidCredentials = apperror.New(apperror.KindUnauthenticated, "auth.invalid_credentials", "invalid credentials")
+	ErrUserNotActive      = apperror.New(apperror.KindForbidden, "auth.account_not_active", "account not verified")
 )
 
+// canonicalCollation is the collation of the unique indexes on the canonical
+// fields. Queries on those fields must use it to be served by the index.
+var canonicalCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// notFound maps a missing document to ErrUserNotFound and keeps other errors,
+// so a broken connection isn't reported as an unknown user.
+func notFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
 type UserRepo struct {
 	cli     *mongo.Client
+	db      *mongo.Database
 	logger  *log.Logger
 	users   *mongo.Collection
 	persons *mongo.Collection
+	outbox  *mongo.Collection
 }
 
 func (repo *UserRepo) GetAll(ctx context.Context) ([]model.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.GetAll")
+	defer span.End()
+
 	users := []model.User{}
 	cursor, err := repo.users.Find(ctx, bson.M{"is_active": true})
 	if err != nil {
@@ -44,102 +61,141 @@ func (repo *UserRepo) GetAll(ctx context.Context) ([]model.User, error) {
 }
 
 func (repo *UserRepo) GetUser(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.GetUser")
+	defer span.End()
+
 	user := model.User{}
 	err := repo.users.FindOne(ctx, bson.M{"is_active": true, "_id": id}).Decode(&user)
 	if err != nil {
 		repo.logger.Printf("No user with that id %v", id)
-		return nil, ErrUserNotFound
+		return nil, notFound(err)
 	}
 	return &user, nil
 }
 
-func (repo *UserRepo) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+func (repo *UserRepo) GetUserIncludingInactive(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.GetUserIncludingInactive")
+	defer span.End()
+
 	user := model.User{}
-	err := repo.users.FindOne(ctx, bson.M{"is_active": true, "username": username}).Decode(&user)
+	if err := repo.users.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (repo *UserRepo) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.GetUserByUsername")
+	defer span.End()
+
+	canonical, err := CanonicalUsername(username)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
+	user := model.User{}
+	err = repo.users.FindOne(ctx,
+		bson.M{"username_canonical": canonical},
+		options.FindOne().SetCollation(canonicalCollation),
+	).Decode(&user)
+	if err != nil {
+		return nil, notFound(err)
+	}
 	return &user, nil
 }
 
-func (repo *UserRepo) GetUserByIds(ctx context.Context, ids []primitive.ObjectID) ([]model.User, error) {
-	if len(ids) == 0 {
-		return nil, nil
+func (repo *UserRepo) GetPerson(ctx context.Context, userID primitive.ObjectID) (*model.Person, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.GetPerson")
+	defer span.End()
+
+	person := model.Person{}
+	err := repo.persons.FindOne(ctx, bson.M{"user_id": userID}).Decode(&person)
+	if err != nil {
+		return nil, notFound(err)
 	}
+	return &person, nil
+}
 
-	// Ukloni duplikate
-	uniqueIDs := make(map[primitive.ObjectID]struct{})
-	for _, id := range ids {
-		uniqueIDs[id] = struct{}{}
+func (repo *UserRepo) GetPersonByEmail(ctx context.Context, email string) (*model.Person, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.GetPersonByEmail")
+	defer span.End()
+
+	person := model.Person{}
+	err := repo.persons.FindOne(ctx,
+		bson.M{"email_canonical": CanonicalEmail(email)},
+		options.FindOne().SetCollation(canonicalCollation),
+	).Decode(&person)
+	if err != nil {
+		return nil, notFound(err)
 	}
-	idList := make([]primitive.ObjectID, 0, len(uniqueIDs))
-	for id := range uniqueIDs {
-		idList = append(idList, id)
+	return &person, nil
+}
+
+func (repo *UserRepo) GetUserByIds(ctx context.Context, ids []primitive.ObjectID) ([]model.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.GetUserByIds")
+	defer span.End()
+
+	if len(ids) == 0 {
+		return nil, nil
 	}
-	fmt.Printf("Unique IDs: %v\n", idList)
 
-	// Upit
-	cursor, err := repo.users.Find(ctx, bson.M{
-		"_id": bson.M{"$in": idList},
-	})
+	cursor, err := repo.users.Find(ctx, bson.M{"is_active": true, "_id": bson.M{"$in": ids}})
 	if err != nil {
-		fmt.Printf("Find error: %v\n", err)
 		return nil, err
 	}
-	defer cursor.Close(ctx)
-
-	// Dohvati korisnike
-	var users []model.User
+	users := []model.User{}
 	if err := cursor.All(ctx, &users); err != nil {
-		fmt.Printf("Cursor error: %v\n", err)
 		return nil, err
 	}
-
-	// Detaljan ispis
-	fmt.Printf("Found %d users:\n", len(users))
-	for i, user := range users {
-		fmt.Printf("User %d: ID=%s, Username=%s\n", i+1, user.ID.Hex(), user.Username)
-	}
-
 	return users, nil
 }
 
-func New(ctx context.Context, logger *log.Logger) (*UserRepo, error) {
-	dbURI := os.Getenv("MONGO_DB_URI")
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(dbURI))
-	if err != nil {
-		return nil, err
-	}
+func (repo *UserRepo) GetPersonsByUserIds(ctx context.Context, userIDs []primitive.ObjectID) ([]model.Person, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.GetPersonsByUserIds")
+	defer span.End()
 
-	db := client.Database("auth")
-	users := db.Collection("users")
-	persons := db.Collection("persons")
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
 
-	_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys: bson.M{"username": 1}, Options: options.Index().SetUnique(true),
-	})
+	cursor, err := repo.persons.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}})
 	if err != nil {
-		client.Disconnect(ctx)
 		return nil, err
 	}
+	persons := []model.Person{}
+	if err := cursor.All(ctx, &persons); err != nil {
+		return nil, err
+	}
+	return persons, nil
+}
 
-	_, err = persons.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{Keys: bson.M{"user_id": 1}, Options: options.Index().SetUnique(true)},
-		{Keys: bson.M{"email": 1}, Options: options.Index().SetUnique(true)},
-	})
+// New connects to the Mongo database. Indexes and validators are created by
+// the migrations, see MongoMigrator. Command latencies are exported as
+// metrics.
+func New(ctx context.Context, uri, database string, logger *log.Logger) (*UserRepo, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(newMongoMonitor()))
 	if err != nil {
-		client.Disconnect(ctx)
 		return nil, err
 	}
 
+	db := client.Database(database)
+	users := db.Collection("users")
+	persons := db.Collection("persons")
+
 	return &UserRepo{
 		cli:     client,
+		db:      db,
 		logger:  logger,
 		users:   users,
 		persons: persons,
+		outbox:  db.Collection("outbox"),
 	}, nil
 }
 
+// Database exposes the auth database so other repositories can share the connection.
+func (userRepo *UserRepo) Database() *mongo.Database {
+	return userRepo.db
+}
+
 func (userRepo *UserRepo) Disconnect(ctx context.Context) error {
 	err := userRepo.cli.Disconnect(ctx)
 	if err != nil {
@@ -148,55 +204,208 @@ func (userRepo *UserRepo) Disconnect(ctx context.Context) error {
 	return nil
 }
 
-func (r *UserRepo) CreateUser(ctx context.Context, user *model.User, person *model.Person, password string) error {
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// transact runs fn in a transaction and, if fn reports a change, appends
+// events to the outbox in the same transaction.
+func (r *UserRepo) transact(ctx context.Context, events []model.Event, fn func(sc mongo.SessionContext) (bool, error)) (bool, error) {
+	session, err := r.cli.StartSession()
+	if err != nil {
+		r.logger.Printf("Failed to start session: %v", err)
+		return false, err
+	}
+	defer session.EndSession(ctx)
+
+	changed, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		changed, err := fn(sc)
+		if err != nil || !changed || len(events) == 0 {
+			return changed, err
+		}
+		prepareEvents(events, time.Now())
+		documents := make([]interface{}, len(events))
+		for i := range events {
+			documents[i] = events[i]
+		}
+		if _, err := r.outbox.InsertMany(sc, documents); err != nil {
+			r.logger.Printf("Failed to write events to the outbox: %v", err)
+			return nil, err
+		}
+		return true, nil
+	})
 	if err != nil {
-		r.logger.Printf("Failed to hash password: %v", err)
+		return false, err
+	}
+	return changed.(bool), nil
+}
+
+// CreateUser stores a new, inactive user. user.PasswordHash must already be set.
+func (r *UserRepo) CreateUser(ctx context.Context, user *model.User, person *model.Person, events ...model.Event) error {
+	ctx, span := tracer.Start(ctx, "UserRepo.CreateUser")
+	defer span.End()
+
+	var err error
+	if user.UsernameCanonical, err = CanonicalUsername(user.Username); err != nil {
 		return err
 	}
+	person.EmailCanonical = CanonicalEmail(person.Email)
 
-	user.PasswordHash = string(passwordHash)
-	user.ID = primitive.NewObjectID()
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
 	user.IsActive = false
 
 	person.ID = primitive.NewObjectID()
 	person.UserID = user.ID
 
-	session, err := r.cli.StartSession()
-	if err != nil {
-		r.logger.Printf("Failed to start session: %v", err)
-		return err
-	}
-	defer session.EndSession(ctx)
-
-	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
-		count, err := r.users.CountDocuments(sc, bson.M{"$or": []bson.M{
-			{"username": user.Username},
-			{"email": person.Email},
-		}})
+	_, err = r.transact(ctx, events, func(sc mongo.SessionContext) (bool, error) {
+		count := options.Count().SetCollation(canonicalCollation)
+		users, err := r.users.CountDocuments(sc, bson.M{"username_canonical": user.UsernameCanonical}, count)
 		if err != nil {
-			r.logger.Printf("Error checking uniqueness: %%v", err)
-			return nil, err
+			r.logger.Printf("Error checking uniqueness: %v", err)
+			return false, err
 		}
-		if count > 0 {
-			r.logger.Print("Username %s or email %s already exists", user.Username, person.Email)
-			return nil, ErrDuplicateUser
+		persons, err := r.persons.CountDocuments(sc, bson.M{"email_canonical": person.EmailCanonical}, count)
+		if err != nil {
+			r.logger.Printf("Error checking uniqueness: %v", err)
+			return false, err
+		}
+		if users+persons > 0 {
+			r.logger.Printf("Username %s or email %s already exists", user.Username, person.Email)
+			return false, ErrDuplicateUser
 		}
 
 		_, err = r.users.InsertOne(sc, user)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, ErrDuplicateUser
+		}
 		if err != nil {
 			r.logger.Printf("Failed to insert user: %v", err)
-			return nil, err
+			return false, err
 		}
 
 		_, err = r.persons.InsertOne(sc, person)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, ErrDuplicateUser
+		}
 		if err != nil {
 			r.logger.Printf("Failed to insert person: %v", err)
-			return nil, err
+			return false, err
+		}
+		return true, nil
+	})
+	return err
+}
+
+func (r *UserRepo) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	ctx, span := tracer.Start(ctx, "UserRepo.UpdatePasswordHash")
+	defer span.End()
+
+	result, err := r.users.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"password_hash": passwordHash}})
+	if err != nil {
+		r.logger.Printf("Failed to update password of %s: %v", id.Hex(), err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ReplacePasswordHash swaps the hash only if it still equals oldHash, so an
+// upgrade computed from a stale read can't undo a concurrent password change.
+func (r *UserRepo) ReplacePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.ReplacePasswordHash")
+	defer span.End()
+
+	result, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": id, "password_hash": oldHash},
+		bson.M{"$set": bson.M{"password_hash": newHash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// updateUser applies update to the user with id and reports whether that
+// changed anything. Events are only written for an actual change.
+func (r *UserRepo) updateUser(ctx context.Context, id primitive.ObjectID, update bson.M, events []model.Event) (bool, error) {
+	return r.transact(ctx, events, func(sc mongo.SessionContext) (bool, error) {
+		result, err := r.users.UpdateOne(sc, bson.M{"_id": id}, update)
+		if err != nil {
+			r.logger.Printf("Failed to update user %s: %v", id.Hex(), err)
+			return false, err
+		}
+		if result.MatchedCount == 0 {
+			return false, ErrUserNotFound
 		}
+		return result.ModifiedCount > 0, nil
+	})
+}
+
+func (r *UserRepo) SetUserActive(ctx context.Context, id primitive.ObjectID, active bool, events ...model.Event) (bool, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.SetUserActive")
+	defer span.End()
+
+	return r.updateUser(ctx, id, bson.M{"$set": bson.M{"is_active": active}}, events)
+}
+
+func (r *UserRepo) SetUserRole(ctx context.Context, id primitive.ObjectID, role model.UserRole, events ...model.Event) (bool, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.SetUserRole")
+	defer span.End()
+
+	return r.updateUser(ctx, id, bson.M{"$set": bson.M{"role": role}}, events)
+}
 
+// UpdatePerson saves the profile fields of person, found by its UserID.
+func (r *UserRepo) UpdatePerson(ctx context.Context, person *model.Person, events ...model.Event) (bool, error) {
+	ctx, span := tracer.Start(ctx, "UserRepo.UpdatePerson")
+	defer span.End()
+
+	return r.transact(ctx, events, func(sc mongo.SessionContext) (bool, error) {
+		result, err := r.persons.UpdateOne(sc, bson.M{"user_id": person.UserID}, bson.M{"$set": bson.M{
+			"first_name":    person.FirstName,
+			"last_name":     person.LastName,
+			"profile_image": person.ProfileImage,
+			"locale":        person.Locale,
+		}})
+		if err != nil {
+			r.logger.Printf("Failed to update person of %s: %v", person.UserID.Hex(), err)
+			return false, err
+		}
+		if result.MatchedCount == 0 {
+			return false, ErrUserNotFound
+		}
+		return result.ModifiedCount > 0, nil
+	})
+}
+
+func (r *UserRepo) ClaimEvent(ctx context.Context, now time.Time, lease time.Duration) (*model.Event, error) {
+	event := model.Event{}
+	err := r.outbox.FindOneAndUpdate(ctx,
+		bson.M{"published": false, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}, "$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *UserRepo) MarkPublished(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := r.outbox.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"published": true, "published_at": at},
+		"$unset": bson.M{"last_error": ""},
 	})
+	return err
+}
 
+func (r *UserRepo) RetryEvent(ctx context.Context, id primitive.ObjectID, nextAttemptAt time.Time, lastError string) error {
+	_, err := r.outbox.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}})
 	return err
 }
@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+// mongoURI skips the test unless MONGO_URI names a server to test against.
+// It has to be a replica set, the user store needs transactions.
+func mongoURI(t *testing.T) string {
+	t.Helper()
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		t.Skip("MONGO_URI is not set")
+	}
+	return uri
+}
+
+// newMongoUserRepo migrates a fresh database that is dropped after the test.
+func newMongoUserRepo(t *testing.T, uri string) *repository.UserRepo {
+	t.Helper()
+	ctx := context.Background()
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	logger := log.New(io.Discard, "", 0)
+
+	repo, err := repository.New(ctx, uri, "auth_test_"+hex.EncodeToString(suffix), logger)
+	if err != nil {
+		t.Fatalf("connecting to Mongo: %v", err)
+	}
+	t.Cleanup(func() {
+		repo.Database().Drop(context.Background())
+		repo.Disconnect(context.Background())
+	})
+	if err := repository.NewMongoMigrator(repo.Database(), logger).Up(ctx); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return repo
+}
+
+func TestMongoUserStore(t *testing.T) {
+	uri := mongoURI(t)
+	storetest.TestUserStore(t, func(t *testing.T) repository.UserStore {
+		return newMongoUserRepo(t, uri)
+	})
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserStore persists users and their person records. Implementations must
+// keep usernames and emails unique, report missing users as ErrUserNotFound
+// and only return active users from GetAll, GetUser and GetUserByIds.
+// GetUserByUsername returns inactive users too, so login can tell them apart.
+type UserStore interface {
+	GetAll(ctx context.Context) ([]model.User, error)
+	GetUser(ctx context.Context, id primitive.ObjectID) (*model.User, error)
+	// GetUserIncludingInactive is GetUser for admin actions that also apply
+	// to deactivated accounts.
+	GetUserIncludingInactive(ctx context.Context, id primitive.ObjectID) (*model.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	GetUserByIds(ctx context.Context, ids []primitive.ObjectID) ([]model.User, error)
+	GetPerson(ctx context.Context, userID primitive.ObjectID) (*model.Person, error)
+	GetPersonByEmail(ctx context.Context, email string) (*model.Person, error)
+	GetPersonsByUserIds(ctx context.Context, userIDs []primitive.ObjectID) ([]model.Person, error)
+	// CreateUser stores user and person atomically. The store assigns the
+	// person's ID and the user's unless it is already set; the user starts
+	// inactive.
+	CreateUser(ctx context.Context, user *model.User, person *model.Person, events ...model.Event) error
+	// The setters below report whether anything changed. events are written
+	// to the outbox atomically with the change, and only if there was one.
+	SetUserActive(ctx context.Context, id primitive.ObjectID, active bool, events ...model.Event) (bool, error)
+	SetUserRole(ctx context.Context, id primitive.ObjectID, role model.UserRole, events ...model.Event) (bool, error)
+	// UpdatePerson saves the profile fields (names, profile image and locale)
+	// of the person of person.UserID.
+	UpdatePerson(ctx context.Context, person *model.Person, events ...model.Event) (bool, error)
+	UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, passwordHash string) error
+	ReplacePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) (bool, error)
+	Disconnect(ctx context.Context) error
+}
+
+// LoginAttemptStore keeps the failed login counters used by the lockout.
+// RecordFailure must increment atomically and return the new count, the
+// login guard reserves attempts with it before checking the password.
+type LoginAttemptStore interface {
+	Get(ctx context.Context, key string) (*model.LoginAttempt, error)
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*model.LoginAttempt, error)
+	Block(ctx context.Context, key string, nextAttemptAt, lockedUntil time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+var (
+	_ UserStore         = (*UserRepo)(nil)
+	_ UserStore         = (*MemoryUserStore)(nil)
+	_ UserStore         = (*PostgresUserStore)(nil)
+	_ LoginAttemptStore = (*LoginAttemptRepo)(nil)
+	_ LoginAttemptStore = (*MemoryLoginAttemptStore)(nil)
+	_ LoginAttemptStore = (*PostgresLoginAttemptStore)(nil)
+)
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WebhookRepo keeps webhooks and their delivery queue in Mongo. A unique index
+// on webhook_id and event_id drops duplicate deliveries, a TTL index on
+// expires_at removes deliveries deliveryRetention after their last update.
+type WebhookRepo struct {
+	logger     *log.Logger
+	webhooks   *mongo.Collection
+	deliveries *mongo.Collection
+}
+
+func NewWebhookRepo(db *mongo.Database, logger *log.Logger) *WebhookRepo {
+	return &WebhookRepo{
+		logger:     logger,
+		webhooks:   db.Collection("webhooks"),
+		deliveries: db.Collection("webhook_deliveries"),
+	}
+}
+
+func (r *WebhookRepo) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	if _, err := r.webhooks.InsertOne(ctx, webhook); err != nil {
+		r.logger.Printf("Failed to insert webhook: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *WebhookRepo) GetWebhook(ctx context.Context, id primitive.ObjectID) (*model.Webhook, error) {
+	webhook := model.Webhook{}
+	err := r.webhooks.FindOne(ctx, bson.M{"_id": id}).Decode(&webhook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *WebhookRepo) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	cursor, err := r.webhooks.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	webhooks := []model.Webhook{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *WebhookRepo) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.webhooks.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	// A worker may still hold a claimed delivery, it is dropped once the
+	// webhook turns out to be gone.
+	_, err = r.deliveries.DeleteMany(ctx, bson.M{"webhook_id": id})
+	return err
+}
+
+// deliveryDocument adds the TTL field to a delivery.
+type deliveryDocument struct {
+	model.WebhookDelivery `bson:",inline"`
+	ExpiresAt             time.Time `bson:"expires_at"`
+}
+
+func (r *WebhookRepo) EnqueueDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	now := time.Now()
+	prepareDeliveries(deliveries, now)
+
+	documents := make([]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		documents[i] = deliveryDocument{WebhookDelivery: delivery, ExpiresAt: now.Add(deliveryRetention)}
+	}
+	// Unordered, so duplicates of a redelivered event don't stop the rest.
+	_, err := r.deliveries.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err != nil && !onlyDuplicateKeys(err) {
+		r.logger.Printf("Failed to enqueue webhook deliveries: %v", err)
+		return err
+	}
+	return nil
+}
+
+func onlyDuplicateKeys(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *WebhookRepo) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*model.WebhookDelivery, error) {
+	delivery := model.WebhookDelivery{}
+	err := r.deliveries.FindOneAndUpdate(ctx,
+		bson.M{"status": model.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}, "$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, id primitive.ObjectID, attempt model.DeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	result, err := r.deliveries.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$push": bson.M{"log": bson.M{"$each": []model.DeliveryAttempt{attempt}, "$slice": -maxDeliveryLog}},
+		"$set": bson.M{
+			"status":          status,
+			"next_attempt_at": nextAttemptAt,
+			"updated_at":      attempt.At,
+			"expires_at":      attempt.At.Add(deliveryRetention),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepo) ListDeliveries(ctx context.Context, webhookID primitive.ObjectID, limit int) ([]model.WebhookDelivery, error) {
+	cursor, err := r.deliveries.Find(ctx, bson.M{"webhook_id": webhookID},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []model.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *WebhookRepo) ReplayDelivery(ctx context.Context, id primitive.ObjectID, now time.Time) (*model.WebhookDelivery, error) {
+	delivery := model.WebhookDelivery{}
+	err := r.deliveries.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"status":          model.DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+		"expires_at":      now.Add(deliveryRetention),
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,17 @@
+package repository_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/MicroSOA-09/auth-service/repository/storetest"
+)
+
+func TestMongoWebhookStore(t *testing.T) {
+	uri := mongoURI(t)
+	storetest.TestWebhookStore(t, func(t *testing.T) repository.WebhookStore {
+		return repository.NewWebhookRepo(newMongoUserRepo(t, uri).Database(), log.New(io.Discard, "", 0))
+	})
+}
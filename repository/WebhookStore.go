@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrWebhookNotFound  = apperror.New(apperror.KindNotFound, "webhook.not_found", "webhook not found")
+	ErrDeliveryNotFound = apperror.New(apperror.KindNotFound, "webhook.delivery_not_found", "webhook delivery not found")
+)
+
+// WebhookStore keeps webhook subscriptions and the queue of their deliveries.
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhook(ctx context.Context, id primitive.ObjectID) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]model.Webhook, error)
+	// DeleteWebhook removes the webhook together with its deliveries.
+	DeleteWebhook(ctx context.Context, id primitive.ObjectID) error
+
+	// EnqueueDeliveries queues deliveries. A delivery of an event that is
+	// already queued for the same webhook is skipped, so an event relayed
+	// twice is still only delivered once.
+	EnqueueDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error
+	// ClaimDelivery returns the oldest pending delivery that is due and hides
+	// it from other workers for lease. It returns nil if none is due.
+	ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*model.WebhookDelivery, error)
+	// RecordAttempt logs the outcome of an attempt and sets the new status.
+	// nextAttemptAt only matters if the delivery stays pending.
+	RecordAttempt(ctx context.Context, id primitive.ObjectID, attempt model.DeliveryAttempt, status string, nextAttemptAt time.Time) error
+	// ListDeliveries returns the most recent deliveries of a webhook first.
+	ListDeliveries(ctx context.Context, webhookID primitive.ObjectID, limit int) ([]model.WebhookDelivery, error)
+	// ReplayDelivery queues a delivery again, whatever its status. The
+	// attempt counter restarts, the log is kept.
+	ReplayDelivery(ctx context.Context, id primitive.ObjectID, now time.Time) (*model.WebhookDelivery, error)
+}
+
+var (
+	_ WebhookStore = (*WebhookRepo)(nil)
+	_ WebhookStore = (*MemoryWebhookStore)(nil)
+	_ WebhookStore = (*PostgresWebhookStore)(nil)
+)
+
+const (
+	// maxDeliveryLog is the number of attempts kept in a delivery's log.
+	maxDeliveryLog = 20
+	// deliveryRetention is how long deliveries are kept after their last update.
+	deliveryRetention = 30 * 24 * time.Hour
+)
+
+// prepareDeliveries fills in the queue bookkeeping of new deliveries.
+func prepareDeliveries(deliveries []model.WebhookDelivery, now time.Time) {
+	for i := range deliveries {
+		if deliveries[i].ID.IsZero() {
+			deliveries[i].ID = primitive.NewObjectID()
+		}
+		deliveries[i].Status = model.DeliveryPending
+		deliveries[i].Attempts = 0
+		deliveries[i].NextAttemptAt = now
+		deliveries[i].Log = []model.DeliveryAttempt{}
+		deliveries[i].CreatedAt = now
+		deliveries[i].UpdatedAt = now
+	}
+}
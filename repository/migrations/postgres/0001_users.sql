@@ -0,0 +1,23 @@
+-- IDs are the hex form of Mongo ObjectIDs so both backends hand out the same
+-- identifiers to other services.
+CREATE TABLE users (
+    id            CHAR(24) PRIMARY KEY,
+    username      TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role          TEXT NOT NULL,
+    is_active     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT users_username_key UNIQUE (username)
+);
+
+CREATE TABLE persons (
+    id            CHAR(24) PRIMARY KEY,
+    user_id       CHAR(24) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    first_name    TEXT NOT NULL,
+    last_name     TEXT NOT NULL,
+    email         TEXT NOT NULL,
+    profile_image TEXT NOT NULL DEFAULT '',
+    locale        TEXT NOT NULL DEFAULT '',
+    CONSTRAINT persons_user_id_key UNIQUE (user_id),
+    CONSTRAINT persons_email_key UNIQUE (email)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE outbox (
+    id              CHAR(24) PRIMARY KEY,
+    type            TEXT NOT NULL,
+    aggregate_id    TEXT NOT NULL,
+    occurred_at     TIMESTAMPTZ NOT NULL,
+    payload         JSONB NOT NULL,
+    published_at    TIMESTAMPTZ,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at, id) WHERE published_at IS NULL;
+CREATE INDEX outbox_published_at_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
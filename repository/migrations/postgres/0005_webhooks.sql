@@ -0,0 +1,27 @@
+CREATE TABLE webhooks (
+    id         CHAR(24) PRIMARY KEY,
+    url        TEXT NOT NULL,
+    events     TEXT[] NOT NULL,
+    secret     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+-- log holds the most recent attempts as a JSON array.
+CREATE TABLE webhook_deliveries (
+    id              CHAR(24) PRIMARY KEY,
+    webhook_id      CHAR(24) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id        CHAR(24) NOT NULL,
+    event_type      TEXT NOT NULL,
+    payload         JSONB NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    log             JSONB NOT NULL DEFAULT '[]',
+    created_at      TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL,
+    CONSTRAINT webhook_deliveries_event_key UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id DESC);
+CREATE INDEX webhook_deliveries_updated_at_idx ON webhook_deliveries (updated_at) WHERE status <> 'pending';
@@ -0,0 +1,33 @@
+CREATE TABLE audit_log (
+    seq        BIGINT PRIMARY KEY,
+    id         CHAR(24) NOT NULL UNIQUE,
+    time       TIMESTAMPTZ NOT NULL,
+    action     TEXT NOT NULL,
+    result     TEXT NOT NULL,
+    actor_id   TEXT NOT NULL DEFAULT '',
+    actor_name TEXT NOT NULL DEFAULT '',
+    target_id  TEXT NOT NULL DEFAULT '',
+    ip         TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    details    JSONB,
+    prev_hash  TEXT NOT NULL,
+    hash       TEXT NOT NULL
+);
+
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id, seq DESC);
+CREATE INDEX audit_log_target_idx ON audit_log (target_id, seq DESC);
+CREATE INDEX audit_log_action_idx ON audit_log (action, seq DESC);
+CREATE INDEX audit_log_time_idx ON audit_log (time);
+
+-- The log is append-only, also for anyone with direct database access who
+-- doesn't own the table.
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,15 @@
+CREATE TABLE sessions (
+    id                  CHAR(24) PRIMARY KEY,
+    user_id             CHAR(24) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    device              TEXT NOT NULL,
+    user_agent          TEXT NOT NULL,
+    ip                  TEXT NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL,
+    last_seen_at        TIMESTAMPTZ NOT NULL,
+    expires_at          TIMESTAMPTZ NOT NULL,
+    refresh_token_hash  TEXT NOT NULL UNIQUE,
+    used_refresh_tokens TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX sessions_user_idx ON sessions (user_id, last_seen_at DESC);
+CREATE INDEX sessions_used_refresh_tokens_idx ON sessions USING GIN (used_refresh_tokens);
@@ -0,0 +1,12 @@
+CREATE TABLE known_devices (
+    user_id       CHAR(24) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    fingerprint   TEXT NOT NULL,
+    device        TEXT NOT NULL,
+    location      TEXT NOT NULL,
+    ip            TEXT NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, fingerprint)
+);
+
+ALTER TABLE sessions ADD COLUMN location TEXT NOT NULL DEFAULT '';
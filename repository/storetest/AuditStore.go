@@ -0,0 +1,155 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+// TestAuditStore runs the conformance suite. newStore is called once per
+// subtest and must return an empty store.
+func TestAuditStore(t *testing.T, newStore func(t *testing.T) repository.AuditStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store repository.AuditStore)
+	}{
+		{"AppendChainsEntries", testAuditChain},
+		{"QueryFilters", testAuditQueryFilters},
+		{"QueryPages", testAuditQueryPages},
+		{"ExportIsOldestFirst", testAuditExport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func appendAudit(t *testing.T, store repository.AuditStore, entry model.AuditEntry) model.AuditEntry {
+	t.Helper()
+	if entry.Result == "" {
+		entry.Result = model.AuditSuccess
+	}
+	if err := store.AppendAudit(context.Background(), &entry); err != nil {
+		t.Fatalf("AppendAudit: %v", err)
+	}
+	return entry
+}
+
+func testAuditChain(t *testing.T, store repository.AuditStore) {
+	first := appendAudit(t, store, model.AuditEntry{Action: model.AuditLogin, ActorID: "a", Details: map[string]string{"reason": "x"}})
+	second := appendAudit(t, store, model.AuditEntry{Action: model.AuditLogin, ActorID: "b"})
+	if first.Seq != 1 || first.PrevHash != "" || first.ID.IsZero() {
+		t.Fatalf("first entry = seq %d, prev %q, id %s", first.Seq, first.PrevHash, first.ID.Hex())
+	}
+	if second.Seq != 2 || second.PrevHash != first.Hash {
+		t.Fatalf("second entry = seq %d, prev %q, want 2 linked to %q", second.Seq, second.PrevHash, first.Hash)
+	}
+
+	// Stored entries must hash to the same value, i.e. round trip unchanged.
+	entries, err := store.QueryAudit(context.Background(), repository.AuditFilter{}, 10)
+	if err != nil {
+		t.Fatalf("QueryAudit: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("QueryAudit returned %d entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.ComputeHash() != entry.Hash {
+			t.Errorf("entry %d doesn't match its hash after reading it back", entry.Seq)
+		}
+	}
+	if entries[1].Details["reason"] != "x" {
+		t.Errorf("details = %v, want reason x", entries[1].Details)
+	}
+}
+
+func testAuditQueryFilters(t *testing.T, store repository.AuditStore) {
+	base := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Hour)
+	appendAudit(t, store, model.AuditEntry{Time: base, Action: model.AuditLogin, ActorID: "u1"})
+	appendAudit(t, store, model.AuditEntry{Time: base.Add(time.Minute), Action: model.AuditRoleChange, ActorID: "admin", TargetID: "u1"})
+	appendAudit(t, store, model.AuditEntry{Time: base.Add(2 * time.Minute), Action: model.AuditLogin, ActorID: "u2"})
+
+	tests := []struct {
+		name   string
+		filter repository.AuditFilter
+		want   []int64
+	}{
+		{"All", repository.AuditFilter{}, []int64{3, 2, 1}},
+		{"ActorOrTarget", repository.AuditFilter{UserID: "u1"}, []int64{2, 1}},
+		{"Action", repository.AuditFilter{Action: model.AuditLogin}, []int64{3, 1}},
+		{"TimeRange", repository.AuditFilter{From: base.Add(time.Minute), To: base.Add(2 * time.Minute)}, []int64{2}},
+		{"Combined", repository.AuditFilter{UserID: "u1", Action: model.AuditLogin}, []int64{1}},
+		{"NoMatch", repository.AuditFilter{UserID: "nobody"}, []int64{}},
+	}
+	for _, tt := range tests {
+		entries, err := store.QueryAudit(context.Background(), tt.filter, 10)
+		if err != nil {
+			t.Fatalf("%s: QueryAudit: %v", tt.name, err)
+		}
+		if got := auditSeqs(entries); !equalSeqs(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testAuditQueryPages(t *testing.T, store repository.AuditStore) {
+	for i := 0; i < 5; i++ {
+		appendAudit(t, store, model.AuditEntry{Action: model.AuditLogin})
+	}
+	page, err := store.QueryAudit(context.Background(), repository.AuditFilter{}, 2)
+	if err != nil {
+		t.Fatalf("QueryAudit: %v", err)
+	}
+	if got := auditSeqs(page); !equalSeqs(got, []int64{5, 4}) {
+		t.Fatalf("first page = %v, want [5 4]", got)
+	}
+	page, err = store.QueryAudit(context.Background(), repository.AuditFilter{BeforeSeq: 4}, 2)
+	if err != nil {
+		t.Fatalf("QueryAudit: %v", err)
+	}
+	if got := auditSeqs(page); !equalSeqs(got, []int64{3, 2}) {
+		t.Fatalf("second page = %v, want [3 2]", got)
+	}
+}
+
+func testAuditExport(t *testing.T, store repository.AuditStore) {
+	appendAudit(t, store, model.AuditEntry{Action: model.AuditLogin, ActorID: "u1"})
+	appendAudit(t, store, model.AuditEntry{Action: model.AuditLogin, ActorID: "u2"})
+	appendAudit(t, store, model.AuditEntry{Action: model.AuditLogin, ActorID: "u1"})
+
+	var got []int64
+	err := store.ExportAudit(context.Background(), repository.AuditFilter{UserID: "u1"}, func(entry model.AuditEntry) error {
+		got = append(got, entry.Seq)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ExportAudit: %v", err)
+	}
+	if !equalSeqs(got, []int64{1, 3}) {
+		t.Errorf("exported %v, want [1 3]", got)
+	}
+}
+
+func auditSeqs(entries []model.AuditEntry) []int64 {
+	seqs := []int64{}
+	for _, entry := range entries {
+		seqs = append(seqs, entry.Seq)
+	}
+	return seqs
+}
+
+func equalSeqs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
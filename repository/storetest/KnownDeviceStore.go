@@ -0,0 +1,79 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestKnownDeviceStore runs the conformance suite against a store returned by
+// newStore. newUser creates the user a device belongs to.
+func TestKnownDeviceStore(t *testing.T, newStore func(t *testing.T) repository.KnownDeviceStore, newUser func(t *testing.T) primitive.ObjectID) {
+	ctx := context.Background()
+	store := newStore(t)
+	alice, bob := newUser(t), newUser(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	remember := func(userID primitive.ObjectID, fingerprint string, at time.Time) (*model.KnownDevice, bool) {
+		t.Helper()
+		device := &model.KnownDevice{
+			UserID:      userID,
+			Fingerprint: fingerprint,
+			Device:      "Firefox on Linux",
+			Location:    "Novi Sad, Serbia",
+			IP:          "192.0.2.1",
+			FirstSeenAt: at,
+			LastSeenAt:  at,
+		}
+		known, err := store.RememberDevice(ctx, device)
+		if err != nil {
+			t.Fatalf("RememberDevice: %v", err)
+		}
+		return device, known
+	}
+	count := func(userID primitive.ObjectID) int64 {
+		t.Helper()
+		n, err := store.CountDevices(ctx, userID)
+		if err != nil {
+			t.Fatalf("CountDevices: %v", err)
+		}
+		return n
+	}
+
+	if _, known := remember(alice, "laptop", now.Add(-time.Hour)); known {
+		t.Error("first login from a device is reported as known")
+	}
+	device, known := remember(alice, "laptop", now)
+	if !known {
+		t.Error("second login from a device is reported as new")
+	}
+	if !device.FirstSeenAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("FirstSeenAt = %v, want the first login %v", device.FirstSeenAt, now.Add(-time.Hour))
+	}
+	if _, known := remember(alice, "phone", now); known {
+		t.Error("another device is reported as known")
+	}
+	if _, known := remember(bob, "laptop", now); known {
+		t.Error("a device of another user is reported as known")
+	}
+	if got := count(alice); got != 2 {
+		t.Errorf("CountDevices = %d, want 2", got)
+	}
+
+	if err := store.ForgetDevices(ctx, alice); err != nil {
+		t.Fatalf("ForgetDevices: %v", err)
+	}
+	if got := count(alice); got != 0 {
+		t.Errorf("CountDevices after ForgetDevices = %d, want 0", got)
+	}
+	if got := count(bob); got != 1 {
+		t.Errorf("ForgetDevices touched other users, %d devices left", got)
+	}
+	if _, known := remember(alice, "laptop", now); known {
+		t.Error("forgotten device is reported as known")
+	}
+}
@@ -0,0 +1,168 @@
+package storetest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+// TestLoginAttemptStore runs the conformance suite. newStore is called once
+// per subtest and must return an empty store.
+func TestLoginAttemptStore(t *testing.T, newStore func(t *testing.T) repository.LoginAttemptStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store repository.LoginAttemptStore)
+	}{
+		{"UnknownKey", testLoginAttemptUnknownKey},
+		{"RecordFailureCounts", testLoginAttemptCounts},
+		{"ConcurrentFailuresGetDistinctCounts", testLoginAttemptConcurrent},
+		{"ExpiredCountersRestart", testLoginAttemptExpiry},
+		{"BlockOnlyExtends", testLoginAttemptBlock},
+		{"Reset", testLoginAttemptReset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func testLoginAttemptUnknownKey(t *testing.T, store repository.LoginAttemptStore) {
+	attempt, err := store.Get(context.Background(), "user:nobody")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if attempt.Key != "user:nobody" || attempt.Failures != 0 || !attempt.LockedUntil.IsZero() {
+		t.Errorf("Get(unknown) = %+v, want an empty attempt", attempt)
+	}
+}
+
+func testLoginAttemptCounts(t *testing.T, store repository.LoginAttemptStore) {
+	ctx := context.Background()
+	now := time.Now()
+	for want := 1; want <= 3; want++ {
+		attempt, err := store.RecordFailure(ctx, "user:alice", now, time.Hour)
+		if err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+		if attempt.Failures != want {
+			t.Fatalf("RecordFailure #%d returned %d failures", want, attempt.Failures)
+		}
+	}
+	if _, err := store.RecordFailure(ctx, "user:bob", now, time.Hour); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+
+	attempt, err := store.Get(ctx, "user:alice")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if attempt.Failures != 3 {
+		t.Errorf("Get returned %d failures, want 3", attempt.Failures)
+	}
+}
+
+// The login guard relies on every concurrent attempt getting its own count.
+func testLoginAttemptConcurrent(t *testing.T, store repository.LoginAttemptStore) {
+	const attempts = 20
+	var wg sync.WaitGroup
+	counts := make([]int, attempts)
+	errs := make([]error, attempts)
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt, err := store.RecordFailure(context.Background(), "user:alice", time.Now(), time.Hour)
+			errs[i] = err
+			if err == nil {
+				counts[i] = attempt.Failures
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+	sort.Ints(counts)
+	for i, count := range counts {
+		if count != i+1 {
+			t.Fatalf("concurrent RecordFailure returned counts %v, want 1 to %d once each", counts, attempts)
+		}
+	}
+}
+
+func testLoginAttemptExpiry(t *testing.T, store repository.LoginAttemptStore) {
+	ctx := context.Background()
+	past := time.Now().Add(-2 * time.Hour)
+	for range 3 {
+		if _, err := store.RecordFailure(ctx, "user:alice", past, time.Hour); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+
+	attempt, err := store.Get(ctx, "user:alice")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if attempt.Failures != 0 {
+		t.Errorf("Get(expired) returned %d failures, want 0", attempt.Failures)
+	}
+
+	attempt, err = store.RecordFailure(ctx, "user:alice", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if attempt.Failures != 1 {
+		t.Errorf("RecordFailure after expiry returned %d failures, want 1", attempt.Failures)
+	}
+}
+
+func testLoginAttemptBlock(t *testing.T, store repository.LoginAttemptStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if _, err := store.RecordFailure(ctx, "user:alice", now, time.Hour); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if err := store.Block(ctx, "user:alice", now.Add(2*time.Minute), now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+	// A concurrent writer with earlier times must not shorten the block.
+	if err := store.Block(ctx, "user:alice", now.Add(time.Minute), time.Time{}); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+
+	attempt, err := store.Get(ctx, "user:alice")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !attempt.NextAttemptAt.Equal(now.Add(2 * time.Minute)) {
+		t.Errorf("NextAttemptAt = %v, want %v", attempt.NextAttemptAt, now.Add(2*time.Minute))
+	}
+	if !attempt.LockedUntil.Equal(now.Add(2 * time.Hour)) {
+		t.Errorf("LockedUntil = %v, want %v", attempt.LockedUntil, now.Add(2*time.Hour))
+	}
+}
+
+func testLoginAttemptReset(t *testing.T, store repository.LoginAttemptStore) {
+	ctx := context.Background()
+	if _, err := store.RecordFailure(ctx, "user:alice", time.Now(), time.Hour); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if err := store.Reset(ctx, "user:alice"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	attempt, err := store.Get(ctx, "user:alice")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if attempt.Failures != 0 {
+		t.Errorf("Get after Reset returned %d failures, want 0", attempt.Failures)
+	}
+}
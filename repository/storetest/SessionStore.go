@@ -0,0 +1,241 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestSessionStore runs the conformance suite. newStore is called once per
+// subtest and must return an empty store. Stores with foreign keys to users
+// need the user IDs to exist, newUser creates one.
+func TestSessionStore(t *testing.T, newStore func(t *testing.T) repository.SessionStore, newUser func(t *testing.T) primitive.ObjectID) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store repository.SessionStore, newUser func(t *testing.T) primitive.ObjectID)
+	}{
+		{"Sessions", testSessions},
+		{"RotateRefreshToken", testRotateRefreshToken},
+		{"RefreshTokenReuseRevokes", testRefreshTokenReuse},
+		{"ExpiredSessionsAreHidden", testExpiredSessions},
+		{"DeleteSessions", testDeleteSessions},
+		{"EvictSessions", testEvictSessions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t), newUser)
+		})
+	}
+}
+
+func createSession(t *testing.T, store repository.SessionStore, userID primitive.ObjectID, token string, lastSeen time.Time) *model.Session {
+	t.Helper()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	session := &model.Session{
+		UserID:           userID,
+		Device:           "Firefox on Linux",
+		UserAgent:        "Mozilla/5.0 (X11; Linux x86_64) Firefox/130.0",
+		IP:               "192.0.2.1",
+		CreatedAt:        now,
+		LastSeenAt:       lastSeen,
+		ExpiresAt:        now.Add(time.Hour),
+		RefreshTokenHash: token,
+	}
+	if err := store.CreateSession(context.Background(), session); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if session.ID.IsZero() {
+		t.Fatal("CreateSession didn't assign an ID")
+	}
+	return session
+}
+
+func sessionIDs(sessions []model.Session) []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
+
+func testSessions(t *testing.T, store repository.SessionStore, newUser func(t *testing.T) primitive.ObjectID) {
+	ctx := context.Background()
+	alice, bob := newUser(t), newUser(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	older := createSession(t, store, alice, "a1", now.Add(-time.Hour))
+	newer := createSession(t, store, alice, "a2", now)
+	createSession(t, store, bob, "b1", now)
+
+	got, err := store.GetSession(ctx, older.ID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if got.UserID != alice || got.Device != older.Device || got.IP != older.IP || !got.LastSeenAt.Equal(older.LastSeenAt) {
+		t.Errorf("GetSession = %+v, want %+v", got, older)
+	}
+	if _, err := store.GetSession(ctx, primitive.NewObjectID()); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("GetSession of unknown ID: %v, want ErrSessionNotFound", err)
+	}
+
+	sessions, err := store.ListSessions(ctx, alice)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if got, want := sessionIDs(sessions), []primitive.ObjectID{newer.ID, older.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ListSessions = %v, want most recently seen first %v", got, want)
+	}
+
+	if err := store.TouchSession(ctx, older.ID, now, "198.51.100.7"); err != nil {
+		t.Fatalf("TouchSession: %v", err)
+	}
+	if got, _ := store.GetSession(ctx, older.ID); got == nil || !got.LastSeenAt.Equal(now) || got.IP != "198.51.100.7" {
+		t.Errorf("TouchSession didn't record the activity: %+v", got)
+	}
+	if err := store.TouchSession(ctx, primitive.NewObjectID(), now, ""); err != nil {
+		t.Errorf("TouchSession of unknown ID: %v", err)
+	}
+
+	if err := store.DeleteSession(ctx, bob, older.ID); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("DeleteSession of someone else's session: %v, want ErrSessionNotFound", err)
+	}
+	if err := store.DeleteSession(ctx, alice, older.ID); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if _, err := store.GetSession(ctx, older.ID); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("GetSession after delete: %v, want ErrSessionNotFound", err)
+	}
+}
+
+func testRotateRefreshToken(t *testing.T, store repository.SessionStore, newUser func(t *testing.T) primitive.ObjectID) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	session := createSession(t, store, newUser(t), "t1", now.Add(-time.Hour))
+
+	expiresAt := now.Add(2 * time.Hour)
+	rotated, err := store.RotateRefreshToken(ctx, "t1", "t2", now, expiresAt, "198.51.100.7")
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if rotated.ID != session.ID || rotated.RefreshTokenHash != "t2" || !rotated.LastSeenAt.Equal(now) ||
+		!rotated.ExpiresAt.Equal(expiresAt) || rotated.IP != "198.51.100.7" {
+		t.Errorf("RotateRefreshToken = %+v", rotated)
+	}
+	if _, err := store.RotateRefreshToken(ctx, "unknown", "t3", now, expiresAt, ""); !errors.Is(err, repository.ErrRefreshTokenInvalid) {
+		t.Errorf("RotateRefreshToken of unknown token: %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	// Only the most recent used tokens are remembered.
+	for i := 2; i < 20; i++ {
+		if _, err := store.RotateRefreshToken(ctx, fmt.Sprint("t", i), fmt.Sprint("t", i+1), now, expiresAt, ""); err != nil {
+			t.Fatalf("RotateRefreshToken %d: %v", i, err)
+		}
+	}
+	got, err := store.GetSession(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if len(got.UsedRefreshTokens) >= 18 || got.UsedRefreshTokens[0] != "t19" {
+		t.Errorf("UsedRefreshTokens = %v, want a capped list starting with t19", got.UsedRefreshTokens)
+	}
+}
+
+func testRefreshTokenReuse(t *testing.T, store repository.SessionStore, newUser func(t *testing.T) primitive.ObjectID) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	session := createSession(t, store, newUser(t), "t1", now)
+	if _, err := store.RotateRefreshToken(ctx, "t1", "t2", now, now.Add(time.Hour), ""); err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+
+	if _, err := store.RotateRefreshToken(ctx, "t1", "t3", now, now.Add(time.Hour), ""); !errors.Is(err, repository.ErrRefreshTokenReused) {
+		t.Fatalf("RotateRefreshToken with a used token: %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := store.GetSession(ctx, session.ID); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("session survived refresh token reuse: %v", err)
+	}
+	if _, err := store.RotateRefreshToken(ctx, "t2", "t3", now, now.Add(time.Hour), ""); err == nil {
+		t.Error("the current token of a revoked session still rotates")
+	}
+}
+
+func testExpiredSessions(t *testing.T, store repository.SessionStore, newUser func(t *testing.T) primitive.ObjectID) {
+	ctx := context.Background()
+	userID := newUser(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	session := &model.Session{
+		UserID:           userID,
+		CreatedAt:        now.Add(-2 * time.Hour),
+		LastSeenAt:       now.Add(-2 * time.Hour),
+		ExpiresAt:        now.Add(-time.Hour),
+		RefreshTokenHash: "expired",
+	}
+	if err := store.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	if _, err := store.GetSession(ctx, session.ID); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("GetSession of expired session: %v, want ErrSessionNotFound", err)
+	}
+	if sessions, _ := store.ListSessions(ctx, userID); len(sessions) != 0 {
+		t.Errorf("ListSessions returned %d expired sessions", len(sessions))
+	}
+	if _, err := store.RotateRefreshToken(ctx, "expired", "next", now, now.Add(time.Hour), ""); !errors.Is(err, repository.ErrRefreshTokenInvalid) {
+		t.Errorf("RotateRefreshToken of expired session: %v, want ErrRefreshTokenInvalid", err)
+	}
+}
+
+func testDeleteSessions(t *testing.T, store repository.SessionStore, newUser func(t *testing.T) primitive.ObjectID) {
+	ctx := context.Background()
+	alice, bob := newUser(t), newUser(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	keep := createSession(t, store, alice, "a1", now)
+	createSession(t, store, alice, "a2", now)
+	createSession(t, store, alice, "a3", now)
+	createSession(t, store, bob, "b1", now)
+
+	deleted, err := store.DeleteSessions(ctx, alice, keep.ID)
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeleteSessions = %d, %v, want 2", deleted, err)
+	}
+	if sessions, _ := store.ListSessions(ctx, alice); len(sessions) != 1 || sessions[0].ID != keep.ID {
+		t.Errorf("sessions left = %v, want only %s", sessionIDs(sessions), keep.ID.Hex())
+	}
+	deleted, err = store.DeleteSessions(ctx, alice, primitive.NilObjectID)
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteSessions of all = %d, %v, want 1", deleted, err)
+	}
+	if sessions, _ := store.ListSessions(ctx, bob); len(sessions) != 1 {
+		t.Errorf("other users lost sessions, %d left", len(sessions))
+	}
+}
+
+func testEvictSessions(t *testing.T, store repository.SessionStore, newUser func(t *testing.T) primitive.ObjectID) {
+	ctx := context.Background()
+	userID := newUser(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	oldest := createSession(t, store, userID, "s1", now.Add(-3*time.Hour))
+	middle := createSession(t, store, userID, "s2", now.Add(-2*time.Hour))
+	newest := createSession(t, store, userID, "s3", now)
+
+	evicted, err := store.EvictSessions(ctx, userID, 3)
+	if err != nil || evicted != 0 {
+		t.Fatalf("EvictSessions within the limit = %d, %v, want 0", evicted, err)
+	}
+	evicted, err = store.EvictSessions(ctx, userID, 2)
+	if err != nil || evicted != 1 {
+		t.Fatalf("EvictSessions = %d, %v, want 1", evicted, err)
+	}
+	sessions, err := store.ListSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if got, want := sessionIDs(sessions), []primitive.ObjectID{newest.ID, middle.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("sessions left = %v, want %v without %s", got, want, oldest.ID.Hex())
+	}
+}
@@ -0,0 +1,431 @@
+// Package storetest holds the behaviour every repository.UserStore,
+// repository.LoginAttemptStore, repository.WebhookStore,
+// repository.AuditStore, repository.SessionStore and
+// repository.KnownDeviceStore has to show. Backend tests call the matching
+// Test function with a constructor for an empty store.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestUserStore runs the conformance suite. newStore is called once per
+// subtest and must return an empty store.
+func TestUserStore(t *testing.T, newStore func(t *testing.T) repository.UserStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store repository.UserStore)
+	}{
+		{"CreateAssignsIDsAndStartsInactive", testCreateAssignsIDs},
+		{"DuplicateUsername", testDuplicateUsername},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"CanonicalUniqueness", testCanonicalUniqueness},
+		{"FailedCreateStoresNothing", testFailedCreateStoresNothing},
+		{"InactiveUsersAreHidden", testInactiveUsersAreHidden},
+		{"GetPerson", testGetPerson},
+		{"GetUserByIds", testGetUserByIds},
+		{"UpdatePasswordHash", testUpdatePasswordHash},
+		{"ReplacePasswordHash", testReplacePasswordHash},
+		{"UnknownUser", testUnknownUser},
+		{"Updates", testUpdates},
+		{"Outbox", testOutbox},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore(t)
+			t.Cleanup(func() { store.Disconnect(context.Background()) })
+			tt.fn(t, store)
+		})
+	}
+}
+
+func newUser(username, email string) (*model.User, *model.Person) {
+	user := &model.User{Username: username, PasswordHash: "$hash$" + username, Role: model.RoleTourist}
+	person := &model.Person{FirstName: "First", LastName: "Last", Email: email, Locale: "en"}
+	return user, person
+}
+
+// create stores a user and fails the test on error. active users are
+// activated after creation.
+func create(t *testing.T, store repository.UserStore, username, email string, active bool) *model.User {
+	t.Helper()
+	ctx := context.Background()
+	user, person := newUser(username, email)
+	if err := store.CreateUser(ctx, user, person); err != nil {
+		t.Fatalf("CreateUser(%s): %v", username, err)
+	}
+	if active {
+		if _, err := store.SetUserActive(ctx, user.ID, true); err != nil {
+			t.Fatalf("SetUserActive(%s): %v", username, err)
+		}
+		user.IsActive = true
+	}
+	return user
+}
+
+func testCreateAssignsIDs(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	user, person := newUser("alice", "alice@example.com")
+	user.IsActive = true
+	if err := store.CreateUser(ctx, user, person); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if user.ID.IsZero() || person.ID.IsZero() {
+		t.Fatalf("IDs not assigned: user %v, person %v", user.ID, person.ID)
+	}
+	if person.UserID != user.ID {
+		t.Errorf("person.UserID = %v, want %v", person.UserID, user.ID)
+	}
+	if user.IsActive {
+		t.Errorf("new user is active")
+	}
+	if _, err := store.GetUser(ctx, user.ID); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetUser of new user: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func testDuplicateUsername(t *testing.T, store repository.UserStore) {
+	create(t, store, "alice", "alice@example.com", false)
+
+	user, person := newUser("alice", "other@example.com")
+	if err := store.CreateUser(context.Background(), user, person); !errors.Is(err, repository.ErrDuplicateUser) {
+		t.Errorf("err = %v, want ErrDuplicateUser", err)
+	}
+}
+
+func testDuplicateEmail(t *testing.T, store repository.UserStore) {
+	create(t, store, "alice", "alice@example.com", false)
+
+	user, person := newUser("bob", "alice@example.com")
+	if err := store.CreateUser(context.Background(), user, person); !errors.Is(err, repository.ErrDuplicateUser) {
+		t.Errorf("err = %v, want ErrDuplicateUser", err)
+	}
+}
+
+// testCanonicalUniqueness checks that usernames and emails are unique and
+// looked up after case folding and normalization.
+func testCanonicalUniqueness(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	alice := create(t, store, "Alice", "Alice@Example.com", true)
+	if alice.UsernameCanonical != "alice" {
+		t.Errorf("UsernameCanonical = %q, want alice", alice.UsernameCanonical)
+	}
+
+	for _, tt := range []struct{ username, email string }{
+		{"alice", "other@example.com"},
+		{"ＡＬＩＣＥ", "other@example.com"},
+		{"bob", "alice@example.COM"},
+		{"bob", " ALICE@example.com "},
+	} {
+		user, person := newUser(tt.username, tt.email)
+		if err := store.CreateUser(ctx, user, person); !errors.Is(err, repository.ErrDuplicateUser) {
+			t.Errorf("CreateUser(%q, %q): err = %v, want ErrDuplicateUser", tt.username, tt.email, err)
+		}
+	}
+
+	got, err := store.GetUserByUsername(ctx, "ALICE")
+	if err != nil || got.ID != alice.ID {
+		t.Fatalf("GetUserByUsername(ALICE) = %v, %v", got, err)
+	}
+	if got.Username != "Alice" {
+		t.Errorf("Username = %q, want the spelling given at registration", got.Username)
+	}
+	person, err := store.GetPersonByEmail(ctx, "alice@EXAMPLE.com")
+	if err != nil || person.UserID != alice.ID {
+		t.Errorf("GetPersonByEmail = %v, %v", person, err)
+	}
+	if person != nil && person.Email != "Alice@Example.com" {
+		t.Errorf("Email = %q, want the spelling given at registration", person.Email)
+	}
+}
+
+// testFailedCreateStoresNothing checks that user and person are written
+// together: a rejected person must not leave its user behind.
+func testFailedCreateStoresNothing(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	create(t, store, "alice", "alice@example.com", false)
+
+	user, person := newUser("bob", "alice@example.com")
+	if err := store.CreateUser(ctx, user, person); err == nil {
+		t.Fatal("CreateUser with duplicate email succeeded")
+	}
+
+	user, person = newUser("bob", "bob@example.com")
+	if err := store.CreateUser(ctx, user, person); err != nil {
+		t.Errorf("CreateUser after failed attempt: %v", err)
+	}
+}
+
+func testInactiveUsersAreHidden(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	active := create(t, store, "alice", "alice@example.com", true)
+	inactive := create(t, store, "bob", "bob@example.com", false)
+
+	users, err := store.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != active.ID {
+		t.Errorf("GetAll = %v, want only %s", users, active.Username)
+	}
+
+	if got, err := store.GetUser(ctx, active.ID); err != nil || got.Username != "alice" {
+		t.Errorf("GetUser(active) = %v, %v", got, err)
+	}
+	if got, err := store.GetUserByUsername(ctx, "alice"); err != nil || got.ID != active.ID {
+		t.Errorf("GetUserByUsername(active) = %v, %v", got, err)
+	}
+	if got, err := store.GetUserByUsername(ctx, "bob"); err != nil || got.IsActive {
+		t.Errorf("GetUserByUsername(inactive) = %v, %v, want the inactive user", got, err)
+	}
+	if got, err := store.GetUserIncludingInactive(ctx, inactive.ID); err != nil || got.Username != "bob" || got.IsActive {
+		t.Errorf("GetUserIncludingInactive(inactive) = %v, %v, want the inactive user", got, err)
+	}
+	if got, err := store.GetUserIncludingInactive(ctx, active.ID); err != nil || !got.IsActive {
+		t.Errorf("GetUserIncludingInactive(active) = %v, %v", got, err)
+	}
+	if _, err := store.GetUserIncludingInactive(ctx, primitive.NewObjectID()); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetUserIncludingInactive(unknown): err = %v, want ErrUserNotFound", err)
+	}
+
+	if _, err := store.SetUserActive(ctx, active.ID, false); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	if _, err := store.GetUser(ctx, active.ID); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetUser(deactivated): err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := store.SetUserActive(ctx, inactive.ID, true); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	if _, err := store.GetUser(ctx, inactive.ID); err != nil {
+		t.Errorf("GetUser(activated): %v", err)
+	}
+}
+
+func testGetPerson(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	user := create(t, store, "alice", "alice@example.com", false)
+
+	person, err := store.GetPerson(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetPerson: %v", err)
+	}
+	if person.Email != "alice@example.com" || person.UserID != user.ID || person.Locale != "en" {
+		t.Errorf("GetPerson = %+v", person)
+	}
+
+	person, err = store.GetPersonByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("GetPersonByEmail: %v", err)
+	}
+	if person.UserID != user.ID {
+		t.Errorf("GetPersonByEmail.UserID = %v, want %v", person.UserID, user.ID)
+	}
+	if _, err := store.GetPersonByEmail(ctx, "nobody@example.com"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetPersonByEmail(unknown): err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func testGetUserByIds(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	alice := create(t, store, "alice", "alice@example.com", true)
+	bob := create(t, store, "bob", "bob@example.com", true)
+	create(t, store, "carol", "carol@example.com", true)
+	dave := create(t, store, "dave", "dave@example.com", false)
+
+	users, err := store.GetUserByIds(ctx, []primitive.ObjectID{alice.ID, bob.ID, alice.ID, dave.ID, primitive.NewObjectID()})
+	if err != nil {
+		t.Fatalf("GetUserByIds: %v", err)
+	}
+	names := map[string]int{}
+	for _, user := range users {
+		names[user.Username]++
+	}
+	if len(users) != 2 || names["alice"] != 1 || names["bob"] != 1 {
+		t.Errorf("GetUserByIds = %v, want alice and bob once each", users)
+	}
+
+	persons, err := store.GetPersonsByUserIds(ctx, []primitive.ObjectID{alice.ID, dave.ID, primitive.NewObjectID()})
+	if err != nil {
+		t.Fatalf("GetPersonsByUserIds: %v", err)
+	}
+	emails := map[string]bool{}
+	for _, person := range persons {
+		emails[person.Email] = true
+	}
+	if len(persons) != 2 || !emails["alice@example.com"] || !emails["dave@example.com"] {
+		t.Errorf("GetPersonsByUserIds = %v, want the persons of alice and dave", persons)
+	}
+
+	users, err = store.GetUserByIds(ctx, nil)
+	if err != nil || len(users) != 0 {
+		t.Errorf("GetUserByIds(nil) = %v, %v", users, err)
+	}
+}
+
+func testUpdatePasswordHash(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	user := create(t, store, "alice", "alice@example.com", true)
+
+	if err := store.UpdatePasswordHash(ctx, user.ID, "$new"); err != nil {
+		t.Fatalf("UpdatePasswordHash: %v", err)
+	}
+	got, err := store.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got.PasswordHash != "$new" {
+		t.Errorf("PasswordHash = %q, want $new", got.PasswordHash)
+	}
+}
+
+func testReplacePasswordHash(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	user := create(t, store, "alice", "alice@example.com", true)
+
+	replaced, err := store.ReplacePasswordHash(ctx, user.ID, "$stale", "$new")
+	if err != nil || replaced {
+		t.Errorf("ReplacePasswordHash(stale) = %v, %v, want false", replaced, err)
+	}
+	replaced, err = store.ReplacePasswordHash(ctx, user.ID, user.PasswordHash, "$new")
+	if err != nil || !replaced {
+		t.Errorf("ReplacePasswordHash(current) = %v, %v, want true", replaced, err)
+	}
+	got, err := store.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got.PasswordHash != "$new" {
+		t.Errorf("PasswordHash = %q, want $new", got.PasswordHash)
+	}
+}
+
+func testUnknownUser(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	id := primitive.NewObjectID()
+
+	if _, err := store.GetUser(ctx, id); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetUser: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := store.GetPerson(ctx, id); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetPerson: err = %v, want ErrUserNotFound", err)
+	}
+	if err := store.UpdatePasswordHash(ctx, id, "$new"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("UpdatePasswordHash: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := store.SetUserActive(ctx, id, true); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("SetUserActive: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := store.SetUserRole(ctx, id, model.RoleAuthor); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("SetUserRole: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := store.UpdatePerson(ctx, &model.Person{UserID: id}); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("UpdatePerson: err = %v, want ErrUserNotFound", err)
+	}
+	if replaced, err := store.ReplacePasswordHash(ctx, id, "$old", "$new"); err != nil || replaced {
+		t.Errorf("ReplacePasswordHash = %v, %v, want false", replaced, err)
+	}
+}
+
+func testUpdates(t *testing.T, store repository.UserStore) {
+	ctx := context.Background()
+	user := create(t, store, "alice", "alice@example.com", true)
+
+	if changed, err := store.SetUserActive(ctx, user.ID, true); err != nil || changed {
+		t.Errorf("SetUserActive(unchanged) = %v, %v, want false", changed, err)
+	}
+	if changed, err := store.SetUserRole(ctx, user.ID, model.RoleAuthor); err != nil || !changed {
+		t.Errorf("SetUserRole = %v, %v, want true", changed, err)
+	}
+	if changed, err := store.SetUserRole(ctx, user.ID, model.RoleAuthor); err != nil || changed {
+		t.Errorf("SetUserRole(unchanged) = %v, %v, want false", changed, err)
+	}
+	if got, err := store.GetUser(ctx, user.ID); err != nil || got.Role != model.RoleAuthor {
+		t.Errorf("GetUser after SetUserRole = %v, %v", got, err)
+	}
+
+	person, err := store.GetPerson(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetPerson: %v", err)
+	}
+	person.FirstName = "Alicia"
+	person.ProfileImage = "https://example.com/a.png"
+	// Only profile fields are saved, the email is not.
+	person.Email = "changed@example.com"
+	if changed, err := store.UpdatePerson(ctx, person); err != nil || !changed {
+		t.Errorf("UpdatePerson = %v, %v, want true", changed, err)
+	}
+	if changed, err := store.UpdatePerson(ctx, person); err != nil || changed {
+		t.Errorf("UpdatePerson(unchanged) = %v, %v, want false", changed, err)
+	}
+	got, err := store.GetPerson(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetPerson: %v", err)
+	}
+	if got.FirstName != "Alicia" || got.ProfileImage != "https://example.com/a.png" || got.Email != "alice@example.com" {
+		t.Errorf("GetPerson after UpdatePerson = %+v", got)
+	}
+}
+
+// testOutbox checks that events are stored with their change, only when
+// something changed, and follow the claim, retry and publish cycle.
+func testOutbox(t *testing.T, store repository.UserStore) {
+	outbox, ok := store.(repository.OutboxStore)
+	if !ok {
+		t.Skip("store has no outbox")
+	}
+	ctx := context.Background()
+	event := func(eventType string) model.Event {
+		return model.Event{Type: eventType, AggregateID: "agg", Payload: []byte(`{"n":1}`)}
+	}
+
+	user, person := newUser("alice", "alice@example.com")
+	if err := store.CreateUser(ctx, user, person, event("Created")); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := store.SetUserActive(ctx, user.ID, false, event("Unchanged")); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	if _, err := store.SetUserRole(ctx, user.ID, model.RoleAuthor, event("RoleChanged")); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+
+	now := time.Now()
+	lease := time.Minute
+	first, err := outbox.ClaimEvent(ctx, now, lease)
+	if err != nil || first == nil {
+		t.Fatalf("ClaimEvent = %v, %v", first, err)
+	}
+	if first.Type != "Created" || first.Attempts != 1 || string(first.Payload) == "" {
+		t.Errorf("first event = %+v, want Created with one attempt", first)
+	}
+	second, err := outbox.ClaimEvent(ctx, now, lease)
+	if err != nil || second == nil || second.Type != "RoleChanged" {
+		t.Fatalf("second ClaimEvent = %+v, %v, want RoleChanged", second, err)
+	}
+	if claimed, err := outbox.ClaimEvent(ctx, now, lease); err != nil || claimed != nil {
+		t.Errorf("ClaimEvent with everything leased = %+v, %v, want nil", claimed, err)
+	}
+
+	if err := outbox.RetryEvent(ctx, first.ID, now, "unavailable"); err != nil {
+		t.Fatalf("RetryEvent: %v", err)
+	}
+	retried, err := outbox.ClaimEvent(ctx, now, lease)
+	if err != nil || retried == nil || retried.ID != first.ID || retried.Attempts != 2 {
+		t.Fatalf("ClaimEvent after retry = %+v, %v, want the first event again", retried, err)
+	}
+
+	if err := outbox.MarkPublished(ctx, first.ID, now); err != nil {
+		t.Fatalf("MarkPublished: %v", err)
+	}
+	if claimed, err := outbox.ClaimEvent(ctx, now.Add(2*lease), lease); err != nil || claimed == nil || claimed.ID != second.ID {
+		t.Errorf("ClaimEvent after lease expiry = %+v, %v, want only the unpublished event", claimed, err)
+	}
+}
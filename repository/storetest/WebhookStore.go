@@ -0,0 +1,222 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestWebhookStore runs the conformance suite. newStore is called once per
+// subtest and must return an empty store.
+func TestWebhookStore(t *testing.T, newStore func(t *testing.T) repository.WebhookStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store repository.WebhookStore)
+	}{
+		{"Webhooks", testWebhooks},
+		{"DeliveryQueue", testDeliveryQueue},
+		{"DuplicateDeliveriesAreSkipped", testDuplicateDeliveries},
+		{"DeliveryLogIsCapped", testDeliveryLogIsCapped},
+		{"DeleteRemovesDeliveries", testDeleteRemovesDeliveries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func createWebhook(t *testing.T, store repository.WebhookStore, events ...string) *model.Webhook {
+	t.Helper()
+	webhook := &model.Webhook{
+		URL:       "https://example.com/hook",
+		Events:    events,
+		Secret:    "secret",
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	if err := store.CreateWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return webhook
+}
+
+func newDelivery(webhookID, eventID primitive.ObjectID) model.WebhookDelivery {
+	return model.WebhookDelivery{WebhookID: webhookID, EventID: eventID, EventType: "UserRegistered", Payload: []byte(`{"id":1}`)}
+}
+
+func testWebhooks(t *testing.T, store repository.WebhookStore) {
+	ctx := context.Background()
+	first := createWebhook(t, store, "*")
+	second := createWebhook(t, store, "UserRegistered", "UserActivated")
+	if first.ID.IsZero() {
+		t.Fatal("CreateWebhook did not assign an ID")
+	}
+
+	got, err := store.GetWebhook(ctx, second.ID)
+	if err != nil {
+		t.Fatalf("GetWebhook: %v", err)
+	}
+	if got.URL != second.URL || got.Secret != "secret" || len(got.Events) != 2 || got.Events[1] != "UserActivated" {
+		t.Errorf("GetWebhook = %+v, want %+v", got, second)
+	}
+
+	webhooks, err := store.ListWebhooks(ctx)
+	if err != nil {
+		t.Fatalf("ListWebhooks: %v", err)
+	}
+	if len(webhooks) != 2 || webhooks[0].ID != first.ID || webhooks[1].ID != second.ID {
+		t.Errorf("ListWebhooks = %+v, want both in creation order", webhooks)
+	}
+
+	if err := store.DeleteWebhook(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	if _, err := store.GetWebhook(ctx, first.ID); !errors.Is(err, repository.ErrWebhookNotFound) {
+		t.Errorf("GetWebhook(deleted): err = %v, want ErrWebhookNotFound", err)
+	}
+	if err := store.DeleteWebhook(ctx, first.ID); !errors.Is(err, repository.ErrWebhookNotFound) {
+		t.Errorf("DeleteWebhook(deleted): err = %v, want ErrWebhookNotFound", err)
+	}
+}
+
+func testDeliveryQueue(t *testing.T, store repository.WebhookStore) {
+	ctx := context.Background()
+	webhook := createWebhook(t, store, "*")
+	deliveries := []model.WebhookDelivery{
+		newDelivery(webhook.ID, primitive.NewObjectID()),
+		newDelivery(webhook.ID, primitive.NewObjectID()),
+	}
+	if err := store.EnqueueDeliveries(ctx, deliveries); err != nil {
+		t.Fatalf("EnqueueDeliveries: %v", err)
+	}
+
+	now := time.Now()
+	lease := time.Minute
+	claimed, err := store.ClaimDelivery(ctx, now, lease)
+	if err != nil || claimed == nil {
+		t.Fatalf("ClaimDelivery = %v, %v", claimed, err)
+	}
+	if claimed.ID != deliveries[0].ID || claimed.Attempts != 1 || claimed.Status != model.DeliveryPending || string(claimed.Payload) == "" {
+		t.Errorf("ClaimDelivery = %+v, want the first delivery with one attempt", claimed)
+	}
+
+	failure := model.DeliveryAttempt{At: now.UTC().Truncate(time.Millisecond), StatusCode: 500, Error: "unexpected status 500"}
+	if err := store.RecordAttempt(ctx, claimed.ID, failure, model.DeliveryFailed, time.Time{}); err != nil {
+		t.Fatalf("RecordAttempt: %v", err)
+	}
+	second, err := store.ClaimDelivery(ctx, now, lease)
+	if err != nil || second == nil || second.ID != deliveries[1].ID {
+		t.Fatalf("second ClaimDelivery = %+v, %v, want the second delivery", second, err)
+	}
+	if none, err := store.ClaimDelivery(ctx, now, lease); err != nil || none != nil {
+		t.Errorf("ClaimDelivery with nothing due = %+v, %v, want nil", none, err)
+	}
+
+	replayed, err := store.ReplayDelivery(ctx, claimed.ID, now)
+	if err != nil {
+		t.Fatalf("ReplayDelivery: %v", err)
+	}
+	if replayed.Status != model.DeliveryPending || replayed.Attempts != 0 || len(replayed.Log) != 1 {
+		t.Errorf("ReplayDelivery = %+v, want pending without attempts and with the old log", replayed)
+	}
+	again, err := store.ClaimDelivery(ctx, now, lease)
+	if err != nil || again == nil || again.ID != claimed.ID || again.Attempts != 1 {
+		t.Fatalf("ClaimDelivery after replay = %+v, %v", again, err)
+	}
+
+	success := model.DeliveryAttempt{At: now.UTC().Truncate(time.Millisecond), StatusCode: 204}
+	if err := store.RecordAttempt(ctx, again.ID, success, model.DeliverySucceeded, time.Time{}); err != nil {
+		t.Fatalf("RecordAttempt: %v", err)
+	}
+	list, err := store.ListDeliveries(ctx, webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != deliveries[1].ID || list[1].ID != claimed.ID {
+		t.Fatalf("ListDeliveries = %+v, want newest first", list)
+	}
+	if log := list[1].Log; list[1].Status != model.DeliverySucceeded || len(log) != 2 || log[0].StatusCode != 500 || log[1].StatusCode != 204 {
+		t.Errorf("delivery after success = %+v", list[1])
+	}
+	if limited, err := store.ListDeliveries(ctx, webhook.ID, 1); err != nil || len(limited) != 1 {
+		t.Errorf("ListDeliveries(limit 1) = %d deliveries, %v", len(limited), err)
+	}
+
+	if _, err := store.ReplayDelivery(ctx, primitive.NewObjectID(), now); !errors.Is(err, repository.ErrDeliveryNotFound) {
+		t.Errorf("ReplayDelivery(unknown): err = %v, want ErrDeliveryNotFound", err)
+	}
+}
+
+func testDuplicateDeliveries(t *testing.T, store repository.WebhookStore) {
+	ctx := context.Background()
+	webhook := createWebhook(t, store, "*")
+	eventID := primitive.NewObjectID()
+
+	if err := store.EnqueueDeliveries(ctx, []model.WebhookDelivery{newDelivery(webhook.ID, eventID)}); err != nil {
+		t.Fatalf("EnqueueDeliveries: %v", err)
+	}
+	// The relay publishes an event again if it crashed before marking it published.
+	err := store.EnqueueDeliveries(ctx, []model.WebhookDelivery{
+		newDelivery(webhook.ID, eventID),
+		newDelivery(webhook.ID, primitive.NewObjectID()),
+	})
+	if err != nil {
+		t.Fatalf("EnqueueDeliveries(duplicate): %v", err)
+	}
+
+	list, err := store.ListDeliveries(ctx, webhook.ID, 10)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("ListDeliveries = %d deliveries, want 2", len(list))
+	}
+}
+
+func testDeliveryLogIsCapped(t *testing.T, store repository.WebhookStore) {
+	ctx := context.Background()
+	webhook := createWebhook(t, store, "*")
+	delivery := newDelivery(webhook.ID, primitive.NewObjectID())
+	if err := store.EnqueueDeliveries(ctx, []model.WebhookDelivery{delivery}); err != nil {
+		t.Fatalf("EnqueueDeliveries: %v", err)
+	}
+	list, err := store.ListDeliveries(ctx, webhook.ID, 1)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListDeliveries = %v, %v", list, err)
+	}
+
+	at := time.Now().UTC().Truncate(time.Millisecond)
+	for i := 1; i <= 25; i++ {
+		attempt := model.DeliveryAttempt{At: at, StatusCode: 500 + i}
+		if err := store.RecordAttempt(ctx, list[0].ID, attempt, model.DeliveryPending, at); err != nil {
+			t.Fatalf("RecordAttempt: %v", err)
+		}
+	}
+	list, err = store.ListDeliveries(ctx, webhook.ID, 1)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	log := list[0].Log
+	if len(log) != 20 || log[0].StatusCode != 506 || log[19].StatusCode != 525 {
+		t.Errorf("log has %d entries from %d to %d, want the last 20", len(log), log[0].StatusCode, log[len(log)-1].StatusCode)
+	}
+}
+
+func testDeleteRemovesDeliveries(t *testing.T, store repository.WebhookStore) {
+	ctx := context.Background()
+	webhook := createWebhook(t, store, "*")
+	if err := store.EnqueueDeliveries(ctx, []model.WebhookDelivery{newDelivery(webhook.ID, primitive.NewObjectID())}); err != nil {
+		t.Fatalf("EnqueueDeliveries: %v", err)
+	}
+	if err := store.DeleteWebhook(ctx, webhook.ID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	if claimed, err := store.ClaimDelivery(ctx, time.Now(), time.Minute); err != nil || claimed != nil {
+		t.Errorf("ClaimDelivery after DeleteWebhook = %+v, %v, want nil", claimed, err)
+	}
+}
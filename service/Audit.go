@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+type requestInfoKey struct{}
+
+// RequestInfo describes the HTTP request a service call is made for. Handlers
+// attach it to the context so audit entries can name the caller.
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+	RequestID string
+	// ActorID and ActorName are set for authenticated requests.
+	ActorID   string
+	ActorName string
+}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// WithActor records the authenticated caller in the request info of ctx.
+func WithActor(ctx context.Context, id, name string) context.Context {
+	info := requestInfo(ctx)
+	info.ActorID, info.ActorName = id, name
+	return WithRequestInfo(ctx, info)
+}
+
+func requestInfo(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// auditQueueSize bounds the entries waiting for the writer. Entries recorded
+// while it is full are dropped.
+const auditQueueSize = 1024
+
+// Auditor writes the security audit log. Entries are queued and appended one
+// at a time by Run, so requests don't wait for the write and the appends of
+// this replica never race each other for the next sequence number. Failing
+// to write an entry doesn't fail the audited operation, it is counted in
+// auth_audit_entries_dropped_total. A nil Auditor records nothing.
+type Auditor struct {
+	store  repository.AuditStore
+	logger *log.Logger
+	queue  chan auditWrite
+}
+
+type auditWrite struct {
+	ctx   context.Context
+	entry model.AuditEntry
+}
+
+func NewAuditor(store repository.AuditStore, logger *log.Logger) *Auditor {
+	return &Auditor{store: store, logger: logger, queue: make(chan auditWrite, auditQueueSize)}
+}
+
+// Record queues an entry for action with the caller taken from ctx. err is
+// the outcome of the action; its code, if any, is kept as the failure reason.
+// Fields already set in entry take precedence over the request info.
+func (a *Auditor) Record(ctx context.Context, action string, err error, entry model.AuditEntry) {
+	if a == nil {
+		return
+	}
+	info := requestInfo(ctx)
+	entry.Action = action
+	entry.Result = model.AuditSuccess
+	if err != nil {
+		entry.Result = model.AuditFailure
+		reason := "internal"
+		var appErr *apperror.Error
+		if errors.As(err, &appErr) {
+			reason = appErr.Code
+		}
+		entry.Details = withDetail(entry.Details, "reason", reason)
+	}
+	if entry.ActorID == "" && entry.ActorName == "" {
+		entry.ActorID, entry.ActorName = info.ActorID, info.ActorName
+	}
+	entry.IP, entry.UserAgent, entry.RequestID = info.IP, info.UserAgent, info.RequestID
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	// The entry is written even if the request was cancelled meanwhile.
+	select {
+	case a.queue <- auditWrite{ctx: context.WithoutCancel(ctx), entry: entry}:
+	default:
+		auditEntriesDroppedTotal.WithLabelValues("queue_full").Inc()
+		a.logger.Printf("Audit queue full, dropped %s audit entry", action)
+	}
+}
+
+// Run appends the queued entries until ctx is done, then writes what is
+// still queued and returns.
+func (a *Auditor) Run(ctx context.Context) {
+	for {
+		select {
+		case write := <-a.queue:
+			a.write(write)
+		case <-ctx.Done():
+			for {
+				select {
+				case write := <-a.queue:
+					a.write(write)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *Auditor) write(write auditWrite) {
+	ctx, cancel := context.WithTimeout(write.ctx, 5*time.Second)
+	defer cancel()
+	if err := a.store.AppendAudit(ctx, &write.entry); err != nil {
+		auditEntriesDroppedTotal.WithLabelValues("write_failed").Inc()
+		a.logger.Printf("Failed to write %s audit entry: %v", write.entry.Action, err)
+	}
+}
+
+func withDetail(details map[string]string, key, value string) map[string]string {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details[key] = value
+	return details
+}
+
+// AuditService serves the audit log to admins.
+type AuditService struct {
+	store repository.AuditStore
+}
+
+func NewAuditService(store repository.AuditStore) *AuditService {
+	return &AuditService{store: store}
+}
+
+var ErrInvalidAuditCursor = apperror.New(apperror.KindInvalid, "audit.invalid_cursor", "invalid audit log cursor")
+
+// Query returns one page of matching entries, newest first. cursor is the
+// NextCursor of the previous page or empty for the first one.
+func (s *AuditService) Query(ctx context.Context, filter repository.AuditFilter, cursor string, limit int) (*model.AuditPage, error) {
+	if cursor != "" {
+		seq, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || seq <= 0 {
+			return nil, ErrInvalidAuditCursor
+		}
+		filter.BeforeSeq = seq
+	}
+	entries, err := s.store.QueryAudit(ctx, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.AuditPage{Results: entries}
+	if len(entries) == limit && entries[len(entries)-1].Seq > 1 {
+		page.NextCursor = strconv.FormatInt(entries[len(entries)-1].Seq, 10)
+	}
+	return page, nil
+}
+
+func (s *AuditService) Export(ctx context.Context, filter repository.AuditFilter, fn func(entry model.AuditEntry) error) error {
+	return s.store.ExportAudit(ctx, filter, fn)
+}
+
+// AuditVerification is the result of checking the hash chain.
+type AuditVerification struct {
+	Valid   bool  `json:"valid"`
+	Entries int64 `json:"entries"`
+	// BrokenAt is the first sequence number whose hash or link doesn't match.
+	BrokenAt int64 `json:"broken_at,omitempty"`
+}
+
+// Verify walks the whole log and recomputes the hash chain.
+func (s *AuditService) Verify(ctx context.Context) (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true}
+	prevHash, prevSeq := "", int64(0)
+	errBroken := errors.New("chain broken")
+	err := s.store.ExportAudit(ctx, repository.AuditFilter{}, func(entry model.AuditEntry) error {
+		if entry.Seq != prevSeq+1 || entry.PrevHash != prevHash || entry.ComputeHash() != entry.Hash {
+			result.Valid, result.BrokenAt = false, prevSeq+1
+			return errBroken
+		}
+		result.Entries++
+		prevHash, prevSeq = entry.Hash, entry.Seq
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBroken) {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAuditorSerializesConcurrentRecords(t *testing.T) {
+	store := repository.NewMemoryAuditStore()
+	auditor := NewAuditor(store, log.New(io.Discard, "", 0))
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		auditor.Run(ctx)
+		close(done)
+	}()
+
+	const records = 200
+	var wg sync.WaitGroup
+	for i := range records {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			auditor.Record(context.Background(), model.AuditLogin, nil, model.AuditEntry{TargetID: fmt.Sprint(i)})
+		}()
+	}
+	wg.Wait()
+	// Run writes what is still queued before returning.
+	stop()
+	<-done
+
+	verification, err := NewAuditService(store).Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !verification.Valid || verification.Entries != records {
+		t.Errorf("Verify = %+v, want a valid chain of %d entries", verification, records)
+	}
+}
+
+// failingAuditStore rejects every append.
+type failingAuditStore struct {
+	repository.AuditStore
+}
+
+func (failingAuditStore) AppendAudit(ctx context.Context, entry *model.AuditEntry) error {
+	return errors.New("store down")
+}
+
+func TestAuditorCountsDroppedEntries(t *testing.T) {
+	queueFull := testutil.ToFloat64(auditEntriesDroppedTotal.WithLabelValues("queue_full"))
+	writeFailed := testutil.ToFloat64(auditEntriesDroppedTotal.WithLabelValues("write_failed"))
+
+	// Nothing drains the queue until Run starts.
+	auditor := NewAuditor(failingAuditStore{}, log.New(io.Discard, "", 0))
+	for range auditQueueSize + 3 {
+		auditor.Record(context.Background(), model.AuditLogin, nil, model.AuditEntry{})
+	}
+	if got := testutil.ToFloat64(auditEntriesDroppedTotal.WithLabelValues("queue_full")) - queueFull; got != 3 {
+		t.Errorf("queue_full drops grew by %v, want 3", got)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	stop()
+	auditor.Run(ctx)
+	if got := testutil.ToFloat64(auditEntriesDroppedTotal.WithLabelValues("write_failed")) - writeFailed; got != auditQueueSize {
+		t.Errorf("write_failed drops grew by %v, want %d", got, auditQueueSize)
+	}
+}
@@ -2,31 +2,102 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
+	"net/url"
+	"sync"
 	"time"
 
+	"github.com/MicroSOA-09/auth-service/apperror"
 	"github.com/MicroSOA-09/auth-service/model"
 	"github.com/MicroSOA-09/auth-service/repository"
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AuthService struct {
-	Repo        *repository.UserRepo
-	jwtSecret   string
-	EmailClient *EmailClient
+	Repo           repository.UserStore
+	jwtSecret      string
+	EmailClient    *EmailClient
+	LoginGuard     *LoginGuard
+	PasswordPolicy *PasswordPolicy
+	Hasher         PasswordHasher
+	Sessions       *SessionService
+	Auditor        *Auditor
+	logger         *log.Logger
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-func NewAuthService(repo *repository.UserRepo, jwtSecret string, emailClient *EmailClient) *AuthService {
+var (
+	ErrInvalidResetToken  = apperror.New(apperror.KindInvalid, "auth.reset_token_invalid", "invalid or expired password reset token")
+	ErrInvalidToken       = apperror.New(apperror.KindUnauthenticated, "auth.token_invalid", "invalid or expired token")
+	ErrInvalidVerifyToken = apperror.New(apperror.KindInvalid, "auth.verify_token_invalid", "invalid or expired email verification token")
+	ErrInvalidSecureToken = apperror.New(apperror.KindInvalid, "auth.secure_token_invalid", "invalid or expired account recovery link")
+)
+
+func NewAuthService(repo repository.UserStore, jwtSecret string, emailClient *EmailClient, loginGuard *LoginGuard, passwordPolicy *PasswordPolicy, hasher PasswordHasher, sessions *SessionService, auditor *Auditor, logger *log.Logger) *AuthService {
 	return &AuthService{
-		Repo:        repo,
-		jwtSecret:   jwtSecret,
-		EmailClient: emailClient,
+		Repo:           repo,
+		jwtSecret:      jwtSecret,
+		EmailClient:    emailClient,
+		LoginGuard:     loginGuard,
+		PasswordPolicy: passwordPolicy,
+		Hasher:         hasher,
+		Sessions:       sessions,
+		Auditor:        auditor,
+		logger:         logger,
 	}
 }
 
 func (s *AuthService) Register(ctx context.Context, user *model.User, person *model.Person, password string) (string, error) {
-	err := s.Repo.CreateUser(ctx, user, person, password)
+	ctx, span := tracer.Start(ctx, "AuthService.Register")
+	token, err := s.register(ctx, user, person, password)
+	entry := model.AuditEntry{ActorName: user.Username, Details: map[string]string{"role": string(user.Role)}}
+	if err == nil {
+		entry.ActorID = user.ID.Hex()
+	}
+	s.Auditor.Record(ctx, model.AuditRegister, err, entry)
+	if err == nil {
+		registrationsTotal.Inc()
+	}
+	endSpan(span, err)
+	return token, err
+}
+
+func (s *AuthService) register(ctx context.Context, user *model.User, person *model.Person, password string) (string, error) {
+	if err := s.PasswordPolicy.Validate("password", password, user.Username, person.Email); err != nil {
+		return "", err
+	}
+
+	passwordHash, err := s.hashPassword(ctx, password)
+	if err != nil {
+		return "", err
+	}
+	user.PasswordHash = passwordHash
+
+	// The ID is assigned up front so the event can refer to the new user.
+	user.ID = primitive.NewObjectID()
+	event, err := newEvent(EventUserRegistered, user.ID, userRegisteredPayload{
+		UserID:       user.ID.Hex(),
+		Username:     user.Username,
+		Role:         user.Role,
+		FirstName:    person.FirstName,
+		LastName:     person.LastName,
+		ProfileImage: person.ProfileImage,
+		Locale:       person.Locale,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = s.Repo.CreateUser(ctx, user, person, event)
 	if err != nil {
 		return "", err
 	}
@@ -45,35 +116,341 @@ func (s *AuthService) Register(ctx context.Context, user *model.User, person *mo
 	return token, nil
 }
 
-func (s *AuthService) Login(ctx context.Context, username, password string) (string, string, error) {
+// VerifyEmail activates the account the verification token was issued for.
+// Verifying an already active account again succeeds without a new event.
+func (s *AuthService) VerifyEmail(ctx context.Context, tokenString string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.VerifyEmail")
+	defer func() { endSpan(span, err) }()
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(s.jwtSecret), nil
+	})
+	if err != nil || !token.Valid || claims["action"] != "verify_email" {
+		s.Auditor.Record(ctx, model.AuditVerifyEmail, ErrInvalidVerifyToken, model.AuditEntry{})
+		return ErrInvalidVerifyToken
+	}
+
+	userID, _ := claims["sub"].(string)
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrInvalidVerifyToken
+	}
+	event, err := newEvent(EventUserActivated, oid, userPayload{UserID: userID})
+	if err != nil {
+		return err
+	}
+	activated, err := s.Repo.SetUserActive(ctx, oid, true, event)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrInvalidVerifyToken
+	}
+	if err != nil {
+		return err
+	}
+	if activated {
+		s.logger.Printf("Account %s activated", userID)
+		s.Auditor.Record(ctx, model.AuditVerifyEmail, nil, model.AuditEntry{ActorID: userID})
+	}
+	return nil
+}
+
+// Tokens are handed out on login and refresh. The access token is
+// short-lived proof of identity, the refresh token gets the next one.
+type Tokens struct {
+	UserID           string
+	SessionID        string
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	// CSRFToken must accompany state-changing requests that authenticate
+	// with the access token cookie.
+	CSRFToken string
+}
+
+// AccessClaims are the claims of a valid access token.
+type AccessClaims struct {
+	UserID    string
+	Username  string
+	Role      string
+	SessionID string
+}
+
+func (s *AuthService) Login(ctx context.Context, username, password, ip string) (*Tokens, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	tokens, err := s.login(ctx, username, password, ip)
+	entry := model.AuditEntry{ActorName: username}
+	if err == nil {
+		entry.ActorID = tokens.UserID
+		entry.Details = map[string]string{"session_id": tokens.SessionID}
+		tokensIssuedTotal.WithLabelValues("login").Inc()
+	}
+	s.Auditor.Record(ctx, model.AuditLogin, err, entry)
+	loginsTotal.WithLabelValues(loginResult(err)).Inc()
+	endSpan(span, err)
+	return tokens, err
+}
+
+func (s *AuthService) login(ctx context.Context, username, password, ip string) (*Tokens, error) {
+	if err := s.LoginGuard.Check(ctx, username, ip); err != nil {
+		return nil, err
+	}
+	attempt, err := s.LoginGuard.Reserve(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
 	user, err := s.Repo.GetUserByUsername(ctx, username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		// Unknown usernames count too, fail like a wrong password and take as
+		// long to check, so the response doesn't reveal which accounts exist.
+		s.verifyPassword(ctx, password, s.dummyPasswordHash(ctx))
+		s.loginFailed(ctx, nil, attempt, username, ip)
+		return nil, repository.ErrInvalidCredentials
+	}
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
+	ok, err := s.verifyPassword(ctx, password, user.PasswordHash)
+	if err != nil {
+		s.logger.Printf("Cannot verify password hash of %s: %v", username, err)
+	}
+	if !ok {
+		s.loginFailed(ctx, user, attempt, username, ip)
+		return nil, repository.ErrInvalidCredentials
+	}
+	if err := s.LoginGuard.Success(ctx, username); err != nil {
+		s.logger.Printf("Failed to reset login attempts for %s: %v", username, err)
+	}
+	// Only checked with the right password, so the state of an account is
+	// only told to its owner.
 	if !user.IsActive {
-		return "", "", repository.ErrUserNotActive
+		return nil, repository.ErrUserNotActive
+	}
+	if s.Hasher.NeedsRehash(user.PasswordHash) {
+		s.rehash(ctx, user, password)
+	}
+
+	session, refreshToken, newDevice, err := s.Sessions.Start(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if newDevice {
+		s.newDeviceAlert(ctx, user, session)
+	}
+	return s.issueTokens(user, session, refreshToken)
+}
+
+// newDeviceAlert tells the user about a login from a new device. The mail
+// links to SecureAccount for the case it wasn't them.
+func (s *AuthService) newDeviceAlert(ctx context.Context, user *model.User, session *model.Session) {
+	s.logger.Printf("Login of %s from new device %q at %s", user.Username, session.Device, session.IP)
+	s.Auditor.Record(ctx, model.AuditNewDevice, nil, model.AuditEntry{
+		ActorID:   user.ID.Hex(),
+		ActorName: user.Username,
+		Details:   map[string]string{"session_id": session.ID.Hex(), "device": session.Device, "location": session.Location},
+	})
+
+	// The link is bound to the current password, it stops working once the
+	// account has been secured or the password changed otherwise.
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":    user.ID.Hex(),
+		"action": "secure_account",
+		"pwd":    passwordFingerprint(user.PasswordHash),
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(7 * 24 * time.Hour).Unix(),
+	}).SignedString([]byte(s.jwtSecret))
+	if err != nil {
+		s.logger.Printf("Cannot sign account recovery link for %s: %v", user.Username, err)
+		return
+	}
+	person, err := s.Repo.GetPerson(ctx, user.ID)
+	if err != nil {
+		s.logger.Printf("Cannot notify %s about new device: %v", user.Username, err)
+		return
+	}
+	alert := SecurityAlert{
+		Kind:     AlertNewDevice,
+		Username: user.Username,
+		Time:     session.CreatedAt,
+		IP:       session.IP,
+		Device:   session.Device,
+		Location: session.Location,
+		Link:     s.EmailClient.link("/api/auth/secure-account", url.Values{"token": {token}}),
+	}
+	go func() {
+		emailCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if err := s.EmailClient.SendSecurityAlertEmail(emailCtx, person.Email, person.Locale, alert); err != nil {
+			s.logger.Printf("Async new device email to %s failed: %v", person.Email, err)
+		}
+	}()
+}
+
+// SecureAccount handles the "this wasn't me" link of a new device alert: it
+// ends all sessions, forgets the known devices and replaces the password, so
+// the owner has to set a new one through the reset mail sent along.
+func (s *AuthService) SecureAccount(ctx context.Context, tokenString string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.SecureAccount")
+	userID, err := s.secureAccount(ctx, tokenString)
+	s.Auditor.Record(ctx, model.AuditAccountSecure, err, model.AuditEntry{ActorID: userID})
+	endSpan(span, err)
+	return err
+}
+
+func (s *AuthService) secureAccount(ctx context.Context, tokenString string) (string, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(s.jwtSecret), nil
+	})
+	if err != nil || !token.Valid || claims["action"] != "secure_account" {
+		return "", ErrInvalidSecureToken
+	}
+
+	userID, _ := claims["sub"].(string)
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", ErrInvalidSecureToken
+	}
+	user, err := s.Repo.GetUser(ctx, oid)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return "", ErrInvalidSecureToken
+	}
+	if err != nil {
+		return "", err
+	}
+	if claims["pwd"] != passwordFingerprint(user.PasswordHash) {
+		return "", ErrInvalidSecureToken
+	}
+
+	// Nobody knows the random password, so the old one stops working and
+	// only the reset link below gets the owner back in.
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return userID, err
+	}
+	passwordHash, err := s.hashPassword(ctx, hex.EncodeToString(random))
+	if err != nil {
+		return userID, err
+	}
+	if err := s.Repo.UpdatePasswordHash(ctx, user.ID, passwordHash); err != nil {
+		return userID, err
+	}
+	user.PasswordHash = passwordHash
+	if _, err := s.Sessions.RevokeOthers(ctx, userID, ""); err != nil {
+		return userID, err
+	}
+	if err := s.Sessions.ForgetDevices(ctx, user.ID); err != nil {
+		s.logger.Printf("Failed to forget devices of %s: %v", user.Username, err)
 	}
+	s.logger.Printf("Account %s secured by its owner, sessions ended and password reset required", user.Username)
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", "", repository.ErrInvalidCredentials
+	person, err := s.Repo.GetPerson(ctx, user.ID)
+	if err != nil {
+		return userID, err
+	}
+	return userID, s.sendPasswordReset(ctx, user, person)
+}
+
+// Refresh trades a refresh token for new tokens of its session. The access
+// token picks up role changes made since the last one.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (_ *Tokens, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Refresh")
+	defer func() { endSpan(span, err) }()
+
+	session, newRefreshToken, err := s.Sessions.Refresh(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.Repo.GetUser(ctx, session.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		// The account was deactivated, its sessions are of no use anymore.
+		if _, err := s.Sessions.RevokeOthers(ctx, session.UserID.Hex(), ""); err != nil {
+			s.logger.Printf("Failed to end sessions of inactive user %s: %v", session.UserID.Hex(), err)
+		}
+		return nil, repository.ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.issueTokens(user, session, newRefreshToken)
+	if err == nil {
+		tokensIssuedTotal.WithLabelValues("refresh").Inc()
 	}
+	return tokens, err
+}
 
+func (s *AuthService) issueTokens(user *model.User, session *model.Session, refreshToken string) (*Tokens, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.Sessions.policy.AccessTokenLifetime)
 	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub":      user.ID.Hex(),
 		"username": user.Username,
 		"role":     user.Role,
-		"iat":      time.Now().Unix(),
-		"exp":      time.Now().Add(24 * time.Hour).Unix(),
+		"sid":      session.ID.Hex(),
+		"iat":      now.Unix(),
+		"exp":      expiresAt.Unix(),
 	}).SignedString([]byte(s.jwtSecret))
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return token, user.ID.Hex(), nil
+	return &Tokens{
+		UserID:           user.ID.Hex(),
+		SessionID:        session.ID.Hex(),
+		AccessToken:      token,
+		AccessExpiresAt:  expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+		CSRFToken:        s.csrfToken(session.ID.Hex()),
+	}, nil
+}
+
+// csrfToken is derived from the session, so it stays valid across refreshes
+// and can't be guessed or planted by another site.
+func (s *AuthService) csrfToken(sessionID string) string {
+	mac := hmac.New(sha256.New, []byte(s.jwtSecret))
+	mac.Write([]byte("csrf:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
 
-func (s *AuthService) ValidateJWT(tokenString string) (string, string, string, error) {
+// ValidCSRFToken reports whether token is the CSRF token of the session.
+func (s *AuthService) ValidCSRFToken(sessionID, token string) bool {
+	if sessionID == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(s.csrfToken(sessionID)))
+}
+
+// ValidateJWT checks an access token and that its session hasn't been
+// revoked.
+func (s *AuthService) ValidateJWT(ctx context.Context, tokenString string) (*AccessClaims, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ValidateJWT")
+	claims, err := s.validateJWT(ctx, tokenString)
+	tokenValidationsTotal.WithLabelValues(tokenValidationResult(err)).Inc()
+	endSpan(span, err)
+	return claims, err
+}
+
+func (s *AuthService) validateJWT(ctx context.Context, tokenString string) (*AccessClaims, error) {
+	claims, err := s.parseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Sessions.Check(ctx, claims.SessionID); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *AuthService) parseAccessToken(tokenString string) (*AccessClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
@@ -81,28 +458,298 @@ func (s *AuthService) ValidateJWT(tokenString string) (string, string, string, e
 		return []byte(s.jwtSecret), nil
 	})
 	if err != nil {
-		return "", "", "", err
+		return nil, ErrInvalidToken.Wrap(err)
 	}
 
 	claims, ok := token.Claims.(*jwt.MapClaims)
 	if !ok || !token.Valid {
-		return "", "", "", errors.New("invalid token claims")
+		return nil, ErrInvalidToken.Wrap(errors.New("invalid token claims"))
 	}
 
 	userID, ok := (*claims)["sub"].(string)
 	if !ok {
-		return "", "", "", errors.New("missing or invalid sub claim")
+		return nil, ErrInvalidToken.Wrap(errors.New("missing or invalid sub claim"))
 	}
 
 	username, ok := (*claims)["username"].(string)
 	if !ok {
-		return "", "", "", errors.New("missing or invalid username claim")
+		return nil, ErrInvalidToken.Wrap(errors.New("missing or invalid username claim"))
 	}
 
 	role, ok := (*claims)["role"].(string)
 	if !ok {
-		return "", "", "", errors.New("missing or invalid role claim")
+		return nil, ErrInvalidToken.Wrap(errors.New("missing or invalid role claim"))
+	}
+
+	// Without a session the token couldn't be revoked.
+	sessionID, ok := (*claims)["sid"].(string)
+	if !ok || sessionID == "" {
+		return nil, ErrInvalidToken.Wrap(errors.New("missing or invalid sid claim"))
+	}
+
+	return &AccessClaims{UserID: userID, Username: username, Role: role, SessionID: sessionID}, nil
+}
+
+// dummyPasswordHash is the hash of a random password, made by the configured
+// hasher once on first use. Logins of unknown users are verified against it.
+func (s *AuthService) dummyPasswordHash(ctx context.Context) string {
+	s.dummyHashOnce.Do(func() {
+		hash, err := s.hashPassword(ctx, rand.Text())
+		if err != nil {
+			s.logger.Printf("Cannot hash the dummy password: %v", err)
+		}
+		s.dummyHash = hash
+	})
+	return s.dummyHash
+}
+
+// rehash upgrades a hash made with outdated parameters. Failures are only
+// logged, the login itself already succeeded.
+func (s *AuthService) rehash(ctx context.Context, user *model.User, password string) {
+	passwordHash, err := s.hashPassword(ctx, password)
+	if err != nil {
+		s.logger.Printf("Failed to rehash password of %s: %v", user.Username, err)
+		return
+	}
+	replaced, err := s.Repo.ReplacePasswordHash(ctx, user.ID, user.PasswordHash, passwordHash)
+	if err != nil {
+		s.logger.Printf("Failed to store rehashed password of %s: %v", user.Username, err)
+		return
+	}
+	if replaced {
+		s.logger.Printf("Upgraded password hash of %s", user.Username)
+	}
+}
+
+func (s *AuthService) loginFailed(ctx context.Context, user *model.User, attempt *model.LoginAttempt, username, ip string) {
+	lockedUntil, lockedNow, err := s.LoginGuard.Failure(ctx, attempt, ip)
+	if err != nil {
+		s.logger.Printf("Failed to record login failure for %s: %v", username, err)
+		return
+	}
+	if !lockedNow || user == nil {
+		return
+	}
+
+	s.logger.Printf("Account %s locked until %v", username, lockedUntil)
+	s.Auditor.Record(ctx, model.AuditAccountLocked, nil, model.AuditEntry{
+		ActorID:   user.ID.Hex(),
+		ActorName: user.Username,
+		Details:   map[string]string{"locked_until": lockedUntil.UTC().Format(time.RFC3339)},
+	})
+	person, err := s.Repo.GetPerson(ctx, user.ID)
+	if err != nil {
+		s.logger.Printf("Cannot notify %s about lockout: %v", username, err)
+		return
+	}
+	alert := SecurityAlert{
+		Kind:     AlertAccountLocked,
+		Username: user.Username,
+		Until:    lockedUntil,
+		IP:       ip,
+	}
+	go func() {
+		emailCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if err := s.EmailClient.SendSecurityAlertEmail(emailCtx, person.Email, person.Locale, alert); err != nil {
+			s.logger.Printf("Async lockout email to %s failed: %v", person.Email, err)
+		}
+	}()
+}
+
+func (s *AuthService) UnlockAccount(ctx context.Context, userID string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.UnlockAccount")
+	err := s.unlockAccount(ctx, userID)
+	s.Auditor.Record(ctx, model.AuditAccountUnlock, err, model.AuditEntry{TargetID: userID})
+	endSpan(span, err)
+	return err
+}
+
+func (s *AuthService) unlockAccount(ctx context.Context, userID string) error {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+	// Deactivated accounts can be locked too, and stay so after reactivation.
+	user, err := s.Repo.GetUserIncludingInactive(ctx, oid)
+	if err != nil {
+		return err
+	}
+	return s.LoginGuard.Unlock(ctx, user.Username)
+}
+
+func (s *AuthService) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ChangePassword")
+	err := s.changePassword(ctx, userID, currentPassword, newPassword)
+	s.Auditor.Record(ctx, model.AuditPasswordChange, err, model.AuditEntry{TargetID: userID})
+	endSpan(span, err)
+	return err
+}
+
+func (s *AuthService) changePassword(ctx context.Context, userID, currentPassword, newPassword string) error {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return repository.ErrUserNotFound
+	}
+	user, err := s.Repo.GetUser(ctx, oid)
+	if err != nil {
+		return err
+	}
+	// Wrong current passwords count like failed logins, or a stolen session
+	// could guess the password without being locked out.
+	ip := requestInfo(ctx).IP
+	if err := s.LoginGuard.Check(ctx, user.Username, ip); err != nil {
+		return err
+	}
+	attempt, err := s.LoginGuard.Reserve(ctx, user.Username)
+	if err != nil {
+		return err
+	}
+	if ok, _ := s.verifyPassword(ctx, currentPassword, user.PasswordHash); !ok {
+		s.loginFailed(ctx, user, attempt, user.Username, ip)
+		return repository.ErrInvalidCredentials
+	}
+	if err := s.LoginGuard.Success(ctx, user.Username); err != nil {
+		s.logger.Printf("Failed to reset login attempts for %s: %v", user.Username, err)
 	}
+	return s.setPassword(ctx, user, "new_password", newPassword)
+}
+
+// RequestPasswordReset mails a reset link if email belongs to an active user.
+// Unknown addresses are not reported, so the endpoint can't be used to probe accounts.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RequestPasswordReset")
+	defer func() { endSpan(span, err) }()
+
+	unknown := model.AuditEntry{Details: map[string]string{"account": "unknown"}}
+	person, err := s.Repo.GetPersonByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.Auditor.Record(ctx, model.AuditPasswordResetRequest, nil, unknown)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	user, err := s.Repo.GetUser(ctx, person.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.Auditor.Record(ctx, model.AuditPasswordResetRequest, nil, unknown)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.sendPasswordReset(ctx, user, person); err != nil {
+		return err
+	}
+	s.Auditor.Record(ctx, model.AuditPasswordResetRequest, nil, model.AuditEntry{TargetID: user.ID.Hex()})
+	return nil
+}
+
+// sendPasswordReset mails user a password reset link in the background.
+func (s *AuthService) sendPasswordReset(ctx context.Context, user *model.User, person *model.Person) error {
+	// The token is bound to the current password hash, so it stops working
+	// as soon as the password has been changed once.
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":    user.ID.Hex(),
+		"action": "reset_password",
+		"pwd":    passwordFingerprint(user.PasswordHash),
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(s.jwtSecret))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		emailCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if err := s.EmailClient.SendPasswordResetEmail(emailCtx, person.Email, person.Locale, user.Username, token); err != nil {
+			s.logger.Printf("Async password reset email to %s failed: %v", person.Email, err)
+		}
+	}()
+	return nil
+}
+
+func (s *AuthService) ResetPassword(ctx context.Context, tokenString, newPassword string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ResetPassword")
+	userID, err := s.resetPassword(ctx, tokenString, newPassword)
+	s.Auditor.Record(ctx, model.AuditPasswordReset, err, model.AuditEntry{TargetID: userID})
+	endSpan(span, err)
+	return err
+}
+
+// resetPassword returns the ID of the user the token was issued for, if valid.
+func (s *AuthService) resetPassword(ctx context.Context, tokenString, newPassword string) (string, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(s.jwtSecret), nil
+	})
+	if err != nil || !token.Valid || claims["action"] != "reset_password" {
+		return "", ErrInvalidResetToken
+	}
+
+	userID, _ := claims["sub"].(string)
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", ErrInvalidResetToken
+	}
+	user, err := s.Repo.GetUser(ctx, oid)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return "", ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", err
+	}
+	if claims["pwd"] != passwordFingerprint(user.PasswordHash) {
+		return "", ErrInvalidResetToken
+	}
+
+	if err := s.setPassword(ctx, user, "new_password", newPassword); err != nil {
+		return userID, err
+	}
+	// A successful reset also lifts a lockout caused by the forgotten password.
+	if err := s.LoginGuard.Unlock(ctx, user.Username); err != nil {
+		s.logger.Printf("Failed to reset login attempts for %s: %v", user.Username, err)
+	}
+	// Whoever knew the old password is logged out everywhere.
+	if _, err := s.Sessions.RevokeOthers(ctx, userID, ""); err != nil {
+		s.logger.Printf("Failed to end sessions of %s after password reset: %v", user.Username, err)
+	}
+	return userID, nil
+}
+
+func (s *AuthService) setPassword(ctx context.Context, user *model.User, field, password string) error {
+	person, err := s.Repo.GetPerson(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.PasswordPolicy.Validate(field, password, user.Username, person.Email); err != nil {
+		return err
+	}
+	passwordHash, err := s.hashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.UpdatePasswordHash(ctx, user.ID, passwordHash); err != nil {
+		return err
+	}
+
+	alert := SecurityAlert{Kind: AlertPasswordChanged, Username: user.Username}
+	go func() {
+		emailCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if err := s.EmailClient.SendSecurityAlertEmail(emailCtx, person.Email, person.Locale, alert); err != nil {
+			s.logger.Printf("Async password change email to %s failed: %v", person.Email, err)
+		}
+	}()
+	return nil
+}
 
-	return userID, username, role, nil
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
 }
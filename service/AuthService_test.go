@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testPassword = "Correct-Horse-Battery-9"
+
+type testAuth struct {
+	*AuthService
+	users    *repository.MemoryUserStore
+	attempts *repository.MemoryLoginAttemptStore
+}
+
+// newTestAuthService wires an AuthService to memory stores. Emails are
+// rendered and dropped.
+func newTestAuthService(t *testing.T) *testAuth {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	hasherConfig := DefaultHasherConfig()
+	hasherConfig.Algorithm = AlgorithmBcrypt
+	hasherConfig.BcryptCost = 4
+	hasher, err := NewPasswordHasher(hasherConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := NewEmailTemplates("", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails := NewEmailClient(NewLogMailer(io.Discard), templates, "no-reply@example.com", "http://localhost", logger)
+	users := repository.NewMemoryUserStore()
+	attempts := repository.NewMemoryLoginAttemptStore()
+	auditor := NewAuditor(repository.NewMemoryAuditStore(), logger)
+	go auditor.Run(t.Context())
+	sessions := NewSessionService(repository.NewMemorySessionStore(), repository.NewMemoryKnownDeviceStore(), nil, DefaultSessionPolicy(), auditor, logger)
+	service := NewAuthService(users, "secret", emails, NewLoginGuard(attempts, DefaultLockoutPolicy()), DefaultPasswordPolicy(nil), hasher, sessions, auditor, logger)
+	return &testAuth{AuthService: service, users: users, attempts: attempts}
+}
+
+func (a *testAuth) createUser(t *testing.T, username string, active bool) *model.User {
+	t.Helper()
+	ctx := context.Background()
+	hash, err := a.Hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Username: username, PasswordHash: hash, Role: model.RoleTourist}
+	person := &model.Person{FirstName: "Test", LastName: "User", Email: username + "@example.com"}
+	if err := a.users.CreateUser(ctx, user, person); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if active {
+		if _, err := a.users.SetUserActive(ctx, user.ID, true); err != nil {
+			t.Fatalf("SetUserActive: %v", err)
+		}
+	}
+	return user
+}
+
+func TestLoginInactiveAccount(t *testing.T) {
+	auth := newTestAuthService(t)
+	auth.createUser(t, "pending", false)
+	ctx := context.Background()
+
+	notActive := testutil.ToFloat64(loginsTotal.WithLabelValues("not_active"))
+	invalid := testutil.ToFloat64(loginsTotal.WithLabelValues("invalid_credentials"))
+
+	if _, err := auth.Login(ctx, "pending", testPassword, "192.0.2.1"); !errors.Is(err, repository.ErrUserNotActive) {
+		t.Fatalf("Login(right password) err = %v, want ErrUserNotActive", err)
+	}
+	if got := testutil.ToFloat64(loginsTotal.WithLabelValues("not_active")) - notActive; got != 1 {
+		t.Errorf("not_active logins grew by %v, want 1", got)
+	}
+
+	// A wrong password must not reveal that the account exists but is inactive.
+	if _, err := auth.Login(ctx, "pending", "wrong", "192.0.2.2"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Fatalf("Login(wrong password) err = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := auth.Login(ctx, "nobody", testPassword, "192.0.2.3"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Fatalf("Login(unknown user) err = %v, want ErrInvalidCredentials", err)
+	}
+	if got := testutil.ToFloat64(loginsTotal.WithLabelValues("invalid_credentials")) - invalid; got != 2 {
+		t.Errorf("invalid_credentials logins grew by %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(loginsTotal.WithLabelValues("not_active")) - notActive; got != 1 {
+		t.Errorf("not_active logins grew by %v, want 1", got)
+	}
+}
+
+func TestValidateJWTRequiresLiveSession(t *testing.T) {
+	auth := newTestAuthService(t)
+	user := auth.createUser(t, "alice", true)
+	ctx := context.Background()
+
+	tokens, err := auth.Login(ctx, "alice", testPassword, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	claims, err := auth.ValidateJWT(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	if claims.SessionID != tokens.SessionID {
+		t.Errorf("SessionID = %q, want %q", claims.SessionID, tokens.SessionID)
+	}
+
+	// A token without a session couldn't be revoked, so it isn't accepted.
+	for _, sid := range []any{nil, "", 42} {
+		mapClaims := jwt.MapClaims{
+			"sub":      user.ID.Hex(),
+			"username": user.Username,
+			"role":     user.Role,
+			"exp":      time.Now().Add(time.Hour).Unix(),
+		}
+		if sid != nil {
+			mapClaims["sid"] = sid
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, mapClaims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := auth.ValidateJWT(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("ValidateJWT(sid %v) err = %v, want ErrInvalidToken", sid, err)
+		}
+	}
+
+	if err := auth.Sessions.Revoke(ctx, user.ID.Hex(), tokens.SessionID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := auth.ValidateJWT(ctx, tokens.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("ValidateJWT after Revoke err = %v, want ErrSessionRevoked", err)
+	}
+}
+
+// touchCountingStore counts the activity writes to the session store.
+type touchCountingStore struct {
+	repository.SessionStore
+	touches int
+}
+
+func (s *touchCountingStore) TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time, ip string) error {
+	s.touches++
+	return s.SessionStore.TouchSession(ctx, id, now, ip)
+}
+
+func TestValidateJWTOnlyReadsTheSession(t *testing.T) {
+	auth := newTestAuthService(t)
+	store := &touchCountingStore{SessionStore: repository.NewMemorySessionStore()}
+	auth.Sessions = NewSessionService(store, repository.NewMemoryKnownDeviceStore(), nil, DefaultSessionPolicy(), nil, log.New(io.Discard, "", 0))
+	auth.createUser(t, "alice", true)
+
+	tokens, err := auth.Login(WithRequestInfo(context.Background(), RequestInfo{IP: "192.0.2.1"}), "alice", testPassword, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	// Backends validate with their own address.
+	backend := WithRequestInfo(context.Background(), RequestInfo{IP: "10.0.0.5"})
+	for range 3 {
+		if _, err := auth.ValidateJWT(backend, tokens.AccessToken); err != nil {
+			t.Fatalf("ValidateJWT: %v", err)
+		}
+	}
+	if store.touches != 0 {
+		t.Errorf("ValidateJWT touched the session %d times, want 0", store.touches)
+	}
+
+	auth.Sessions.Touch(WithRequestInfo(context.Background(), RequestInfo{IP: "192.0.2.9"}), tokens.SessionID)
+	if store.touches != 1 {
+		t.Errorf("Touch touched the session %d times, want 1", store.touches)
+	}
+}
+
+// countingHasher counts the password verifications.
+type countingHasher struct {
+	PasswordHasher
+	verifies *int
+}
+
+func (h countingHasher) Verify(password, encoded string) (bool, error) {
+	*h.verifies++
+	return h.PasswordHasher.Verify(password, encoded)
+}
+
+func TestLoginUnknownUserVerifiesAPassword(t *testing.T) {
+	auth := newTestAuthService(t)
+	auth.createUser(t, "alice", true)
+	verifies := 0
+	auth.Hasher = countingHasher{auth.Hasher, &verifies}
+	ctx := context.Background()
+
+	// Both take one verification, so the time taken doesn't tell them apart.
+	for i, username := range []string{"alice", "nobody"} {
+		verifies = 0
+		if _, err := auth.Login(ctx, username, "wrong", fmt.Sprintf("192.0.2.%d", i+1)); !errors.Is(err, repository.ErrInvalidCredentials) {
+			t.Fatalf("Login(%s) err = %v, want ErrInvalidCredentials", username, err)
+		}
+		if verifies != 1 {
+			t.Errorf("Login(%s) verified %d passwords, want 1", username, verifies)
+		}
+	}
+	if hash := auth.dummyPasswordHash(ctx); hash == "" || auth.Hasher.NeedsRehash(hash) {
+		t.Errorf("dummy hash %q isn't made by the configured hasher", hash)
+	}
+}
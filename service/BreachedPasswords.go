@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+//go:embed data/common-passwords.txt
+var commonPasswords []byte
+
+// BreachedPasswords is a Bloom filter over SHA-1 digests of known breached
+// passwords. False positives are possible at the configured rate, false
+// negatives are not.
+type BreachedPasswords struct {
+	bits   []uint64
+	m      uint64
+	hashes uint64
+}
+
+func newBreachedPasswords(expected int, falsePositiveRate float64) *BreachedPasswords {
+	n := float64(max(expected, 1))
+	m := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/n*math.Ln2)))
+	return &BreachedPasswords{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		hashes: k,
+	}
+}
+
+// NewBreachedPasswords builds the filter from the bundled list of common
+// passwords and, if path is set, from a file of SHA-1 hashes in the format of
+// the Pwned Passwords download ("HASH" or "HASH:COUNT" per line).
+func NewBreachedPasswords(path string) (*BreachedPasswords, error) {
+	expected := bytes.Count(commonPasswords, []byte("\n")) + 1
+	var file *os.File
+	if path != "" {
+		var err error
+		file, err = os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if info, err := file.Stat(); err == nil {
+			// A line holds at least the 40 hex characters and a newline.
+			expected += int(info.Size() / 41)
+		}
+	}
+
+	filter := newBreachedPasswords(expected, 0.001)
+
+	scanner := bufio.NewScanner(bytes.NewReader(commonPasswords))
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			digest := sha1.Sum([]byte(password))
+			filter.add(digest)
+		}
+	}
+
+	if file != nil {
+		if err := filter.addHashes(file); err != nil {
+			return nil, fmt.Errorf("reading breached password hashes from %s: %w", path, err)
+		}
+	}
+	return filter, nil
+}
+
+func (f *BreachedPasswords) addHashes(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+		var digest [sha1.Size]byte
+		if n, err := hex.Decode(digest[:], []byte(hash)); err != nil || n != sha1.Size {
+			return fmt.Errorf("line %d is not a SHA-1 hash", line)
+		}
+		f.add(digest)
+	}
+	return scanner.Err()
+}
+
+func (f *BreachedPasswords) Contains(password string) bool {
+	digest := sha1.Sum([]byte(password))
+	h1, h2 := f.baseHashes(digest)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *BreachedPasswords) add(digest [sha1.Size]byte) {
+	h1, h2 := f.baseHashes(digest)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// The digest is already uniformly distributed, so its bytes serve as the two
+// base hashes of the Kirsch-Mitzenmacher scheme.
+func (f *BreachedPasswords) baseHashes(digest [sha1.Size]byte) (uint64, uint64) {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+	return h1, h2
+}
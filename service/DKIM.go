@@ -0,0 +1,133 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// Headers covered by the signature, see RFC 6376 section 5.4.1.
+var dkimHeaderKeys = []string{
+	"From", "To", "Cc", "Subject", "Date", "Message-Id",
+	"Mime-Version", "Content-Type", "Reply-To",
+}
+
+type DKIMKey struct {
+	Domain   string
+	Selector string
+	KeyFile  string
+}
+
+// ParseDKIMKeys parses a comma separated list of domain:selector:keyfile entries.
+func ParseDKIMKeys(value string) ([]DKIMKey, error) {
+	var keys []DKIMKey
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid dkim key %q, expected domain:selector:keyfile", entry)
+		}
+		keys = append(keys, DKIMKey{Domain: parts[0], Selector: parts[1], KeyFile: parts[2]})
+	}
+	return keys, nil
+}
+
+// DKIMMailer signs messages whose sender domain has a configured key and hands
+// them to the next Mailer. Mail from other domains is passed through unsigned.
+type DKIMMailer struct {
+	next    Mailer
+	options map[string]*dkim.SignOptions
+}
+
+func NewDKIMMailer(next Mailer, keys []DKIMKey) (*DKIMMailer, error) {
+	options := make(map[string]*dkim.SignOptions, len(keys))
+	for _, key := range keys {
+		signer, err := LoadDKIMSigner(key.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("dkim key for %s: %w", key.Domain, err)
+		}
+		domain := strings.ToLower(key.Domain)
+		options[domain] = &dkim.SignOptions{
+			Domain:                 domain,
+			Selector:               key.Selector,
+			Signer:                 signer,
+			Hash:                   crypto.SHA256,
+			HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+			BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+			HeaderKeys:             dkimHeaderKeys,
+		}
+	}
+	return &DKIMMailer{next: next, options: options}, nil
+}
+
+func (m *DKIMMailer) Send(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	options, ok := m.options[senderDomain(from)]
+	if !ok {
+		return m.next.Send(ctx, from, to, msg)
+	}
+
+	var raw bytes.Buffer
+	if _, err := msg.WriteTo(&raw); err != nil {
+		return err
+	}
+	var signed bytes.Buffer
+	if err := dkim.Sign(&signed, &raw, options); err != nil {
+		return fmt.Errorf("dkim signing failed: %w", err)
+	}
+	return m.next.Send(ctx, from, to, &signed)
+}
+
+func senderDomain(address string) string {
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(address[at+1:], ">"))
+}
+
+// LoadDKIMSigner reads a PEM encoded RSA (PKCS#1 or PKCS#8) or Ed25519
+// (PKCS#8) private key.
+func LoadDKIMSigner(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"gopkg.in/gomail.v2"
+)
+
+// recordingMailer keeps the raw messages handed to it.
+type recordingMailer struct {
+	sent [][]byte
+}
+
+func (m *recordingMailer) Send(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	var raw bytes.Buffer
+	if _, err := msg.WriteTo(&raw); err != nil {
+		return err
+	}
+	m.sent = append(m.sent, raw.Bytes())
+	return nil
+}
+
+// dkimTestKey writes a PEM private key to a temporary file and returns the
+// path and the DNS TXT record publishing its public half.
+func dkimTestKey(t *testing.T, ed bool) (string, string) {
+	t.Helper()
+	var block *pem.Block
+	var record string
+	if ed {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		record = "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(public)
+	} else {
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}
+		public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record = "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(public)
+	}
+	path := filepath.Join(t.TempDir(), "dkim.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, record
+}
+
+// dkimTestMessage is built like EmailClient.send builds its messages.
+func dkimTestMessage(from string) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", "alice@example.net")
+	m.SetHeader("Subject", "Verify your email")
+	m.SetHeader("Message-ID", "<1@example.com>")
+	m.SetDateHeader("Date", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	m.SetBody("text/plain", "Hello alice,\r\n\r\nplease verify   your email.  \r\n")
+	m.AddAlternative("text/html", "<p>Hello alice,</p>\r\n<p>please verify your email.</p>")
+	return m
+}
+
+func verifyDKIM(t *testing.T, raw []byte, records map[string]string) []*dkim.Verification {
+	t.Helper()
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(raw), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if record, ok := records[domain]; ok {
+				return []string{record}, nil
+			}
+			return nil, fmt.Errorf("no TXT record for %s", domain)
+		},
+	})
+	if err != nil {
+		t.Fatalf("verifying: %v", err)
+	}
+	return verifications
+}
+
+func TestDKIMMailerSignatureVerifies(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ed   bool
+	}{{"RSA", false}, {"Ed25519", true}} {
+		t.Run(tt.name, func(t *testing.T) {
+			keyFile, record := dkimTestKey(t, tt.ed)
+			next := &recordingMailer{}
+			mailer, err := NewDKIMMailer(next, []DKIMKey{{Domain: "Example.com", Selector: "mail", KeyFile: keyFile}})
+			if err != nil {
+				t.Fatalf("NewDKIMMailer: %v", err)
+			}
+			if err := mailer.Send(context.Background(), "no-reply@example.com", []string{"alice@example.net"}, dkimTestMessage("no-reply@example.com")); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if len(next.sent) != 1 {
+				t.Fatalf("%d messages passed on, want 1", len(next.sent))
+			}
+			records := map[string]string{"mail._domainkey.example.com": record}
+
+			verifications := verifyDKIM(t, next.sent[0], records)
+			if len(verifications) != 1 {
+				t.Fatalf("%d signatures, want 1", len(verifications))
+			}
+			if v := verifications[0]; v.Err != nil || v.Domain != "example.com" {
+				t.Fatalf("verification = domain %q, err %v", v.Domain, v.Err)
+			}
+
+			// Relaxed canonicalization tolerates whitespace changes in transit,
+			// but not changes to the content.
+			reflowed := bytes.ReplaceAll(next.sent[0], []byte("please verify   your email."), []byte("please verify your email."))
+			if bytes.Equal(reflowed, next.sent[0]) {
+				t.Fatal("the test message doesn't contain the text to reflow")
+			}
+			if v := verifyDKIM(t, reflowed, records)[0]; v.Err != nil {
+				t.Errorf("whitespace change broke the signature: %v", v.Err)
+			}
+			tampered := bytes.ReplaceAll(next.sent[0], []byte("Hello alice"), []byte("Hello mallory"))
+			if v := verifyDKIM(t, tampered, records)[0]; v.Err == nil {
+				t.Error("signature still verifies after the body changed")
+			}
+		})
+	}
+}
+
+func TestDKIMMailerPicksKeyBySenderDomain(t *testing.T) {
+	comKey, comRecord := dkimTestKey(t, false)
+	orgKey, orgRecord := dkimTestKey(t, false)
+	records := map[string]string{
+		"com._domainkey.example.com": comRecord,
+		"org._domainkey.example.org": orgRecord,
+	}
+	next := &recordingMailer{}
+	mailer, err := NewDKIMMailer(next, []DKIMKey{
+		{Domain: "example.com", Selector: "com", KeyFile: comKey},
+		{Domain: "example.org", Selector: "org", KeyFile: orgKey},
+	})
+	if err != nil {
+		t.Fatalf("NewDKIMMailer: %v", err)
+	}
+
+	for _, tt := range []struct {
+		from       string
+		wantDomain string
+	}{
+		{"no-reply@example.org", "example.org"},
+		{"Auth Service <No-Reply@EXAMPLE.COM>", "example.com"},
+		{"no-reply@example.net", ""},
+	} {
+		next.sent = nil
+		if err := mailer.Send(context.Background(), tt.from, []string{"alice@example.net"}, dkimTestMessage(tt.from)); err != nil {
+			t.Fatalf("Send from %s: %v", tt.from, err)
+		}
+		verifications := verifyDKIM(t, next.sent[0], records)
+		if tt.wantDomain == "" {
+			if len(verifications) != 0 {
+				t.Errorf("mail from %s was signed, want it passed through unsigned", tt.from)
+			}
+			continue
+		}
+		if len(verifications) != 1 || verifications[0].Err != nil || verifications[0].Domain != tt.wantDomain {
+			t.Errorf("mail from %s: verifications %+v, want one valid signature of %s", tt.from, verifications, tt.wantDomain)
+		}
+	}
+}
+
+func TestParseDKIMKeys(t *testing.T) {
+	keys, err := ParseDKIMKeys(" example.com:mail:/keys/com.pem, ,example.org:s2:C:/keys/org.pem,")
+	if err != nil {
+		t.Fatalf("ParseDKIMKeys: %v", err)
+	}
+	want := []DKIMKey{
+		{Domain: "example.com", Selector: "mail", KeyFile: "/keys/com.pem"},
+		{Domain: "example.org", Selector: "s2", KeyFile: "C:/keys/org.pem"},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("ParseDKIMKeys = %+v, want %+v", keys, want)
+	}
+	if keys, err := ParseDKIMKeys(""); err != nil || len(keys) != 0 {
+		t.Errorf(`ParseDKIMKeys("") = %v, %v, want no keys`, keys, err)
+	}
+
+	for _, value := range []string{
+		"example.com",
+		"example.com:mail",
+		":mail:/keys/com.pem",
+		"example.com::/keys/com.pem",
+		"example.com:mail:",
+		"example.com:mail:/keys/com.pem,example.org",
+	} {
+		if _, err := ParseDKIMKeys(value); err == nil {
+			t.Errorf("ParseDKIMKeys(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestNewDKIMMailerRejectsBadKeys(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	os.WriteFile(notPEM, []byte("not a key"), 0o600)
+	wrongType := filepath.Join(dir, "cert.pem")
+	os.WriteFile(wrongType, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}), 0o600)
+
+	for _, keyFile := range []string{filepath.Join(dir, "missing.pem"), notPEM, wrongType} {
+		_, err := NewDKIMMailer(&recordingMailer{}, []DKIMKey{{Domain: "example.com", Selector: "mail", KeyFile: keyFile}})
+		if err == nil || !strings.Contains(err.Error(), "example.com") {
+			t.Errorf("NewDKIMMailer(%s) err = %v, want an error naming the domain", filepath.Base(keyFile), err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import "strings"
+
+// uaMatch maps a User-Agent token to a display name. Order matters: Edge and
+// Opera also claim to be Chrome, Chrome claims to be Safari, Android claims
+// to be Linux.
+type uaMatch struct {
+	token, name string
+}
+
+var uaBrowsers = []uaMatch{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+	{"okhttp/", "OkHttp"},
+	{"Go-http-client/", "Go HTTP client"},
+	{"python-requests/", "Python Requests"},
+}
+
+var uaPlatforms = []uaMatch{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"CrOS", "ChromeOS"},
+	{"Macintosh", "macOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceName gives a short description of the client, e.g. "Firefox on
+// Windows", from its User-Agent. It only recognises common clients.
+func DeviceName(userAgent string) string {
+	browser := matchUserAgent(uaBrowsers, userAgent)
+	platform := matchUserAgent(uaPlatforms, userAgent)
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return "Browser on " + platform
+	default:
+		return "Unknown device"
+	}
+}
+
+func matchUserAgent(matches []uaMatch, userAgent string) string {
+	for _, match := range matches {
+		if strings.Contains(userAgent, match.token) {
+			return match.name
+		}
+	}
+	return ""
+}
@@ -2,49 +2,148 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"log"
+	"net/url"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/gomail.v2"
 )
 
 type EmailClient struct {
-	dialer *gomail.Dialer
-	logger *log.Logger
-	from   string
+	mailer    Mailer
+	templates *EmailTemplates
+	logger    *log.Logger
+	from      string
+	baseURL   string
 }
 
-func NewEmailClient(host string, port int, username, password, from string, logger *log.Logger) *EmailClient {
-	dialer := gomail.NewDialer(host, port, username, password)
+func NewEmailClient(mailer Mailer, templates *EmailTemplates, from, baseURL string, logger *log.Logger) *EmailClient {
 	return &EmailClient{
-		dialer: dialer,
-		logger: logger,
-		from:   from,
+		mailer:    mailer,
+		templates: templates,
+		logger:    logger,
+		from:      from,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
 	}
 }
 
-func (c *EmailClient) SendVerificationEmail(ctx context.Context, toEmail, userID, token string) error {
-	activationLink := "http://example.com/api/auth/verify?user_id=" + userID + "&token=" + token
+// ResolveLocale returns the mail locale for the given preferences, e.g. the
+// user's stored locale followed by the request's Accept-Language header.
+func (c *EmailClient) ResolveLocale(preferences ...string) string {
+	return c.templates.ResolveLocale(preferences...)
+}
+
+type verificationEmail struct {
+	Username string
+	Link     string
+}
+
+func (c *EmailClient) SendVerificationEmail(ctx context.Context, toEmail, locale, username, userID, token string) error {
+	link := c.link("/api/auth/verify", url.Values{"user_id": {userID}, "token": {token}})
+	err := c.send(ctx, toEmail, TemplateVerification, locale, verificationEmail{Username: username, Link: link})
+	if err == nil {
+		c.logger.Printf("Verification email sent to %s", toEmail)
+	}
+	return err
+}
+
+type passwordResetEmail struct {
+	Username string
+	Link     string
+}
+
+func (c *EmailClient) SendPasswordResetEmail(ctx context.Context, toEmail, locale, username, token string) error {
+	link := c.link("/reset-password", url.Values{"token": {token}})
+	err := c.send(ctx, toEmail, TemplatePasswordReset, locale, passwordResetEmail{Username: username, Link: link})
+	if err == nil {
+		c.logger.Printf("Password reset email sent to %s", toEmail)
+	}
+	return err
+}
+
+const (
+	AlertAccountLocked   = "account_locked"
+	AlertNewDevice       = "new_device"
+	AlertPasswordChanged = "password_changed"
+)
+
+// SecurityAlert describes the event a security alert mail is about. Link is
+// optional and points the user to a page where the account can be secured.
+type SecurityAlert struct {
+	Kind     string
+	Username string
+	Time     time.Time
+	Until    time.Time
+	IP       string
+	Device   string
+	Location string
+	Link     string
+}
+
+func (c *EmailClient) SendSecurityAlertEmail(ctx context.Context, toEmail, locale string, alert SecurityAlert) error {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+	err := c.send(ctx, toEmail, TemplateSecurityAlert, locale, alert)
+	if err == nil {
+		c.logger.Printf("Security alert (%s) sent to %s", alert.Kind, toEmail)
+	}
+	return err
+}
+
+func (c *EmailClient) link(path string, query url.Values) string {
+	return c.baseURL + path + "?" + query.Encode()
+}
+
+func (c *EmailClient) messageID() string {
+	domain := senderDomain(c.from)
+	if domain == "" {
+		domain = "localhost"
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">"
+}
+
+func (c *EmailClient) send(ctx context.Context, toEmail, template, locale string, data any) (err error) {
+	ctx, span := tracer.Start(ctx, "EmailClient.send", trace.WithAttributes(
+		attribute.String("email.template", template),
+		attribute.String("email.locale", locale),
+	))
+	defer func() { endSpan(span, err) }()
+
+	rendered, err := c.templates.Render(template, locale, data)
+	if err != nil {
+		c.logger.Printf("Failed to render %s email: %v", template, err)
+		emailsTotal.WithLabelValues(template, "failed").Inc()
+		return err
+	}
+
 	m := gomail.NewMessage()
 	m.SetHeader("From", c.from)
 	m.SetHeader("To", toEmail)
-	m.SetHeader("Subject", "ACTIVATE ACCOUNT")
-	m.SetBody("text/plain", "Please activate your account by clicking the link: "+activationLink)
-	m.AddAlternative("text/html", "<p>Please activate your account by clicking the link: <a href=\""+activationLink+"\">Activate</a></p>")
+	m.SetHeader("Subject", rendered.Subject)
+	m.SetHeader("Message-ID", c.messageID())
+	m.SetDateHeader("Date", time.Now())
+	m.SetBody("text/plain", rendered.Text)
+	m.AddAlternative("text/html", rendered.HTML)
 
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	select {
-	case <-ctx.Done():
-		c.logger.Printf("Email send to %s cancelled: %v", toEmail, ctx.Err())
-		return ctx.Err()
-	default:
-		if err := c.dialer.DialAndSend(m); err != nil {
-			c.logger.Printf("Failed to send email to %s: %v", toEmail, err)
-			return err
-		}
-		c.logger.Printf("Verification email sent to %s", toEmail)
-		return nil
+	sendCtx, sendSpan := tracer.Start(ctx, "Mailer.Send", trace.WithSpanKind(trace.SpanKindClient))
+	err = c.mailer.Send(sendCtx, c.from, []string{toEmail}, m)
+	endSpan(sendSpan, err)
+	if err != nil {
+		c.logger.Printf("Failed to send email to %s: %v", toEmail, err)
+		emailsTotal.WithLabelValues(template, "failed").Inc()
+		return err
 	}
+	emailsTotal.WithLabelValues(template, "sent").Inc()
+	return nil
 }
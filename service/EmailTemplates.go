@@ -0,0 +1,188 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed templates/*
+var embeddedTemplates embed.FS
+
+const (
+	TemplateVerification  = "verification"
+	TemplatePasswordReset = "password_reset"
+	TemplateSecurityAlert = "security_alert"
+)
+
+var ErrTemplateNotFound = errors.New("email template not found")
+
+// Every template exists as <name>.<locale>.txt and <name>.<locale>.html. The
+// text variant must also define a "subject" template.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type RenderedEmail struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type EmailTemplates struct {
+	templates     map[string]map[string]*emailTemplate
+	defaultLocale string
+	matcher       language.Matcher
+	locales       []string
+}
+
+// NewEmailTemplates loads the built-in templates. Files in overrideDir with the
+// same name replace the built-in ones, new files add templates or locales.
+func NewEmailTemplates(overrideDir, defaultLocale string) (*EmailTemplates, error) {
+	builtin, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]fs.FS{}
+	if err := collectTemplateFiles(builtin, sources); err != nil {
+		return nil, err
+	}
+	if overrideDir != "" {
+		if err := collectTemplateFiles(os.DirFS(overrideDir), sources); err != nil {
+			return nil, fmt.Errorf("loading email templates from %s: %w", overrideDir, err)
+		}
+	}
+
+	t := &EmailTemplates{
+		templates:     map[string]map[string]*emailTemplate{},
+		defaultLocale: defaultLocale,
+	}
+
+	for file, fsys := range sources {
+		if !strings.HasSuffix(file, ".txt") {
+			continue
+		}
+		base := strings.TrimSuffix(file, ".txt")
+		name, locale, ok := strings.Cut(base, ".")
+		if !ok {
+			return nil, fmt.Errorf("email template %s has no locale in its name", file)
+		}
+		htmlFS, ok := sources[base+".html"]
+		if !ok {
+			return nil, fmt.Errorf("email template %s has no html variant", file)
+		}
+
+		text, err := texttemplate.ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("email template %s does not define a subject", file)
+		}
+		html, err := htmltemplate.ParseFS(htmlFS, base+".html")
+		if err != nil {
+			return nil, err
+		}
+
+		if t.templates[name] == nil {
+			t.templates[name] = map[string]*emailTemplate{}
+		}
+		t.templates[name][locale] = &emailTemplate{text: text, html: html}
+	}
+
+	// The default locale goes first so the matcher falls back to it.
+	tags := []language.Tag{language.Make(defaultLocale)}
+	t.locales = []string{defaultLocale}
+	seen := map[string]bool{defaultLocale: true}
+	for _, byLocale := range t.templates {
+		for locale := range byLocale {
+			if !seen[locale] {
+				seen[locale] = true
+				t.locales = append(t.locales, locale)
+				tags = append(tags, language.Make(locale))
+			}
+		}
+	}
+	t.matcher = language.NewMatcher(tags)
+
+	for name, byLocale := range t.templates {
+		if _, ok := byLocale[defaultLocale]; !ok {
+			return nil, fmt.Errorf("email template %s has no %s variant", name, defaultLocale)
+		}
+	}
+
+	return t, nil
+}
+
+func collectTemplateFiles(fsys fs.FS, sources map[string]fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".txt" && ext != ".html") {
+			continue
+		}
+		sources[entry.Name()] = fsys
+	}
+	return nil
+}
+
+// ResolveLocale picks the best supported locale. Preferences are tried in
+// order and may be plain tags ("sr") or Accept-Language header values.
+func (t *EmailTemplates) ResolveLocale(preferences ...string) string {
+	for _, preference := range preferences {
+		if preference == "" {
+			continue
+		}
+		tags, _, err := language.ParseAcceptLanguage(preference)
+		if err != nil || len(tags) == 0 {
+			continue
+		}
+		_, index, confidence := t.matcher.Match(tags...)
+		if confidence != language.No {
+			return t.locales[index]
+		}
+	}
+	return t.defaultLocale
+}
+
+func (t *EmailTemplates) Render(name, locale string, data any) (*RenderedEmail, error) {
+	byLocale, ok := t.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	tmpl, ok := byLocale[locale]
+	if !ok {
+		tmpl = byLocale[t.defaultLocale]
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.html.Execute(&html, data); err != nil {
+		return nil, err
+	}
+
+	return &RenderedEmail{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Domain events published to other services. Payloads only ever gain fields,
+// consumers must ignore fields they don't know.
+const (
+	EventUserRegistered  = "UserRegistered"
+	EventUserActivated   = "UserActivated"
+	EventUserRoleChanged = "UserRoleChanged"
+	EventUserDeactivated = "UserDeactivated"
+	EventProfileUpdated  = "ProfileUpdated"
+)
+
+var EventTypes = []string{EventUserRegistered, EventUserActivated, EventUserRoleChanged, EventUserDeactivated, EventProfileUpdated}
+
+// userRegisteredPayload leaves out the email address, subscribers that need
+// it have to ask for it.
+type userRegisteredPayload struct {
+	UserID       string         `json:"user_id"`
+	Username     string         `json:"username"`
+	Role         model.UserRole `json:"role"`
+	FirstName    string         `json:"first_name"`
+	LastName     string         `json:"last_name"`
+	ProfileImage string         `json:"profile_image"`
+	Locale       string         `json:"locale"`
+}
+
+type userRoleChangedPayload struct {
+	UserID  string         `json:"user_id"`
+	OldRole model.UserRole `json:"old_role"`
+	NewRole model.UserRole `json:"new_role"`
+}
+
+type profileUpdatedPayload struct {
+	UserID       string `json:"user_id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	ProfileImage string `json:"profile_image"`
+	Locale       string `json:"locale"`
+}
+
+type userPayload struct {
+	UserID string `json:"user_id"`
+}
+
+func newEvent(eventType string, userID primitive.ObjectID, payload interface{}) (model.Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return model.Event{}, err
+	}
+	return model.Event{
+		ID:          primitive.NewObjectID(),
+		Type:        eventType,
+		AggregateID: userID.Hex(),
+		OccurredAt:  time.Now().UTC(),
+		Payload:     data,
+	}, nil
+}
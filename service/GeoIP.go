@@ -0,0 +1,64 @@
+package service
+
+import (
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// GeoLocation is the rough location of an IP address. Fields the database
+// doesn't know are empty.
+type GeoLocation struct {
+	CountryCode string
+	Country     string
+	City        string
+}
+
+func (l GeoLocation) String() string {
+	switch {
+	case l.City != "" && l.Country != "":
+		return l.City + ", " + l.Country
+	default:
+		return l.Country
+	}
+}
+
+// GeoIP looks up locations in a local MaxMind database, either a City or a
+// Country edition. A nil GeoIP knows no locations.
+type GeoIP struct {
+	reader *geoip2.Reader
+}
+
+func OpenGeoIP(path string) (*GeoIP, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{reader: reader}, nil
+}
+
+func (g *GeoIP) Locate(ip string) GeoLocation {
+	parsed := net.ParseIP(ip)
+	if g == nil || parsed == nil {
+		return GeoLocation{}
+	}
+	if city, err := g.reader.City(parsed); err == nil {
+		return GeoLocation{
+			CountryCode: city.Country.IsoCode,
+			Country:     city.Country.Names["en"],
+			City:        city.City.Names["en"],
+		}
+	}
+	country, err := g.reader.Country(parsed)
+	if err != nil {
+		return GeoLocation{}
+	}
+	return GeoLocation{CountryCode: country.Country.IsoCode, Country: country.Country.Names["en"]}
+}
+
+func (g *GeoIP) Close() error {
+	if g == nil {
+		return nil
+	}
+	return g.reader.Close()
+}
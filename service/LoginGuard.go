@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+var (
+	ErrAccountLocked  = apperror.New(apperror.KindLocked, "auth.account_locked", "account temporarily locked")
+	ErrLoginThrottled = apperror.New(apperror.KindTooManyRequests, "auth.login_throttled", "too many login attempts")
+)
+
+type LockoutPolicy struct {
+	// Failures per account and per IP after which logins are locked.
+	MaxUserFailures int
+	MaxIPFailures   int
+	LockoutDuration time.Duration
+	// Every failure doubles the wait before the next attempt, starting at
+	// BaseDelay and capped at MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Failures older than Window are forgotten.
+	Window time.Duration
+}
+
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxUserFailures: 5,
+		MaxIPFailures:   20,
+		LockoutDuration: 15 * time.Minute,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		Window:          15 * time.Minute,
+	}
+}
+
+type LoginGuard struct {
+	repo   repository.LoginAttemptStore
+	policy LockoutPolicy
+}
+
+func NewLoginGuard(repo repository.LoginAttemptStore, policy LockoutPolicy) *LoginGuard {
+	return &LoginGuard{repo: repo, policy: policy}
+}
+
+// userAttemptKey counts failures per account, so spellings that differ only
+// in case share one counter.
+func userAttemptKey(username string) string {
+	if canonical, err := repository.CanonicalUsername(username); err == nil {
+		return "user:" + canonical
+	}
+	return "user:" + username
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns ErrAccountLocked or ErrLoginThrottled, carrying the time to
+// wait, if the account or the IP is locked or has to wait after a failure.
+func (g *LoginGuard) Check(ctx context.Context, username, ip string) error {
+	now := time.Now()
+	keys := []string{userAttemptKey(username)}
+	if ip != "" {
+		keys = append(keys, ipAttemptKey(ip))
+	}
+
+	for _, key := range keys {
+		attempt, err := g.repo.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if attempt.LockedUntil.After(now) {
+			return ErrAccountLocked.WithRetryAfter(attempt.LockedUntil.Sub(now))
+		}
+		if attempt.NextAttemptAt.After(now) {
+			return ErrLoginThrottled.WithRetryAfter(attempt.NextAttemptAt.Sub(now))
+		}
+	}
+	return nil
+}
+
+// Reserve counts the attempt against the account before the password is
+// verified. The counter is incremented atomically, so concurrent attempts,
+// even on other replicas, each get their own number and no more than
+// MaxUserFailures of them are let through per lockout. A successful login
+// gives the reservation back through Success.
+func (g *LoginGuard) Reserve(ctx context.Context, username string) (*model.LoginAttempt, error) {
+	now := time.Now()
+	attempt, err := g.repo.RecordFailure(ctx, userAttemptKey(username), now, g.policy.Window)
+	if err != nil {
+		return nil, err
+	}
+	if attempt.Failures > g.policy.MaxUserFailures {
+		lockedUntil, _, err := g.block(ctx, attempt, g.policy.MaxUserFailures, now)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrAccountLocked.WithRetryAfter(lockedUntil.Sub(now))
+	}
+	return attempt, nil
+}
+
+// Failure records a failed login for the attempt Reserve counted.
+// lockedNow is true only for the one failure that pushed the account over
+// the threshold, so callers notify the user once.
+func (g *LoginGuard) Failure(ctx context.Context, attempt *model.LoginAttempt, ip string) (lockedUntil time.Time, lockedNow bool, err error) {
+	now := time.Now()
+
+	lockedUntil, lockedNow, err = g.block(ctx, attempt, g.policy.MaxUserFailures, now)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if ip != "" {
+		ipAttempt, err := g.repo.RecordFailure(ctx, ipAttemptKey(ip), now, g.policy.Window)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if _, _, err := g.block(ctx, ipAttempt, g.policy.MaxIPFailures, now); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	return lockedUntil, lockedNow, nil
+}
+
+func (g *LoginGuard) block(ctx context.Context, attempt *model.LoginAttempt, threshold int, now time.Time) (time.Time, bool, error) {
+	delay := g.policy.MaxDelay
+	if shift := attempt.Failures - 1; shift < 16 {
+		delay = min(g.policy.BaseDelay<<shift, g.policy.MaxDelay)
+	}
+
+	var lockedUntil time.Time
+	if attempt.Failures >= threshold {
+		lockedUntil = now.Add(g.policy.LockoutDuration)
+	}
+
+	if err := g.repo.Block(ctx, attempt.Key, now.Add(delay), lockedUntil); err != nil {
+		return time.Time{}, false, err
+	}
+	return lockedUntil, attempt.Failures == threshold, nil
+}
+
+// Success clears the account counter. The IP counter is kept, otherwise a
+// single valid account would let an attacker reset it.
+func (g *LoginGuard) Success(ctx context.Context, username string) error {
+	return g.repo.Reset(ctx, userAttemptKey(username))
+}
+
+func (g *LoginGuard) Unlock(ctx context.Context, username string) error {
+	return g.repo.Reset(ctx, userAttemptKey(username))
+}
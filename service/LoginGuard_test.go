@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+// slowHasher holds every verification long enough for all concurrent
+// attempts to get past the lockout check before any failure is recorded.
+type slowHasher struct {
+	PasswordHasher
+}
+
+func (h slowHasher) Verify(password, encoded string) (bool, error) {
+	time.Sleep(50 * time.Millisecond)
+	return h.PasswordHasher.Verify(password, encoded)
+}
+
+func TestLoginConcurrentGuessesAreCapped(t *testing.T) {
+	auth := newTestAuthService(t)
+	auth.createUser(t, "target", true)
+	auth.Hasher = slowHasher{auth.Hasher}
+	max := auth.LoginGuard.policy.MaxUserFailures
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Distinct IPs, so only the account counter limits the guesses.
+			_, errs[i] = auth.Login(context.Background(), "target", fmt.Sprintf("guess-%d", i), fmt.Sprintf("192.0.2.%d", i+1))
+		}()
+	}
+	wg.Wait()
+
+	guesses := 0
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, repository.ErrInvalidCredentials):
+			guesses++
+		case errors.Is(err, ErrAccountLocked), errors.Is(err, ErrLoginThrottled):
+		default:
+			t.Errorf("Login err = %v, want invalid credentials, locked or throttled", err)
+		}
+	}
+	if guesses == 0 || guesses > max {
+		t.Errorf("%d passwords were checked, want between 1 and %d", guesses, max)
+	}
+
+	if _, err := auth.Login(context.Background(), "target", testPassword, "198.51.100.1"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Login with the right password after the guesses: err = %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestChangePasswordGuessesLockTheAccount(t *testing.T) {
+	auth := newTestAuthService(t)
+	user := auth.createUser(t, "target", true)
+	// No wait between attempts, only the lockout limits the guesses.
+	auth.LoginGuard.policy.BaseDelay = 0
+	ctx := WithRequestInfo(context.Background(), RequestInfo{IP: "192.0.2.1"})
+
+	for i := range auth.LoginGuard.policy.MaxUserFailures {
+		err := auth.ChangePassword(ctx, user.ID.Hex(), fmt.Sprintf("guess-%d", i), "Another-Horse-Battery-7")
+		if !errors.Is(err, repository.ErrInvalidCredentials) {
+			t.Fatalf("ChangePassword(guess %d) err = %v, want ErrInvalidCredentials", i, err)
+		}
+	}
+	if err := auth.ChangePassword(ctx, user.ID.Hex(), testPassword, "Another-Horse-Battery-7"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("ChangePassword(right password) after the guesses: err = %v, want ErrAccountLocked", err)
+	}
+	if _, err := auth.Login(context.Background(), "target", testPassword, "198.51.100.1"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Login after the guesses: err = %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestUnlockDeactivatedAccount(t *testing.T) {
+	auth := newTestAuthService(t)
+	user := auth.createUser(t, "target", true)
+	auth.LoginGuard.policy.BaseDelay = 0
+	ctx := context.Background()
+
+	for i := range auth.LoginGuard.policy.MaxUserFailures {
+		auth.Login(ctx, "target", fmt.Sprintf("guess-%d", i), fmt.Sprintf("192.0.2.%d", i+1))
+	}
+	if _, err := auth.users.SetUserActive(ctx, user.ID, false); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	if _, err := auth.Login(ctx, "target", testPassword, "198.51.100.1"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Login before unlock: err = %v, want ErrAccountLocked", err)
+	}
+	if err := auth.UnlockAccount(ctx, user.ID.Hex()); err != nil {
+		t.Fatalf("UnlockAccount(deactivated) err = %v", err)
+	}
+
+	if _, err := auth.users.SetUserActive(ctx, user.ID, true); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	if _, err := auth.Login(ctx, "target", testPassword, "198.51.100.1"); err != nil {
+		t.Errorf("Login after unlock and reactivation: %v", err)
+	}
+}
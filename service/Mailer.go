@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Mailer delivers an already composed message to the given recipients.
+type Mailer interface {
+	Send(ctx context.Context, from string, to []string, msg io.WriterTo) error
+}
+
+type TLSMode string
+
+const (
+	TLSModeNone     TLSMode = "none"
+	TLSModeStartTLS TLSMode = "starttls"
+	TLSModeImplicit TLSMode = "tls"
+)
+
+const (
+	MailTransportSMTP = "smtp"
+	MailTransportFile = "file"
+	MailTransportLog  = "log"
+)
+
+var ErrUnknownMailTransport = errors.New("unknown mail transport")
+
+type MailerConfig struct {
+	Transport string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTLSMode  TLSMode
+
+	// Dir is the output directory of the file transport. With Maildir set the
+	// directory gets the tmp/new/cur layout, otherwise plain .eml files are written.
+	Dir     string
+	Maildir bool
+}
+
+func NewMailer(cfg MailerConfig) (Mailer, error) {
+	switch cfg.Transport {
+	case MailTransportSMTP:
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPTLSMode)
+	case MailTransportFile:
+		return NewFileMailer(cfg.Dir, cfg.Maildir)
+	case MailTransportLog:
+		return NewLogMailer(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMailTransport, cfg.Transport)
+	}
+}
+
+type SMTPMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	tlsMode  TLSMode
+}
+
+func NewSMTPMailer(host string, port int, username, password string, tlsMode TLSMode) (*SMTPMailer, error) {
+	if host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	switch tlsMode {
+	case "":
+		tlsMode = TLSModeStartTLS
+	case TLSModeNone, TLSModeStartTLS, TLSModeImplicit:
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode %q", tlsMode)
+	}
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		tlsMode:  tlsMode,
+	}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{ServerName: m.host}
+	if m.tlsMode == TLSModeImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.tlsMode == TLSModeStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if m.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// FileMailer drops every message into a directory instead of sending it,
+// which is handy for local development and for inspecting mails in tests.
+type FileMailer struct {
+	dir     string
+	maildir bool
+	seq     atomic.Uint64
+}
+
+func NewFileMailer(dir string, maildir bool) (*FileMailer, error) {
+	if dir == "" {
+		return nil, errors.New("mail directory is required")
+	}
+	subdirs := []string{""}
+	if maildir {
+		subdirs = []string{"tmp", "new", "cur"}
+	}
+	for _, sub := range subdirs {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &FileMailer{dir: dir, maildir: maildir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	name := m.uniqueName()
+	if !m.maildir {
+		return writeFile(filepath.Join(m.dir, name+".eml"), msg)
+	}
+
+	// Maildir delivery: write into tmp/ and atomically move into new/.
+	tmpPath := filepath.Join(m.dir, "tmp", name)
+	if err := writeFile(tmpPath, msg); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(m.dir, "new", name))
+}
+
+func (m *FileMailer) uniqueName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%d.%d_%d.%s", time.Now().UnixNano(), os.Getpid(), m.seq.Add(1), host)
+}
+
+func writeFile(path string, msg io.WriterTo) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// LogMailer prints messages to a writer, by default stdout.
+type LogMailer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewLogMailer(out io.Writer) *LogMailer {
+	return &LogMailer{out: out}
+}
+
+func (m *LogMailer) Send(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(m.out, "----- mail from %s to %v -----\n", from, to)
+	if _, err := msg.WriteTo(m.out); err != nil {
+		return err
+	}
+	fmt.Fprintln(m.out, "\n----- end of mail -----")
+	return nil
+}
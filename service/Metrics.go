@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Label values are fixed sets, never user input, to keep the number of
+// series bounded.
+var (
+	loginsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "logins_total",
+		Help:      "Login attempts by result: success, invalid_credentials, not_active, locked, throttled or error.",
+	}, []string{"result"})
+	registrationsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "registrations_total",
+		Help:      "Accounts registered.",
+	})
+	tokensIssuedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "tokens_issued_total",
+		Help:      "Access tokens issued by grant: login or refresh.",
+	}, []string{"grant"})
+	tokenValidationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "token_validations_total",
+		Help:      "Access token validations by result: valid, invalid, revoked or error.",
+	}, []string{"result"})
+	emailsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "emails_total",
+		Help:      "Emails by template and result: sent or failed.",
+	}, []string{"template", "result"})
+	auditEntriesDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Name:      "audit_entries_dropped_total",
+		Help:      "Audit entries lost by reason: queue_full or write_failed.",
+	}, []string{"reason"})
+)
+
+func init() {
+	// Start the known series at zero so rates work from the first event.
+	for _, result := range []string{"success", "invalid_credentials", "not_active", "locked", "throttled", "error"} {
+		loginsTotal.WithLabelValues(result)
+	}
+	for _, grant := range []string{"login", "refresh"} {
+		tokensIssuedTotal.WithLabelValues(grant)
+	}
+	for _, result := range []string{"valid", "invalid", "revoked", "error"} {
+		tokenValidationsTotal.WithLabelValues(result)
+	}
+	for _, reason := range []string{"queue_full", "write_failed"} {
+		auditEntriesDroppedTotal.WithLabelValues(reason)
+	}
+}
+
+func loginResult(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, repository.ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, repository.ErrUserNotActive):
+		return "not_active"
+	case errors.Is(err, ErrAccountLocked):
+		return "locked"
+	case errors.Is(err, ErrLoginThrottled):
+		return "throttled"
+	default:
+		return "error"
+	}
+}
+
+func tokenValidationResult(err error) string {
+	switch {
+	case err == nil:
+		return "valid"
+	case errors.Is(err, ErrInvalidToken):
+		return "invalid"
+	case errors.Is(err, ErrSessionRevoked):
+		return "revoked"
+	default:
+		return "error"
+	}
+}
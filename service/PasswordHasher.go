@@ -0,0 +1,260 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	ErrUnknownPepper     = errors.New("password hash uses an unknown pepper")
+)
+
+// PasswordHasher produces self-describing hashes in the PHC string format, so
+// the algorithm and its parameters can change without breaking stored hashes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was produced with an algorithm,
+	// parameters or pepper other than the current configuration.
+	NeedsRehash(encoded string) bool
+}
+
+type Argon2Params struct {
+	Memory     uint32
+	Iterations uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+type HasherConfig struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+	// Peppers maps key ids to server side secrets mixed into every password.
+	// New hashes use PepperID; the others are kept to verify older hashes.
+	Peppers  map[string][]byte
+	PepperID string
+}
+
+func DefaultHasherConfig() HasherConfig {
+	// OWASP recommendation for argon2id.
+	return HasherConfig{
+		Algorithm: AlgorithmArgon2id,
+		Argon2: Argon2Params{
+			Memory:     19 * 1024,
+			Iterations: 2,
+			Threads:    1,
+			SaltLength: 16,
+			KeyLength:  32,
+		},
+		BcryptCost: 12,
+	}
+}
+
+type phcHasher struct {
+	cfg HasherConfig
+}
+
+func NewPasswordHasher(cfg HasherConfig) (PasswordHasher, error) {
+	switch cfg.Algorithm {
+	case AlgorithmArgon2id, AlgorithmBcrypt:
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+	if cfg.PepperID != "" {
+		if _, ok := cfg.Peppers[cfg.PepperID]; !ok {
+			return nil, fmt.Errorf("no pepper configured for key id %q", cfg.PepperID)
+		}
+		if strings.ContainsAny(cfg.PepperID, "$,=") {
+			return nil, fmt.Errorf("pepper key id %q contains reserved characters", cfg.PepperID)
+		}
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost %d out of range", cfg.BcryptCost)
+	}
+	return &phcHasher{cfg: cfg}, nil
+}
+
+// phc is a parsed $id$params$salt$hash string. Legacy bcrypt hashes stored in
+// their native $2a$ form are parsed with id "bcrypt" and legacy set.
+type phc struct {
+	id      string
+	version int
+	params  map[string]string
+	salt    []byte
+	hash    []byte
+	bcrypt  []byte
+	legacy  bool
+}
+
+func parsePHC(encoded string) (*phc, error) {
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		return &phc{id: AlgorithmBcrypt, bcrypt: []byte(encoded), legacy: true, params: map[string]string{}}, nil
+	}
+
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 3 || fields[0] != "" {
+		return nil, ErrUnknownHashFormat
+	}
+	p := &phc{id: fields[1], params: map[string]string{}}
+	rest := fields[2:]
+
+	if version, ok := strings.CutPrefix(rest[0], "v="); ok {
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, ErrUnknownHashFormat
+		}
+		p.version = v
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+	for _, param := range strings.Split(rest[0], ",") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, ErrUnknownHashFormat
+		}
+		p.params[key] = value
+	}
+	rest = rest[1:]
+
+	switch p.id {
+	case AlgorithmArgon2id:
+		if len(rest) != 2 {
+			return nil, ErrUnknownHashFormat
+		}
+		var err error
+		if p.salt, err = base64.RawStdEncoding.DecodeString(rest[0]); err != nil {
+			return nil, ErrUnknownHashFormat
+		}
+		if p.hash, err = base64.RawStdEncoding.DecodeString(rest[1]); err != nil {
+			return nil, ErrUnknownHashFormat
+		}
+	case AlgorithmBcrypt:
+		// The bcrypt salt and hash use bcrypt's own base64 alphabet and are kept as is.
+		cost, err := strconv.Atoi(p.params["r"])
+		if len(rest) != 1 || err != nil {
+			return nil, ErrUnknownHashFormat
+		}
+		p.bcrypt = []byte(fmt.Sprintf("$2b$%02d$%s", cost, rest[0]))
+	default:
+		return nil, ErrUnknownHashFormat
+	}
+	return p, nil
+}
+
+func (h *phcHasher) Hash(password string) (string, error) {
+	input, err := h.pepper(password, h.cfg.PepperID)
+	if err != nil {
+		return "", err
+	}
+	keyID := ""
+	if h.cfg.PepperID != "" {
+		keyID = ",keyid=" + h.cfg.PepperID
+	}
+
+	switch h.cfg.Algorithm {
+	case AlgorithmArgon2id:
+		params := h.cfg.Argon2
+		salt := make([]byte, params.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey(input, salt, params.Iterations, params.Memory, params.Threads, params.KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d%s$%s$%s",
+			argon2.Version, params.Memory, params.Iterations, params.Threads, keyID,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	default:
+		hash, err := bcrypt.GenerateFromPassword(input, h.cfg.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		// $2a$12$<salt+hash> becomes $bcrypt$r=12$<salt+hash>.
+		parts := strings.SplitN(string(hash), "$", 4)
+		return fmt.Sprintf("$bcrypt$r=%d%s$%s", h.cfg.BcryptCost, keyID, parts[3]), nil
+	}
+}
+
+func (h *phcHasher) Verify(password, encoded string) (bool, error) {
+	p, err := parsePHC(encoded)
+	if err != nil {
+		return false, err
+	}
+	input, err := h.pepper(password, p.params["keyid"])
+	if err != nil {
+		return false, err
+	}
+
+	switch p.id {
+	case AlgorithmArgon2id:
+		memory, err1 := strconv.ParseUint(p.params["m"], 10, 32)
+		iterations, err2 := strconv.ParseUint(p.params["t"], 10, 32)
+		threads, err3 := strconv.ParseUint(p.params["p"], 10, 8)
+		if err := errors.Join(err1, err2, err3); err != nil || p.version != argon2.Version {
+			return false, ErrUnknownHashFormat
+		}
+		key := argon2.IDKey(input, p.salt, uint32(iterations), uint32(memory), uint8(threads), uint32(len(p.hash)))
+		return subtle.ConstantTimeCompare(key, p.hash) == 1, nil
+	default:
+		err := bcrypt.CompareHashAndPassword(p.bcrypt, input)
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
+
+func (h *phcHasher) NeedsRehash(encoded string) bool {
+	p, err := parsePHC(encoded)
+	if err != nil || p.legacy {
+		return true
+	}
+	if p.id != h.cfg.Algorithm || p.params["keyid"] != h.cfg.PepperID {
+		return true
+	}
+
+	switch p.id {
+	case AlgorithmArgon2id:
+		params := h.cfg.Argon2
+		return p.version != argon2.Version ||
+			p.params["m"] != strconv.FormatUint(uint64(params.Memory), 10) ||
+			p.params["t"] != strconv.FormatUint(uint64(params.Iterations), 10) ||
+			p.params["p"] != strconv.FormatUint(uint64(params.Threads), 10) ||
+			len(p.salt) != int(params.SaltLength) || len(p.hash) != int(params.KeyLength)
+	default:
+		return p.params["r"] != strconv.Itoa(h.cfg.BcryptCost)
+	}
+}
+
+// pepper mixes the secret of keyID into the password with HMAC-SHA256. An
+// empty keyID means the hash was created without a pepper.
+func (h *phcHasher) pepper(password, keyID string) ([]byte, error) {
+	if keyID == "" {
+		return []byte(password), nil
+	}
+	secret, ok := h.cfg.Peppers[keyID]
+	if !ok {
+		return nil, ErrUnknownPepper
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(password))
+	return []byte(base64.RawStdEncoding.EncodeToString(mac.Sum(nil))), nil
+}
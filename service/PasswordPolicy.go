@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/ccojocar/zxcvbn-go"
+)
+
+const (
+	PasswordTooShort         = "password_too_short"
+	PasswordTooLong          = "password_too_long"
+	PasswordBreached         = "password_breached"
+	PasswordContainsIdentity = "password_contains_identity"
+	PasswordTooWeak          = "password_too_weak"
+)
+
+type PasswordPolicy struct {
+	MinLength int
+	// bcrypt only looks at the first 72 bytes, longer passwords are rejected.
+	MaxBytes int
+	// MinScore is the lowest accepted zxcvbn score, from 0 (guessable) to 4.
+	MinScore int
+	Breached *BreachedPasswords
+}
+
+func DefaultPasswordPolicy(breached *BreachedPasswords) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: 10,
+		MaxBytes:  72,
+		MinScore:  3,
+		Breached:  breached,
+	}
+}
+
+// Validate checks password against the policy. username and email are used to
+// reject passwords built from the user's own identifiers.
+func (p *PasswordPolicy) Validate(field, password, username, email string) error {
+	var violations []model.FieldError
+	violation := func(code, message string) {
+		violations = append(violations, model.FieldError{Field: field, Code: code, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violation(PasswordTooShort, fmt.Sprintf("password must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violation(PasswordTooLong, fmt.Sprintf("password must not be longer than %d bytes", p.MaxBytes))
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violation(PasswordBreached, "password appears in a list of breached passwords")
+	}
+
+	lowered := strings.ToLower(password)
+	identities := []string{username}
+	if local, _, ok := strings.Cut(email, "@"); ok {
+		identities = append(identities, email, local)
+	}
+	for _, identity := range identities {
+		identity = strings.ToLower(strings.TrimSpace(identity))
+		if len(identity) >= 3 && strings.Contains(lowered, identity) {
+			violation(PasswordContainsIdentity, "password must not contain the username or email")
+			break
+		}
+	}
+
+	if password != "" && p.MinScore > 0 {
+		strength := zxcvbn.PasswordStrength(password, identities)
+		if strength.Score < p.MinScore {
+			violation(PasswordTooWeak, fmt.Sprintf("password is too easy to guess (score %d of 4, at least %d required)", strength.Score, p.MinScore))
+		}
+	}
+
+	if len(violations) > 0 {
+		return apperror.Validation(violations...)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidSessionID = apperror.New(apperror.KindInvalid, "session.invalid_id", "invalid session id")
+	// ErrSessionRevoked rejects access tokens of sessions that were ended.
+	ErrSessionRevoked = apperror.New(apperror.KindUnauthenticated, "auth.session_revoked", "the session has ended, log in again")
+)
+
+type SessionPolicy struct {
+	// Lifetime is how long a session lasts without its refresh token being
+	// used. Every refresh extends it by Lifetime again.
+	Lifetime time.Duration
+	// AccessTokenLifetime is how long the access tokens of the session are
+	// valid. A revoked session's tokens are rejected right away regardless.
+	AccessTokenLifetime time.Duration
+	// MaxPerRole caps the concurrent sessions of users with a role. A login
+	// beyond the cap ends the least recently used sessions. Roles that are
+	// missing or have zero have no limit.
+	MaxPerRole map[model.UserRole]int
+}
+
+func DefaultSessionPolicy() SessionPolicy {
+	return SessionPolicy{Lifetime: 30 * 24 * time.Hour, AccessTokenLifetime: 24 * time.Hour}
+}
+
+// SessionService manages the login sessions and their refresh tokens, and
+// remembers the devices they were opened from.
+type SessionService struct {
+	store   repository.SessionStore
+	devices repository.KnownDeviceStore
+	geoIP   *GeoIP
+	policy  SessionPolicy
+	auditor *Auditor
+	logger  *log.Logger
+}
+
+func NewSessionService(store repository.SessionStore, devices repository.KnownDeviceStore, geoIP *GeoIP, policy SessionPolicy, auditor *Auditor, logger *log.Logger) *SessionService {
+	return &SessionService{store: store, devices: devices, geoIP: geoIP, policy: policy, auditor: auditor, logger: logger}
+}
+
+// newRefreshToken returns a random token and the hash it is stored under.
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Start opens a session for user on the device making the request and
+// returns it with its refresh token. newDevice reports a login from a device
+// or location the user hasn't used before; the first login of a user is
+// never new.
+func (s *SessionService) Start(ctx context.Context, user *model.User) (session *model.Session, refreshToken string, newDevice bool, err error) {
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", false, err
+	}
+	info := requestInfo(ctx)
+	location := s.geoIP.Locate(info.IP)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	session = &model.Session{
+		UserID:           user.ID,
+		Device:           DeviceName(info.UserAgent),
+		UserAgent:        info.UserAgent,
+		IP:               info.IP,
+		Location:         location.String(),
+		CreatedAt:        now,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(s.policy.Lifetime),
+		RefreshTokenHash: hash,
+	}
+	if err := s.store.CreateSession(ctx, session); err != nil {
+		return nil, "", false, err
+	}
+	newDevice = s.rememberDevice(ctx, session, location)
+
+	if max := s.policy.MaxPerRole[user.Role]; max > 0 {
+		evicted, err := s.store.EvictSessions(ctx, user.ID, max)
+		if err != nil {
+			s.logger.Printf("Failed to enforce the session limit of %s: %v", user.Username, err)
+		} else if evicted > 0 {
+			s.logger.Printf("Ended %d old session(s) of %s, the limit for %s is %d", evicted, user.Username, user.Role, max)
+		}
+	}
+	return session, token, newDevice, nil
+}
+
+// rememberDevice records the device of a new session and reports whether it
+// is new to a user with known devices. Failures are only logged, they must
+// not prevent the login.
+func (s *SessionService) rememberDevice(ctx context.Context, session *model.Session, location GeoLocation) bool {
+	known, err := s.devices.CountDevices(ctx, session.UserID)
+	if err != nil {
+		s.logger.Printf("Failed to count known devices of %s: %v", session.UserID.Hex(), err)
+		return false
+	}
+	seen, err := s.devices.RememberDevice(ctx, &model.KnownDevice{
+		UserID:      session.UserID,
+		Fingerprint: deviceFingerprint(session.Device, session.IP, location),
+		Device:      session.Device,
+		Location:    session.Location,
+		IP:          session.IP,
+		FirstSeenAt: session.CreatedAt,
+		LastSeenAt:  session.CreatedAt,
+	})
+	if err != nil {
+		s.logger.Printf("Failed to remember device of %s: %v", session.UserID.Hex(), err)
+		return false
+	}
+	return !seen && known > 0
+}
+
+// deviceFingerprint identifies a device and where it is. The location is the
+// country if the GeoIP database knows it, otherwise the network of the IP
+// address, so moving between the addresses of one provider is not new.
+func deviceFingerprint(device, ip string, location GeoLocation) string {
+	where := location.CountryCode
+	if where == "" {
+		where = ip
+		if parsed := net.ParseIP(ip); parsed != nil {
+			if ip4 := parsed.To4(); ip4 != nil {
+				where = ip4.Mask(net.CIDRMask(16, 32)).String()
+			} else {
+				where = parsed.Mask(net.CIDRMask(32, 128)).String()
+			}
+		}
+	}
+	sum := sha256.Sum256([]byte(device + "\x00" + where))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ForgetDevices makes every device of a user new again.
+func (s *SessionService) ForgetDevices(ctx context.Context, userID primitive.ObjectID) error {
+	return s.devices.ForgetDevices(ctx, userID)
+}
+
+// Refresh rotates a refresh token and returns the session with the token
+// that replaces it.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string) (*model.Session, string, error) {
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	session, err := s.store.RotateRefreshToken(ctx, hashRefreshToken(refreshToken), hash, now, now.Add(s.policy.Lifetime), requestInfo(ctx).IP)
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		s.logger.Printf("Refresh token reuse detected, session revoked")
+		s.auditor.Record(ctx, model.AuditRefreshTokenReuse, err, model.AuditEntry{})
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// Check fails with ErrSessionRevoked unless the session is live. It only
+// reads, backends validate tokens through it on every request.
+func (s *SessionService) Check(ctx context.Context, sessionID string) error {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+	if _, err := s.store.GetSession(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	return nil
+}
+
+// Touch records activity of the session from the client of ctx. Call it
+// only for requests the user made, so the session shows their address.
+// Failures are only logged.
+func (s *SessionService) Touch(ctx context.Context, sessionID string) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return
+	}
+	if err := s.store.TouchSession(ctx, id, time.Now().UTC().Truncate(time.Millisecond), requestInfo(ctx).IP); err != nil {
+		s.logger.Printf("Failed to record activity of session %s: %v", sessionID, err)
+	}
+}
+
+// List returns the sessions of a user with the one of currentSessionID
+// marked.
+func (s *SessionService) List(ctx context.Context, userID, currentSessionID string) ([]model.Session, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	sessions, err := s.store.ListSessions(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == currentSessionID
+	}
+	return sessions, nil
+}
+
+// Revoke ends one session of a user.
+func (s *SessionService) Revoke(ctx context.Context, userID, sessionID string) error {
+	err := s.revoke(ctx, userID, sessionID)
+	s.auditor.Record(ctx, model.AuditSessionRevoke, err, model.AuditEntry{
+		TargetID: userID,
+		Details:  map[string]string{"session_id": sessionID},
+	})
+	return err
+}
+
+func (s *SessionService) revoke(ctx context.Context, userID, sessionID string) error {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrInvalidSessionID
+	}
+	return s.store.DeleteSession(ctx, oid, id)
+}
+
+// RevokeOthers ends all sessions of a user but currentSessionID, which may be
+// empty to end all of them, and returns how many were ended.
+func (s *SessionService) RevokeOthers(ctx context.Context, userID, currentSessionID string) (int64, error) {
+	revoked, err := s.revokeOthers(ctx, userID, currentSessionID)
+	scope := "others"
+	if currentSessionID == "" {
+		scope = "all"
+	}
+	s.auditor.Record(ctx, model.AuditSessionRevoke, err, model.AuditEntry{
+		TargetID: userID,
+		Details:  map[string]string{"scope": scope, "count": strconv.FormatInt(revoked, 10)},
+	})
+	return revoked, err
+}
+
+func (s *SessionService) revokeOthers(ctx context.Context, userID, currentSessionID string) (int64, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, ErrInvalidUserID
+	}
+	keep := primitive.NilObjectID
+	if currentSessionID != "" {
+		if keep, err = primitive.ObjectIDFromHex(currentSessionID); err != nil {
+			return 0, ErrInvalidSessionID
+		}
+	}
+	return s.store.DeleteSessions(ctx, oid, keep)
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer follows the provider main installs; until then its spans are no-ops.
+var tracer = otel.Tracer("github.com/MicroSOA-09/auth-service/service")
+
+// endSpan marks the span failed if err is set and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// hashPassword and verifyPassword get their own spans, hashing is meant to be
+// slow and usually dominates the requests that do it.
+func (s *AuthService) hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracer.Start(ctx, "PasswordHasher.Hash")
+	encoded, err := s.Hasher.Hash(password)
+	endSpan(span, err)
+	return encoded, err
+}
+
+func (s *AuthService) verifyPassword(ctx context.Context, password, encoded string) (bool, error) {
+	_, span := tracer.Start(ctx, "PasswordHasher.Verify")
+	ok, err := s.Hasher.Verify(password, encoded)
+	endSpan(span, err)
+	return ok, err
+}
@@ -2,62 +2,279 @@ package service
 
 import (
 	"context"
-	"errors"
-	"fmt"
 
+	"github.com/MicroSOA-09/auth-service/apperror"
 	"github.com/MicroSOA-09/auth-service/model"
 	"github.com/MicroSOA-09/auth-service/repository"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var ErrInvalidUserID = apperror.New(apperror.KindInvalid, "user.invalid_id", "invalid user ID format")
+
 type UserService struct {
-	UserRepo *repository.UserRepo
+	UserRepo repository.UserStore
+	Sessions *SessionService
+	Auditor  *Auditor
 }
 
-func NewUserService(repo *repository.UserRepo) *UserService {
+func NewUserService(repo repository.UserStore, sessions *SessionService, auditor *Auditor) *UserService {
 	return &UserService{
 		UserRepo: repo,
+		Sessions: sessions,
+		Auditor:  auditor,
 	}
 }
 
-func (service *UserService) GetAll(ctx context.Context) ([]model.User, error) {
+func (service *UserService) GetAll(ctx context.Context) (_ []model.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetAll")
+	defer func() { endSpan(span, err) }()
+
 	users, err := service.UserRepo.GetAll(ctx)
 	// HTTP REQ to ASP.NET application to get author info
 	if err != nil {
-		return nil, fmt.Errorf(fmt.Sprintf("there are no users"))
+		return nil, err
 	}
 	return users, nil
 }
 
-func (service *UserService) GetUser(ctx context.Context, id string) (*model.User, error) {
+func (service *UserService) GetUser(ctx context.Context, id string) (_ *model.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUser")
+	defer func() { endSpan(span, err) }()
+
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, errors.New("invalid user ID format")
+		return nil, ErrInvalidUserID
 	}
 	user, err := service.UserRepo.GetUser(ctx, oid)
 	// HTTP REQ to ASP.NET application to get author info
 	if err != nil {
-		return nil, fmt.Errorf(fmt.Sprintf("there are no user"))
+		return nil, err
 	}
 	return user, nil
 }
 
-func (service *UserService) GetUsernames(ctx context.Context, ids []string) ([]model.User, error) {
-	// Validacija ID-ova
+// GetUsernames backs the deprecated GET /api/user/getUsernames/{ids}. Unlike
+// LookupUsers a single malformed ID fails the whole request.
+func (service *UserService) GetUsernames(ctx context.Context, ids []string) (_ []model.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUsernames")
+	defer func() { endSpan(span, err) }()
+
+	var objectIds []primitive.ObjectID
+	for _, id := range ids {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, ErrInvalidUserID
+		}
+		objectIds = append(objectIds, oid)
+	}
+	return service.UserRepo.GetUserByIds(ctx, objectIds)
+}
+
+const (
+	FieldUsername     = "username"
+	FieldRole         = "role"
+	FieldFirstName    = "first_name"
+	FieldLastName     = "last_name"
+	FieldProfileImage = "profile_image"
+)
+
+// LookupFields are the fields LookupUsers can return. Email is left out on
+// purpose, other services have no business reading it in bulk.
+var LookupFields = []string{FieldUsername, FieldRole, FieldFirstName, FieldLastName, FieldProfileImage}
+
+// LookupUsers returns the requested fields of the active users among ids.
+// fields must be a subset of LookupFields and defaults to the username.
+func (service *UserService) LookupUsers(ctx context.Context, ids []string, fields []string) (_ *model.UserBatch, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.LookupUsers")
+	defer func() { endSpan(span, err) }()
+
+	if len(fields) == 0 {
+		fields = []string{FieldUsername}
+	}
+	batch := &model.UserBatch{Users: map[string]map[string]string{}, NotFound: []string{}}
+
+	seen := map[string]bool{}
 	var objectIds []primitive.ObjectID
 	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
 		oid, err := primitive.ObjectIDFromHex(id)
 		if err != nil {
-			return nil, errors.New("invalid user ID format")
+			batch.NotFound = append(batch.NotFound, id)
+			continue
 		}
 		objectIds = append(objectIds, oid)
 	}
-	println(objectIds)
-	// Poziv repozitorijuma
+
 	users, err := service.UserRepo.GetUserByIds(ctx, objectIds)
 	if err != nil {
 		return nil, err
 	}
+	persons := map[primitive.ObjectID]model.Person{}
+	if needsPerson(fields) {
+		found := make([]primitive.ObjectID, len(users))
+		for i, user := range users {
+			found[i] = user.ID
+		}
+		list, err := service.UserRepo.GetPersonsByUserIds(ctx, found)
+		if err != nil {
+			return nil, err
+		}
+		for _, person := range list {
+			persons[person.UserID] = person
+		}
+	}
 
-	return users, nil
+	for _, user := range users {
+		batch.Users[user.ID.Hex()] = project(user, persons[user.ID], fields)
+	}
+	for _, oid := range objectIds {
+		if _, ok := batch.Users[oid.Hex()]; !ok {
+			batch.NotFound = append(batch.NotFound, oid.Hex())
+		}
+	}
+	return batch, nil
+}
+
+func needsPerson(fields []string) bool {
+	for _, field := range fields {
+		if field != FieldUsername && field != FieldRole {
+			return true
+		}
+	}
+	return false
+}
+
+func project(user model.User, person model.Person, fields []string) map[string]string {
+	projected := make(map[string]string, len(fields))
+	for _, field := range fields {
+		switch field {
+		case FieldUsername:
+			projected[field] = user.Username
+		case FieldRole:
+			projected[field] = string(user.Role)
+		case FieldFirstName:
+			projected[field] = person.FirstName
+		case FieldLastName:
+			projected[field] = person.LastName
+		case FieldProfileImage:
+			projected[field] = person.ProfileImage
+		}
+	}
+	return projected
+}
+
+// ChangeRole gives the user a new role. Setting the current role again is not
+// an error and publishes nothing.
+func (service *UserService) ChangeRole(ctx context.Context, id string, role model.UserRole) (*model.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.ChangeRole")
+	user, oldRole, err := service.changeRole(ctx, id, role)
+	details := map[string]string{"new_role": string(role)}
+	if oldRole != "" {
+		details["old_role"] = string(oldRole)
+	}
+	service.Auditor.Record(ctx, model.AuditRoleChange, err, model.AuditEntry{TargetID: id, Details: details})
+	endSpan(span, err)
+	return user, err
+}
+
+func (service *UserService) changeRole(ctx context.Context, id string, role model.UserRole) (*model.User, model.UserRole, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, "", ErrInvalidUserID
+	}
+	user, err := service.UserRepo.GetUser(ctx, oid)
+	if err != nil {
+		return nil, "", err
+	}
+	oldRole := user.Role
+	event, err := newEvent(EventUserRoleChanged, oid, userRoleChangedPayload{UserID: id, OldRole: user.Role, NewRole: role})
+	if err != nil {
+		return nil, oldRole, err
+	}
+	if _, err := service.UserRepo.SetUserRole(ctx, oid, role, event); err != nil {
+		return nil, oldRole, err
+	}
+	user.Role = role
+	return user, oldRole, nil
+}
+
+func (service *UserService) Deactivate(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "UserService.Deactivate")
+	err := service.deactivate(ctx, id)
+	service.Auditor.Record(ctx, model.AuditUserDeactivate, err, model.AuditEntry{TargetID: id})
+	endSpan(span, err)
+	return err
+}
+
+func (service *UserService) deactivate(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+	event, err := newEvent(EventUserDeactivated, oid, userPayload{UserID: id})
+	if err != nil {
+		return err
+	}
+	if _, err := service.UserRepo.SetUserActive(ctx, oid, false, event); err != nil {
+		return err
+	}
+	// Access and refresh tokens only need a live session, end them all.
+	// Also done if the user was already inactive, so a retry finishes the job.
+	_, err = service.Sessions.RevokeOthers(ctx, id, "")
+	return err
+}
+
+// ProfileUpdate holds the profile fields to change, nil fields are kept.
+type ProfileUpdate struct {
+	FirstName    *string
+	LastName     *string
+	ProfileImage *string
+	Locale       *string
+}
+
+func (service *UserService) UpdateProfile(ctx context.Context, id string, update ProfileUpdate) (*model.Person, error) {
+	ctx, span := tracer.Start(ctx, "UserService.UpdateProfile")
+	person, err := service.updateProfile(ctx, id, update)
+	service.Auditor.Record(ctx, model.AuditProfileUpdate, err, model.AuditEntry{TargetID: id})
+	endSpan(span, err)
+	return person, err
+}
+
+func (service *UserService) updateProfile(ctx context.Context, id string, update ProfileUpdate) (*model.Person, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	person, err := service.UserRepo.GetPerson(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []struct{ target, value *string }{
+		{&person.FirstName, update.FirstName},
+		{&person.LastName, update.LastName},
+		{&person.ProfileImage, update.ProfileImage},
+		{&person.Locale, update.Locale},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+
+	event, err := newEvent(EventProfileUpdated, oid, profileUpdatedPayload{
+		UserID:       id,
+		FirstName:    person.FirstName,
+		LastName:     person.LastName,
+		ProfileImage: person.ProfileImage,
+		Locale:       person.Locale,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := service.UserRepo.UpdatePerson(ctx, person, event); err != nil {
+		return nil, err
+	}
+	return person, nil
 }
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+func TestDeactivateEndsSessions(t *testing.T) {
+	auth := newTestAuthService(t)
+	users := NewUserService(auth.users, auth.Sessions, auth.Auditor)
+	user := auth.createUser(t, "alice", true)
+	ctx := context.Background()
+
+	tokens, err := auth.Login(ctx, "alice", testPassword, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := users.Deactivate(ctx, user.ID.Hex()); err != nil {
+		t.Fatalf("Deactivate: %v", err)
+	}
+
+	if _, err := auth.ValidateJWT(ctx, tokens.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("ValidateJWT after Deactivate err = %v, want ErrSessionRevoked", err)
+	}
+	if _, err := auth.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, repository.ErrRefreshTokenInvalid) {
+		t.Errorf("Refresh after Deactivate err = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
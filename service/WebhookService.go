@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/apperror"
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidWebhookID = apperror.New(apperror.KindInvalid, "webhook.invalid_id", "invalid webhook or delivery ID format")
+
+type WebhookService struct {
+	store   repository.WebhookStore
+	auditor *Auditor
+}
+
+func NewWebhookService(store repository.WebhookStore, auditor *Auditor) *WebhookService {
+	return &WebhookService{store: store, auditor: auditor}
+}
+
+// CreateWebhook subscribes url to the given event types. Without a secret
+// one is generated; the caller has to hand it to the receiver, it is never
+// shown again.
+func (s *WebhookService) CreateWebhook(ctx context.Context, url string, events []string, secret string) (*model.Webhook, error) {
+	if secret == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		secret = "whsec_" + base64.RawURLEncoding.EncodeToString(random)
+	}
+	webhook := &model.Webhook{
+		URL:       url,
+		Events:    events,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	err := s.store.CreateWebhook(ctx, webhook)
+	s.auditor.Record(ctx, model.AuditWebhookCreate, err, model.AuditEntry{
+		TargetID: webhook.ID.Hex(),
+		Details:  map[string]string{"url": url, "events": strings.Join(events, ",")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	return s.store.ListWebhooks(ctx)
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidWebhookID
+	}
+	return s.store.GetWebhook(ctx, oid)
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidWebhookID
+	}
+	err = s.store.DeleteWebhook(ctx, oid)
+	s.auditor.Record(ctx, model.AuditWebhookDelete, err, model.AuditEntry{TargetID: id})
+	return err
+}
+
+// Deliveries returns the delivery log of a webhook, newest first.
+func (s *WebhookService) Deliveries(ctx context.Context, id string, limit int) ([]model.WebhookDelivery, error) {
+	webhook, err := s.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.ListDeliveries(ctx, webhook.ID, limit)
+}
+
+// ReplayDelivery sends a delivery again, e.g. after the receiver was fixed.
+func (s *WebhookService) ReplayDelivery(ctx context.Context, deliveryID string) (*model.WebhookDelivery, error) {
+	oid, err := primitive.ObjectIDFromHex(deliveryID)
+	if err != nil {
+		return nil, ErrInvalidWebhookID
+	}
+	delivery, err := s.store.ReplayDelivery(ctx, oid, time.Now())
+	s.auditor.Record(ctx, model.AuditWebhookReplay, err, model.AuditEntry{TargetID: deliveryID})
+	return delivery, err
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+// Dispatcher is an outbox publisher that queues a delivery of the event for
+// every webhook subscribed to its type. The Worker sends them.
+type Dispatcher struct {
+	store repository.WebhookStore
+}
+
+func NewDispatcher(store repository.WebhookStore) *Dispatcher {
+	return &Dispatcher{store: store}
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, event model.Event) error {
+	webhooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []model.WebhookDelivery
+	for _, webhook := range webhooks {
+		if webhook.Matches(event.Type) {
+			deliveries = append(deliveries, model.WebhookDelivery{
+				WebhookID: webhook.ID,
+				EventID:   event.ID,
+				EventType: event.Type,
+				Payload:   body,
+			})
+		}
+	}
+	return d.store.EnqueueDeliveries(ctx, deliveries)
+}
+
+func (d *Dispatcher) Close() error {
+	return nil
+}
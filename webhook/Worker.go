@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MicroSOA-09/auth-service/model"
+	"github.com/MicroSOA-09/auth-service/repository"
+)
+
+// Headers of a delivery. Receivers verify X-Webhook-Signature, which is
+// "sha256=" followed by the hex HMAC-SHA256 of timestamp + "." + body keyed
+// with the webhook secret, and should reject old timestamps to stop replays.
+const (
+	HeaderDeliveryID = "X-Webhook-Id"
+	HeaderEvent      = "X-Webhook-Event"
+	HeaderEventID    = "X-Webhook-Event-Id"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderSignature  = "X-Webhook-Signature"
+)
+
+// Sign returns the X-Webhook-Signature value of body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Worker sends queued deliveries. A delivery succeeds on any 2xx response;
+// otherwise it is retried with exponential backoff until MaxAttempts, then
+// marked failed. Failed deliveries can be replayed.
+type Worker struct {
+	store  repository.WebhookStore
+	client *http.Client
+	logger *log.Logger
+
+	PollInterval  time.Duration
+	Lease         time.Duration
+	MaxAttempts   int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+func NewWorker(store repository.WebhookStore, logger *log.Logger) *Worker {
+	return &Worker{
+		store: store,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// A redirect would resend the signed body to a URL nobody
+			// configured.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		logger:        logger,
+		PollInterval:  time.Second,
+		Lease:         time.Minute,
+		MaxAttempts:   10,
+		RetryDelay:    30 * time.Second,
+		MaxRetryDelay: 6 * time.Hour,
+	}
+}
+
+// Run sends deliveries until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		delivered, err := w.deliverOne(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.logger.Printf("Webhook worker failed: %v", err)
+		}
+		if delivered {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+func (w *Worker) deliverOne(ctx context.Context) (bool, error) {
+	delivery, err := w.store.ClaimDelivery(ctx, time.Now(), w.Lease)
+	if err != nil || delivery == nil {
+		return false, err
+	}
+	webhook, err := w.store.GetWebhook(ctx, delivery.WebhookID)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		// Deleted while the delivery was claimed, its deliveries are gone too.
+		return true, nil
+	}
+	if err != nil {
+		return true, err
+	}
+
+	attempt := w.send(ctx, webhook, delivery)
+	status, nextAttemptAt := model.DeliverySucceeded, time.Time{}
+	if attempt.Error != "" {
+		status, nextAttemptAt = model.DeliveryPending, attempt.At.Add(w.retryDelay(delivery.Attempts))
+		if delivery.Attempts >= w.MaxAttempts {
+			status = model.DeliveryFailed
+		}
+		w.logger.Printf("Webhook delivery %s to %s failed (attempt %d, %s): %s",
+			delivery.ID.Hex(), webhook.URL, delivery.Attempts, status, attempt.Error)
+	}
+	err = w.store.RecordAttempt(ctx, delivery.ID, attempt, status, nextAttemptAt)
+	if errors.Is(err, repository.ErrDeliveryNotFound) {
+		return true, nil
+	}
+	return true, err
+}
+
+func (w *Worker) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) model.DeliveryAttempt {
+	start := time.Now()
+	attempt := model.DeliveryAttempt{At: start}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "auth-service-webhooks")
+	request.Header.Set(HeaderDeliveryID, delivery.ID.Hex())
+	request.Header.Set(HeaderEvent, delivery.EventType)
+	request.Header.Set(HeaderEventID, delivery.EventID.Hex())
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(start.Unix(), 10))
+	request.Header.Set(HeaderSignature, Sign(webhook.Secret, start.Unix(), delivery.Payload))
+
+	response, err := w.client.Do(request)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	// Drain a bit of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	response.Body.Close()
+
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", response.StatusCode)
+	}
+	return attempt
+}
+
+func (w *Worker) retryDelay(attempts int) time.Duration {
+	if shift := attempts - 1; shift >= 0 && shift < 20 {
+		return min(w.RetryDelay<<shift, w.MaxRetryDelay)
+	}
+	return w.MaxRetryDelay
+}